@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// AddressNetwork identifies the network that addresses must belong to
+type AddressNetwork struct {
+	ID    uint   // in the header of Shelley addresses
+	Magic uint32 // in the attributes of Byron addresses, which don't contain it on mainnet
+}
+
+// ParseAddress decodes a bech32 Shelley address or a base58 Byron address, and checks that it is a payment address of the network.
+// The checksum is verified for both formats.
+func ParseAddress(s string, network AddressNetwork) (common.Address, error) {
+	if s == "" {
+		return common.Address{}, errors.New("empty address")
+	}
+
+	// bech32 strings are lowercase, while base58 Byron addresses (Ae2..., Ddz...) always contain uppercase characters
+	if strings.ToLower(s) != s {
+		return parseByronAddress(s, network)
+	}
+
+	hrp, data, err := bech32.DecodeNoLimit(s)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid bech32 address: %v", err)
+	}
+
+	raw, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid bech32 address: %v", err)
+	}
+
+	switch hrp {
+	case "addr", "addr_test":
+	case "stake", "stake_test":
+		return common.Address{}, errors.New("stake addresses can't hold UTXOs, use the stake address as a credential to query the UTXOs of its addresses")
+	default:
+		return common.Address{}, fmt.Errorf("unsupported bech32 prefix %q, expected addr or addr_test", hrp)
+	}
+
+	if len(raw) == 0 {
+		return common.Address{}, errors.New("empty address")
+	}
+
+	addrType := (raw[0] & common.AddressHeaderTypeMask) >> 4
+	networkID := uint(raw[0] & common.AddressHeaderNetworkMask)
+
+	switch addrType {
+	case common.AddressTypeKeyKey, common.AddressTypeScriptKey, common.AddressTypeKeyScript, common.AddressTypeScriptScript:
+		if len(raw) != 1+2*common.AddressHashSize {
+			return common.Address{}, fmt.Errorf("base address must be %d bytes, got %d bytes", 1+2*common.AddressHashSize, len(raw))
+		}
+	case common.AddressTypeKeyPointer, common.AddressTypeScriptPointer:
+		if len(raw) < 1+common.AddressHashSize || !validStakePointer(raw[1+common.AddressHashSize:]) {
+			return common.Address{}, errors.New("invalid pointer address")
+		}
+	case common.AddressTypeKeyNone, common.AddressTypeScriptNone:
+		if len(raw) != 1+common.AddressHashSize {
+			return common.Address{}, fmt.Errorf("enterprise address must be %d bytes, got %d bytes", 1+common.AddressHashSize, len(raw))
+		}
+	default:
+		return common.Address{}, fmt.Errorf("header type %d isn't a Shelley payment address", addrType)
+	}
+
+	if (hrp == "addr") != (networkID == common.AddressNetworkMainnet) {
+		return common.Address{}, fmt.Errorf("prefix %s doesn't match network ID %d of the address header", hrp, networkID)
+	}
+
+	if networkID != network.ID {
+		return common.Address{}, fmt.Errorf("address of network %d, expected network %d", networkID, network.ID)
+	}
+
+	return common.NewAddress(s)
+}
+
+func parseByronAddress(s string, network AddressNetwork) (common.Address, error) {
+	raw := base58.Decode(s)
+	if len(raw) == 0 {
+		return common.Address{}, errors.New("invalid base58 Byron address")
+	}
+
+	// a Byron address is CBOR, starting with an array of 2 items (the payload and its CRC32 checksum)
+	if raw[0] != 0x82 {
+		return common.Address{}, errors.New("invalid Byron address")
+	}
+
+	addr, err := common.NewAddress(s)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("invalid Byron address: %v", err)
+	}
+
+	attr := addr.ByronAttr()
+
+	switch {
+	case network.ID == common.AddressNetworkMainnet && attr.Network != nil:
+		return common.Address{}, fmt.Errorf("Byron address of the testnet with magic %d, expected a mainnet address", *attr.Network)
+	case network.ID != common.AddressNetworkMainnet && attr.Network == nil:
+		return common.Address{}, errors.New("Byron address of mainnet, expected a testnet address")
+	case attr.Network != nil && *attr.Network != network.Magic:
+		return common.Address{}, fmt.Errorf("Byron address of the testnet with magic %d, expected magic %d", *attr.Network, network.Magic)
+	}
+
+	return addr, nil
+}
+
+// a stake pointer is made of 3 variable-length naturals (slot, tx index, certificate index), 7 bits per byte with the high bit set on all but the last byte
+func validStakePointer(data []byte) bool {
+	naturals := 0
+	for _, b := range data {
+		if b&0x80 == 0 {
+			naturals++
+		}
+	}
+
+	return naturals == 3 && data[len(data)-1]&0x80 == 0
+}
+
+// AddressQuery selects the UTXOs returned by /api/address/{address}/utxos.
+// Exactly one of the fields is set.
+type AddressQuery struct {
+	Address      string // matches this address only
+	PaymentCred  []byte // key or script hash, matches all the addresses with this payment part
+	StakeAddress []byte // header and key or script hash, matches all the addresses delegating to this stake credential
+}
+
+// ParseAddressQuery accepts:
+//   - addresses: addr1..., addr_test1... or base58 Byron addresses
+//   - payment credentials: addr_vkh1... (key hash), script1... (script hash), or 56 hex characters (either)
+//   - stake addresses: stake1... or stake_test1..., or 58 hex characters (header and hash)
+func ParseAddressQuery(s string, network AddressNetwork) (AddressQuery, error) {
+	if strings.ToLower(s) != s {
+		if _, err := parseByronAddress(s, network); err != nil {
+			return AddressQuery{}, err
+		}
+
+		return AddressQuery{Address: s}, nil
+	}
+
+	if raw, err := hex.DecodeString(s); err == nil {
+		switch len(raw) {
+		case common.AddressHashSize:
+			return AddressQuery{PaymentCred: raw}, nil
+		case common.AddressHashSize + 1:
+			return parseStakeAddressQuery(raw, network.ID)
+		default:
+			return AddressQuery{}, fmt.Errorf("hex credential must be 28 bytes (payment credential) or 29 bytes (stake address), got %d bytes", len(raw))
+		}
+	}
+
+	hrp, data, err := bech32.DecodeNoLimit(s)
+	if err != nil {
+		return AddressQuery{}, fmt.Errorf("invalid bech32 address or credential: %v", err)
+	}
+
+	if hrp == "addr" || hrp == "addr_test" {
+		if _, err := ParseAddress(s, network); err != nil {
+			return AddressQuery{}, err
+		}
+
+		return AddressQuery{Address: s}, nil
+	}
+
+	raw, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return AddressQuery{}, fmt.Errorf("invalid bech32 address or credential: %v", err)
+	}
+
+	switch hrp {
+	case "addr_vkh", "script":
+		if len(raw) != common.AddressHashSize {
+			return AddressQuery{}, fmt.Errorf("%s credential must be %d bytes, got %d bytes", hrp, common.AddressHashSize, len(raw))
+		}
+
+		return AddressQuery{PaymentCred: raw}, nil
+	case "stake", "stake_test":
+		if len(raw) != common.AddressHashSize+1 {
+			return AddressQuery{}, fmt.Errorf("stake address must be %d bytes, got %d bytes", common.AddressHashSize+1, len(raw))
+		}
+
+		return parseStakeAddressQuery(raw, network.ID)
+	default:
+		return AddressQuery{}, fmt.Errorf("unsupported bech32 prefix %q", hrp)
+	}
+}
+
+func parseStakeAddressQuery(raw []byte, networkID uint) (AddressQuery, error) {
+	addrType := (raw[0] & common.AddressHeaderTypeMask) >> 4
+	if addrType != common.AddressTypeNoneKey && addrType != common.AddressTypeNoneScript {
+		return AddressQuery{}, fmt.Errorf("header type %d isn't a stake address", addrType)
+	}
+
+	if network := uint(raw[0] & common.AddressHeaderNetworkMask); network != networkID {
+		return AddressQuery{}, fmt.Errorf("stake address of network %d, expected network %d", network, networkID)
+	}
+
+	return AddressQuery{StakeAddress: raw}, nil
+}
+
+// Matches returns true if the address is selected by the query, used to apply the mempool overlay
+func (q AddressQuery) Matches(address string) bool {
+	if q.Address != "" {
+		return address == q.Address
+	}
+
+	addr, err := common.NewAddress(address)
+	if err != nil {
+		return false
+	}
+
+	paymentCred, stakeAddress := addressCredentials(addr)
+
+	if q.PaymentCred != nil {
+		return paymentCred != nil && bytes.Equal(paymentCred, q.PaymentCred)
+	}
+
+	return stakeAddress != nil && bytes.Equal(stakeAddress, q.StakeAddress)
+}
+
+// returns the payment credential (nil for Byron addresses) and the stake address (nil if the address has no stake credential)
+func addressCredentials(addr common.Address) ([]byte, []byte) {
+	var paymentCred []byte
+	if isKeyAddress(addr) || isScriptAddress(addr) {
+		hash := addr.PaymentKeyHash()
+		paymentCred = hash[:]
+	}
+
+	// only base addresses contain a stake credential, Address.StakeAddress doesn't handle a key payment part with a script stake part
+	var stakeType uint8
+	switch addr.Type() {
+	case common.AddressTypeKeyKey, common.AddressTypeScriptKey:
+		stakeType = common.AddressTypeNoneKey
+	case common.AddressTypeKeyScript, common.AddressTypeScriptScript:
+		stakeType = common.AddressTypeNoneScript
+	default:
+		return paymentCred, nil
+	}
+
+	hash := addr.StakeKeyHash()
+
+	return paymentCred, append([]byte{stakeType<<4 | uint8(addr.NetworkId())}, hash[:]...)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+func TestAddressQuery(t *testing.T) {
+	_, enterprise := newValidatorTestKey(1)
+	payment := enterprise.PaymentKeyHash()
+
+	_, other := newValidatorTestKey(2)
+	stake := other.PaymentKeyHash()
+
+	base, err := common.NewAddressFromParts(common.AddressTypeKeyKey, common.AddressNetworkTestnet, payment[:], stake[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scriptStake, err := common.NewAddressFromParts(common.AddressTypeKeyScript, common.AddressNetworkTestnet, payment[:], stake[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodeBech32 := func(hrp string, data []byte) string {
+		conv, err := bech32.ConvertBits(data, 8, 5, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := bech32.Encode(hrp, conv)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+
+	stakeKeyAddress := append([]byte{0xe0}, stake[:]...)
+	stakeScriptAddress := append([]byte{0xf0}, stake[:]...)
+
+	testCases := []struct {
+		name    string
+		query   string
+		ok      bool
+		matches []string
+		others  []string
+	}{
+		{"Address", base.String(), true, []string{base.String()}, []string{enterprise.String(), scriptStake.String()}},
+		{"KeyHash", encodeBech32("addr_vkh", payment[:]), true, []string{base.String(), enterprise.String(), scriptStake.String()}, []string{other.String()}},
+		{"ScriptHash", encodeBech32("script", payment[:]), true, []string{base.String()}, []string{other.String()}},
+		{"HexCredential", hex.EncodeToString(payment[:]), true, []string{enterprise.String()}, []string{other.String()}},
+		{"StakeAddress", encodeBech32("stake_test", stakeKeyAddress), true, []string{base.String()}, []string{enterprise.String(), scriptStake.String()}},
+		{"StakeScriptAddress", hex.EncodeToString(stakeScriptAddress), true, []string{scriptStake.String()}, []string{base.String()}},
+		{"StakeAddressOtherNetwork", encodeBech32("stake", append([]byte{0xe1}, stake[:]...)), false, nil, nil},
+		{"NotStakeAddress", hex.EncodeToString(append([]byte{0x60}, stake[:]...)), false, nil, nil},
+		{"ShortKeyHash", encodeBech32("addr_vkh", payment[:20]), false, nil, nil},
+		{"BadChecksum", encodeBech32("addr_vkh", payment[:])[:10] + strings.Repeat("q", 48), false, nil, nil},
+		{"UnknownPrefix", encodeBech32("pool", payment[:]), false, nil, nil},
+		{"MainnetAddress", encodeBech32("addr", append([]byte{0x61}, payment[:]...)), false, nil, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := ParseAddressQuery(tc.query, AddressNetwork{common.AddressNetworkTestnet, 1})
+			if !tc.ok {
+				if err == nil {
+					t.Fatalf("expected %s to be rejected", tc.query)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, addr := range tc.matches {
+				if !query.Matches(addr) {
+					t.Errorf("expected %s to match", addr)
+				}
+			}
+
+			for _, addr := range tc.others {
+				if query.Matches(addr) {
+					t.Errorf("expected %s not to match", addr)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	_, enterprise := newValidatorTestKey(1)
+	payment := enterprise.PaymentKeyHash()
+
+	encodeBech32 := func(hrp string, data ...[]byte) string {
+		conv, err := bech32.ConvertBits(bytes.Join(data, nil), 8, 5, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := bech32.Encode(hrp, conv)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+
+	byron := func(magic *uint32) string {
+		addr, err := common.NewByronAddressFromParts(common.ByronAddressTypePubkey, payment[:], common.ByronAddressAttributes{Network: magic})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return addr.String()
+	}
+
+	preprodMagic := uint32(1)
+	otherMagic := uint32(2)
+
+	preprod := AddressNetwork{common.AddressNetworkTestnet, preprodMagic}
+	mainnet := AddressNetwork{common.AddressNetworkMainnet, 764824073}
+
+	mainnetByron := byron(nil)
+	corrupted := []byte(mainnetByron)
+	corrupted[len(corrupted)-3] ^= 1
+
+	testCases := []struct {
+		name    string
+		address string
+		network AddressNetwork
+		ok      bool
+	}{
+		{"Enterprise", enterprise.String(), preprod, true},
+		{"Base", encodeBech32("addr_test", []byte{0x00}, payment[:], payment[:]), preprod, true},
+		{"Pointer", encodeBech32("addr_test", []byte{0x40}, payment[:], []byte{0x81, 0x00, 0x02, 0x03}), preprod, true},
+		{"PointerTruncated", encodeBech32("addr_test", []byte{0x40}, payment[:], []byte{0x81, 0x00, 0x82}), preprod, false},
+		{"Mainnet", encodeBech32("addr", []byte{0x61}, payment[:]), mainnet, true},
+		{"WrongNetwork", encodeBech32("addr", []byte{0x61}, payment[:]), preprod, false},
+		{"PrefixMismatch", encodeBech32("addr_test", []byte{0x61}, payment[:]), mainnet, false},
+		{"StakeAddress", encodeBech32("stake_test", []byte{0xe0}, payment[:]), preprod, false},
+		{"StakeHeader", encodeBech32("addr_test", []byte{0xe0}, payment[:]), preprod, false},
+		{"Truncated", encodeBech32("addr_test", []byte{0x00}, payment[:]), preprod, false},
+		{"BadChecksum", enterprise.String()[:len(enterprise.String())-1] + "q", preprod, false},
+		{"Empty", "", preprod, false},
+		{"ByronMainnet", mainnetByron, mainnet, true},
+		{"ByronMainnetOnTestnet", mainnetByron, preprod, false},
+		{"ByronTestnet", byron(&preprodMagic), preprod, true},
+		{"ByronOtherTestnet", byron(&otherMagic), preprod, false},
+		{"ByronBadChecksum", string(corrupted), mainnet, false},
+		{"ByronBadBase58", "Ae2tdPwUPEZ0OIl", mainnet, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseAddress(tc.address, tc.network)
+			if tc.ok && err != nil {
+				t.Errorf("expected %s to be valid, got %v", tc.address, err)
+			} else if !tc.ok && err == nil {
+				t.Errorf("expected %s to be rejected", tc.address)
+			}
+		})
+	}
+}
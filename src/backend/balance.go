@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// BalanceValue is an amount of lovelace and assets
+type BalanceValue struct {
+	Lovelace string        `json:"lovelace"`
+	Assets   []PolicyAsset `json:"assets"`
+}
+
+// AddressBalance is returned by GET /api/address/{address}/balance.
+// The confirmed amounts only take into account txs on chain, the effects of mempool txs are reported separately in Pending.
+type AddressBalance struct {
+	Address   string         `json:"address"`
+	Lovelace  string         `json:"lovelace"`
+	Assets    []PolicyAsset  `json:"assets"`
+	UTXOCount int64          `json:"utxoCount"`
+	Sent      BalanceValue   `json:"sent"`     // total value of the spent outputs of the address
+	Received  BalanceValue   `json:"received"` // total value of all the outputs of the address, spent or not
+	TxCount   int64          `json:"txCount"`
+	Pending   PendingBalance `json:"pending"`
+}
+
+// PendingBalance is the effect of mempool txs on the balance, the expected balance is the confirmed balance plus Received minus Sent
+type PendingBalance struct {
+	Sent      BalanceValue `json:"sent"`      // value of the UTXOs of the address spent by mempool txs
+	Received  BalanceValue `json:"received"`  // value of the outputs to the address of mempool txs
+	UTXOCount int          `json:"utxoCount"` // change of the number of UTXOs, negative if more are spent than received
+	TxIDs     []string     `json:"txIDs"`     // mempool txs spending from or sending to the address
+}
+
+// pendingBalance sums the mempool outputs matching the query and the inputs spending from it.
+// resolved contains the UTXOs on chain spent by the mempool txs, keyed by <tx-hash>#<index>, inputs that can't be resolved are ignored.
+func pendingBalance(txs []MempoolTxDetails, resolved map[string]UTXO, query AddressQuery) PendingBalance {
+	// mempool txs can spend each other's outputs
+	produced := make(map[string]UTXO)
+	for _, tx := range txs {
+		for _, u := range tx.Outputs {
+			produced[fmt.Sprintf("%s#%d", u.TxID, u.OutputIndex)] = u
+		}
+	}
+
+	var (
+		sent     []UTXO
+		received []UTXO
+		txIDs    = []string{}
+	)
+
+	for _, tx := range txs {
+		matched := false
+
+		for _, in := range tx.Inputs {
+			u, ok := produced[in]
+			if !ok {
+				u, ok = resolved[in]
+			}
+
+			if ok && query.Matches(u.Address) {
+				sent = append(sent, u)
+				matched = true
+			}
+		}
+
+		for _, u := range tx.Outputs {
+			if query.Matches(u.Address) {
+				received = append(received, u)
+				matched = true
+			}
+		}
+
+		if matched {
+			txIDs = append(txIDs, tx.TxID)
+		}
+	}
+
+	var res PendingBalance
+
+	res.Sent.Lovelace, res.Sent.Assets = sumUTXOs(sent)
+	res.Received.Lovelace, res.Received.Assets = sumUTXOs(received)
+	res.UTXOCount = len(received) - len(sent)
+	res.TxIDs = txIDs
+
+	return res
+}
+
+// resolves the inputs of the mempool txs that aren't outputs of other mempool txs, in a single query
+func (h *Handler) resolveMempoolInputs(ctx context.Context, txs []MempoolTxDetails) (map[string]UTXO, error) {
+	produced := make(map[string]struct{})
+	for _, tx := range txs {
+		for _, u := range tx.Outputs {
+			produced[fmt.Sprintf("%s#%d", u.TxID, u.OutputIndex)] = struct{}{}
+		}
+	}
+
+	refs := []UTXORef{}
+	for _, tx := range txs {
+		for _, in := range tx.Inputs {
+			if _, ok := produced[in]; ok {
+				continue
+			}
+
+			txID, indexStr, _ := strings.Cut(in, "#")
+
+			txHash, err := hex.DecodeString(txID)
+			if err != nil {
+				return nil, err
+			}
+
+			index, err := strconv.Atoi(indexStr)
+			if err != nil {
+				return nil, err
+			}
+
+			refs = append(refs, UTXORef{txHash, index})
+		}
+	}
+
+	resolved := make(map[string]UTXO)
+	if len(refs) == 0 {
+		return resolved, nil
+	}
+
+	utxos, err := h.db.QueryUTXOs(nil, nil, nil, refs, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range utxos {
+		resolved[fmt.Sprintf("%s#%d", u.TxID, u.OutputIndex)] = u
+	}
+
+	return resolved, nil
+}
+
+// read query
+func (h *Handler) addressBalance(w http.ResponseWriter, r *http.Request, addr string, query AddressQuery, url URLHelper) {
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	} else if r.Method != http.MethodGet {
+		invalidMethod(w, r)
+		return
+	}
+
+	if query.StakeAddress != nil {
+		http.Error(w, "the balance can only be queried for an address or a payment credential, not for a stake address", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	balance, err := h.db.AddressBalance(query.Address, query.PaymentCred, r.Context())
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	h.mempool.prune()
+
+	txs := h.mempool.AllDetails()
+
+	resolved, err := h.resolveMempoolInputs(r.Context(), txs)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	balance.Address = addr
+	balance.Pending = pendingBalance(txs, resolved, query)
+
+	respondWithJSON(w, balance)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPendingBalance(t *testing.T) {
+	_, addr := newValidatorTestKey(1)
+	_, other := newValidatorTestKey(2)
+
+	hash := addr.PaymentKeyHash()
+	asset := strings.Repeat("cc", 28) + "4e4654"
+
+	chainTx := strings.Repeat("aa", 32)
+	firstTx := strings.Repeat("11", 32)
+	secondTx := strings.Repeat("22", 32)
+
+	resolved := map[string]UTXO{
+		chainTx + "#0": {TxID: chainTx, OutputIndex: 0, Address: addr.String(), Lovelace: "5000000", Assets: []PolicyAsset{{asset, "1"}}},
+		chainTx + "#1": {TxID: chainTx, OutputIndex: 1, Address: other.String(), Lovelace: "7000000"},
+	}
+
+	// first spends a UTXO of addr and sends the NFT to other, second spends the change of first
+	first := MempoolTxDetails{
+		TxID:   firstTx,
+		Inputs: []string{chainTx + "#0"},
+		Outputs: []UTXO{
+			{TxID: firstTx, OutputIndex: 0, Address: other.String(), Lovelace: "1500000", Assets: []PolicyAsset{{asset, "1"}}},
+			{TxID: firstTx, OutputIndex: 1, Address: addr.String(), Lovelace: "3300000"},
+		},
+	}
+
+	second := MempoolTxDetails{
+		TxID:   secondTx,
+		Inputs: []string{firstTx + "#1", chainTx + "#1"},
+		Outputs: []UTXO{
+			{TxID: secondTx, OutputIndex: 0, Address: addr.String(), Lovelace: "10000000"},
+		},
+	}
+
+	unrelated := MempoolTxDetails{
+		TxID:    strings.Repeat("33", 32),
+		Inputs:  []string{strings.Repeat("bb", 32) + "#0"}, // unresolved
+		Outputs: []UTXO{{TxID: strings.Repeat("33", 32), OutputIndex: 0, Address: other.String(), Lovelace: "2000000"}},
+	}
+
+	value := func(lovelace string, assets ...PolicyAsset) BalanceValue {
+		return BalanceValue{lovelace, append([]PolicyAsset{}, assets...)}
+	}
+
+	testCases := []struct {
+		name     string
+		query    AddressQuery
+		txs      []MempoolTxDetails
+		expected PendingBalance
+	}{
+		{"Empty", AddressQuery{Address: addr.String()}, nil, PendingBalance{value("0"), value("0"), 0, []string{}}},
+		{"Unrelated", AddressQuery{Address: addr.String()}, []MempoolTxDetails{unrelated}, PendingBalance{value("0"), value("0"), 0, []string{}}},
+		{
+			"Spend",
+			AddressQuery{Address: addr.String()},
+			[]MempoolTxDetails{first, unrelated},
+			PendingBalance{value("5000000", PolicyAsset{asset, "1"}), value("3300000"), 0, []string{firstTx}},
+		},
+		{
+			"Chained",
+			AddressQuery{Address: addr.String()},
+			[]MempoolTxDetails{first, second},
+			PendingBalance{value("8300000", PolicyAsset{asset, "1"}), value("13300000"), 0, []string{firstTx, secondTx}},
+		},
+		{
+			"PaymentCredential",
+			AddressQuery{PaymentCred: hash[:]},
+			[]MempoolTxDetails{second},
+			PendingBalance{value("0"), value("10000000"), 1, []string{secondTx}},
+		},
+		{
+			"Receiver",
+			AddressQuery{Address: other.String()},
+			[]MempoolTxDetails{first, second, unrelated},
+			PendingBalance{value("7000000"), value("3500000", PolicyAsset{asset, "1"}), 1, []string{firstTx, secondTx, unrelated.TxID}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := pendingBalance(tc.txs, resolved, tc.query)
+			if !reflect.DeepEqual(res, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, res)
+			}
+		})
+	}
+}
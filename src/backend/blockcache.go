@@ -0,0 +1,137 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+)
+
+// decoded blocks take up more memory than their CBOR representation, this factor is a rough estimate of the overhead
+const decodedBlockSizeFactor = 3
+
+// BlockCache keeps recently used decoded blocks in memory, evicting the least recently used blocks once the memory budget is exceeded.
+// It is shared by the immutable and the volatile store, and is keyed by the hex encoded block hash.
+type BlockCache struct {
+	budget int64 // estimated number of bytes
+	size   int64
+
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	mu sync.Mutex
+}
+
+type blockCacheEntry struct {
+	key   string
+	block ledger.Block
+	size  int64
+}
+
+// BlockCacheStats is returned by the admin API
+type BlockCacheStats struct {
+	Budget    int64   `json:"budget"`
+	Size      int64   `json:"size"`
+	Entries   int     `json:"entries"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	HitRatio  float64 `json:"hitRatio"`
+}
+
+// NewBlockCache creates an empty cache, a budget of 0 disables caching
+func NewBlockCache(budget int64) *BlockCache {
+	return &BlockCache{
+		budget:  budget,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns nil if the block isn't cached
+func (c *BlockCache) Get(blockID string) ledger.Block {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[blockID]
+	if !ok {
+		c.misses++
+		return nil
+	}
+
+	c.hits++
+	c.lru.MoveToFront(elem)
+
+	return elem.Value.(*blockCacheEntry).block
+}
+
+// Add inserts a decoded block, cborSize is the number of bytes the block was decoded from
+func (c *BlockCache) Add(blockID string, b ledger.Block, cborSize int) {
+	if c == nil || c.budget <= 0 {
+		return
+	}
+
+	size := int64(cborSize) * decodedBlockSizeFactor
+	if size > c.budget {
+		return
+	}
+
+	// block and tx hashes are computed lazily, compute them now so concurrent readers of the cached block don't race
+	b.Hash()
+	for _, tx := range b.Transactions() {
+		tx.Hash()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[blockID]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[blockID] = c.lru.PushFront(&blockCacheEntry{blockID, b, size})
+	c.size += size
+
+	for c.size > c.budget {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*blockCacheEntry)
+
+		c.lru.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		c.evictions++
+	}
+}
+
+func (c *BlockCache) Stats() BlockCacheStats {
+	if c == nil {
+		return BlockCacheStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hitRatio := 0.0
+	if total := c.hits + c.misses; total > 0 {
+		hitRatio = float64(c.hits) / float64(total)
+	}
+
+	return BlockCacheStats{
+		Budget:    c.budget,
+		Size:      c.size,
+		Entries:   len(c.entries),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		HitRatio:  hitRatio,
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+)
+
+// only implements the methods used by the cache
+type cachedBlockStub struct {
+	ledger.Block
+}
+
+func (cachedBlockStub) Hash() common.Blake2b256 {
+	return common.Blake2b256{}
+}
+
+func (cachedBlockStub) Transactions() []common.Transaction {
+	return nil
+}
+
+func TestBlockCache(t *testing.T) {
+	// room for exactly two blocks of 100 CBOR bytes
+	cache := NewBlockCache(2 * 100 * decodedBlockSizeFactor)
+
+	for i := range 3 {
+		if i == 2 {
+			// touch block 0 so block 1 becomes the least recently used
+			if cache.Get("0") == nil {
+				t.Fatalf("expected block 0 to be cached")
+			}
+		}
+
+		cache.Add(fmt.Sprintf("%d", i), cachedBlockStub{}, 100)
+	}
+
+	if cache.Get("1") != nil {
+		t.Errorf("expected block 1 to be evicted")
+	}
+
+	if cache.Get("0") == nil || cache.Get("2") == nil {
+		t.Errorf("expected blocks 0 and 2 to be cached")
+	}
+
+	// too big to fit in the budget
+	cache.Add("3", cachedBlockStub{}, 1000)
+	if cache.Get("3") != nil {
+		t.Errorf("expected block 3 not to be cached")
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 3 || stats.Misses != 2 {
+		t.Errorf("unexpected stats %#v", stats)
+	}
+
+	var disabled *BlockCache
+	disabled.Add("0", cachedBlockStub{}, 100)
+	if disabled.Get("0") != nil {
+		t.Errorf("expected nil cache to be empty")
+	}
+}
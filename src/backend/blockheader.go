@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/allegra"
+	"github.com/blinklabs-io/gouroboros/ledger/alonzo"
+	"github.com/blinklabs-io/gouroboros/ledger/babbage"
+	"github.com/blinklabs-io/gouroboros/ledger/byron"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/conway"
+	"github.com/blinklabs-io/gouroboros/ledger/mary"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+// BlockHeaderView is the JSON representation of a block header, fields that don't exist in the era of the block are omitted
+type BlockHeaderView struct {
+	Hash      string `json:"hash"`
+	PrevHash  string `json:"prevHash"`
+	Era       string `json:"era"`
+	BlockType int    `json:"blockType"`
+	Slot      uint64 `json:"slot"`
+	Height    uint64 `json:"height"`
+	TxCount   int    `json:"txCount"`
+
+	// Byron only
+	IsEBB         bool    `json:"isEBB,omitempty"`
+	Epoch         *uint64 `json:"epoch,omitempty"`
+	SlotInEpoch   *uint64 `json:"slotInEpoch,omitempty"`
+	ProtocolMagic *uint32 `json:"protocolMagic,omitempty"`
+
+	// Byron headers don't contain the body size
+	BodySize *uint64 `json:"bodySize,omitempty"`
+	BodyHash string  `json:"bodyHash,omitempty"`
+
+	IssuerVkey string `json:"issuerVkey,omitempty"`
+	PoolID     string `json:"poolID,omitempty"`
+	VrfVkey    string `json:"vrfVkey,omitempty"`
+
+	VrfResult *BlockHeaderVrf `json:"vrfResult,omitempty"` // Babbage and later
+	NonceVrf  *BlockHeaderVrf `json:"nonceVrf,omitempty"`  // Shelley to Alonzo
+	LeaderVrf *BlockHeaderVrf `json:"leaderVrf,omitempty"` // Shelley to Alonzo
+
+	OpCert          *BlockHeaderOpCert          `json:"opCert,omitempty"`
+	ProtocolVersion *BlockHeaderProtocolVersion `json:"protocolVersion,omitempty"`
+	SoftwareVersion *BlockHeaderSoftwareVersion `json:"softwareVersion,omitempty"` // Byron main blocks only
+}
+
+type BlockHeaderVrf struct {
+	Output string `json:"output"`
+	Proof  string `json:"proof"`
+}
+
+// operational certificate, which links the KES key used to sign the header to the pool's cold key
+type BlockHeaderOpCert struct {
+	HotVkey        string `json:"hotVkey"`
+	SequenceNumber uint32 `json:"sequenceNumber"`
+	KesPeriod      uint32 `json:"kesPeriod"`
+	Signature      string `json:"signature"`
+}
+
+type BlockHeaderProtocolVersion struct {
+	Major uint64 `json:"major"`
+	Minor uint64 `json:"minor"`
+}
+
+type BlockHeaderSoftwareVersion struct {
+	Name    string `json:"name"`
+	Version uint32 `json:"version"`
+}
+
+// NewBlockHeaderView extracts the header fields of all the block types handled by decodeBlock
+func NewBlockHeaderView(b ledger.Block) (BlockHeaderView, error) {
+	hash := b.Hash()
+	prevHash := b.PrevHash()
+
+	v := BlockHeaderView{
+		Hash:      hex.EncodeToString(hash[:]),
+		PrevHash:  hex.EncodeToString(prevHash[:]),
+		Era:       b.Era().Name,
+		BlockType: b.Type(),
+		Slot:      b.SlotNumber(),
+		Height:    b.BlockNumber(),
+		TxCount:   len(b.Transactions()),
+	}
+
+	switch h := b.Header().(type) {
+	case *byron.ByronEpochBoundaryBlockHeader:
+		epoch := h.ConsensusData.Epoch
+		v.IsEBB = true
+		v.Epoch = &epoch
+		v.ProtocolMagic = &h.ProtocolMagic
+	case *byron.ByronMainBlockHeader:
+		epoch := h.ConsensusData.SlotId.Epoch
+		slotInEpoch := uint64(h.ConsensusData.SlotId.Slot)
+		v.Epoch = &epoch
+		v.SlotInEpoch = &slotInEpoch
+		v.ProtocolMagic = &h.ProtocolMagic
+
+		// Byron issuer keys are extended keys (public key + chain code), so they are returned as is
+		v.IssuerVkey = hex.EncodeToString(h.ConsensusData.PubKey)
+
+		v.ProtocolVersion = &BlockHeaderProtocolVersion{
+			Major: uint64(h.ExtraData.BlockVersion.Major),
+			Minor: uint64(h.ExtraData.BlockVersion.Minor),
+		}
+		v.SoftwareVersion = &BlockHeaderSoftwareVersion{
+			Name:    h.ExtraData.SoftwareVersion.Name,
+			Version: h.ExtraData.SoftwareVersion.Version,
+		}
+	case *shelley.ShelleyBlockHeader:
+		v.setShelleyFields(&h.Body)
+	case *allegra.AllegraBlockHeader:
+		v.setShelleyFields(&h.Body)
+	case *mary.MaryBlockHeader:
+		v.setShelleyFields(&h.Body)
+	case *alonzo.AlonzoBlockHeader:
+		v.setShelleyFields(&h.Body)
+	case *babbage.BabbageBlockHeader:
+		v.setBabbageFields(&h.Body)
+	case *conway.ConwayBlockHeader:
+		v.setBabbageFields(&h.Body)
+	default:
+		return BlockHeaderView{}, fmt.Errorf("unhandled block header type %T", h)
+	}
+
+	return v, nil
+}
+
+func (v *BlockHeaderView) setShelleyFields(body *shelley.ShelleyBlockHeaderBody) {
+	v.setIssuer(body.IssuerVkey)
+	v.setBody(body.BlockBodySize, body.BlockBodyHash)
+
+	v.VrfVkey = hex.EncodeToString(body.VrfKey)
+	v.NonceVrf = newBlockHeaderVrf(body.NonceVrf)
+	v.LeaderVrf = newBlockHeaderVrf(body.LeaderVrf)
+
+	v.OpCert = &BlockHeaderOpCert{
+		HotVkey:        hex.EncodeToString(body.OpCertHotVkey),
+		SequenceNumber: body.OpCertSequenceNumber,
+		KesPeriod:      body.OpCertKesPeriod,
+		Signature:      hex.EncodeToString(body.OpCertSignature),
+	}
+
+	v.ProtocolVersion = &BlockHeaderProtocolVersion{
+		Major: body.ProtoMajorVersion,
+		Minor: body.ProtoMinorVersion,
+	}
+}
+
+func (v *BlockHeaderView) setBabbageFields(body *babbage.BabbageBlockHeaderBody) {
+	v.setIssuer(body.IssuerVkey)
+	v.setBody(body.BlockBodySize, body.BlockBodyHash)
+
+	v.VrfVkey = hex.EncodeToString(body.VrfKey)
+	v.VrfResult = newBlockHeaderVrf(body.VrfResult)
+
+	v.OpCert = &BlockHeaderOpCert{
+		HotVkey:        hex.EncodeToString(body.OpCert.HotVkey),
+		SequenceNumber: body.OpCert.SequenceNumber,
+		KesPeriod:      body.OpCert.KesPeriod,
+		Signature:      hex.EncodeToString(body.OpCert.Signature),
+	}
+
+	v.ProtocolVersion = &BlockHeaderProtocolVersion{
+		Major: body.ProtoVersion.Major,
+		Minor: body.ProtoVersion.Minor,
+	}
+}
+
+func (v *BlockHeaderView) setIssuer(vkey common.IssuerVkey) {
+	v.IssuerVkey = hex.EncodeToString(vkey[:])
+	v.PoolID = vkey.PoolId()
+}
+
+func (v *BlockHeaderView) setBody(size uint64, hash common.Blake2b256) {
+	v.BodySize = &size
+	v.BodyHash = hex.EncodeToString(hash[:])
+}
+
+func newBlockHeaderVrf(r common.VrfResult) *BlockHeaderVrf {
+	return &BlockHeaderVrf{
+		Output: hex.EncodeToString(r.Output),
+		Proof:  hex.EncodeToString(r.Proof),
+	}
+}
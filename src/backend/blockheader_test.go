@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/babbage"
+	"github.com/blinklabs-io/gouroboros/ledger/byron"
+	"github.com/blinklabs-io/gouroboros/ledger/conway"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+func TestNewBlockHeaderView(t *testing.T) {
+	ebbHeader := &byron.ByronEpochBoundaryBlockHeader{ProtocolMagic: 764824073}
+	ebbHeader.ConsensusData.Epoch = 3
+
+	byronHeader := &byron.ByronMainBlockHeader{}
+	byronHeader.ConsensusData.SlotId.Epoch = 3
+	byronHeader.ConsensusData.SlotId.Slot = 10
+	byronHeader.ConsensusData.PubKey = []byte{0xab}
+	byronHeader.ExtraData.BlockVersion.Major = 1
+
+	shelleyHeader := &shelley.ShelleyBlockHeader{
+		Body: shelley.ShelleyBlockHeaderBody{
+			BlockNumber:       5,
+			Slot:              4492800,
+			BlockBodySize:     1024,
+			OpCertKesPeriod:   7,
+			ProtoMajorVersion: 2,
+		},
+	}
+
+	conwayHeader := &conway.ConwayBlockHeader{
+		BabbageBlockHeader: babbage.BabbageBlockHeader{
+			Body: babbage.BabbageBlockHeaderBody{
+				BlockNumber:   6,
+				Slot:          134000000,
+				BlockBodySize: 2048,
+				OpCert:        babbage.BabbageOpCert{SequenceNumber: 9},
+				ProtoVersion:  babbage.BabbageProtoVersion{Major: 10},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name  string
+		block ledger.Block
+		check func(v BlockHeaderView) bool
+	}{
+		{
+			"ByronEBB",
+			&byron.ByronEpochBoundaryBlock{BlockHeader: ebbHeader},
+			func(v BlockHeaderView) bool {
+				return v.IsEBB && *v.Epoch == 3 && v.Slot == 3*byron.ByronSlotsPerEpoch && v.BodySize == nil && v.IssuerVkey == "" && v.OpCert == nil
+			},
+		},
+		{
+			"ByronMain",
+			&byron.ByronMainBlock{BlockHeader: byronHeader},
+			func(v BlockHeaderView) bool {
+				return !v.IsEBB && *v.Epoch == 3 && *v.SlotInEpoch == 10 && v.IssuerVkey == "ab" && v.ProtocolVersion.Major == 1 && v.PoolID == ""
+			},
+		},
+		{
+			"Shelley",
+			&shelley.ShelleyBlock{BlockHeader: shelleyHeader},
+			func(v BlockHeaderView) bool {
+				return v.Era == "Shelley" && v.Height == 5 && *v.BodySize == 1024 && v.OpCert.KesPeriod == 7 && v.LeaderVrf != nil && v.VrfResult == nil && v.ProtocolVersion.Major == 2 && v.PoolID != ""
+			},
+		},
+		{
+			"Conway",
+			&conway.ConwayBlock{BlockHeader: conwayHeader},
+			func(v BlockHeaderView) bool {
+				return v.Era == "Conway" && v.Slot == 134000000 && *v.BodySize == 2048 && v.OpCert.SequenceNumber == 9 && v.VrfResult != nil && v.LeaderVrf == nil && v.ProtocolVersion.Major == 10
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewBlockHeaderView(tc.block)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tc.check(v) {
+				t.Errorf("unexpected header view %#v", v)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"unicode/utf8"
 
 	"github.com/blinklabs-io/gouroboros/ledger"
@@ -258,12 +259,20 @@ func EncodeMap(pairs []EncodedPair) []byte {
 }
 
 func EncodeObjectIKey(fields map[int][]byte) []byte {
+	keys := make([]int, 0, len(fields))
+	for i := range fields {
+		keys = append(keys, i)
+	}
+
+	// sorted so that the encoding is deterministic
+	sort.Ints(keys)
+
 	pairs := []EncodedPair{}
 
-	for i, f := range fields {
+	for _, i := range keys {
 		pairs = append(pairs, EncodedPair{
 			Key:   EncodeInt(int64(i)),
-			Value: f,
+			Value: fields[i],
 		})
 	}
 
@@ -1265,7 +1274,34 @@ func decodeString(s *Stream) (*DecodedString, error) {
 }
 
 func (s *DecodedString) Cbor() []byte {
-	panic("not yet implemented")
+	switch s.Type {
+	case "single":
+		return encodeString(s.Value)
+	case "list":
+		// the original chunk boundaries aren't kept, split into chunks of at most 64 bytes without splitting runes
+		chunks := make([][]byte, 0)
+		str := s.Value
+
+		for len(str) > 64 {
+			n := 64
+			for !utf8.RuneStart(str[n]) {
+				n--
+			}
+
+			chunks = append(chunks, encodeString(str[:n]))
+			str = str[n:]
+		}
+
+		chunks = append(chunks, encodeString(str))
+
+		return EncodeDefList(chunks)
+	default:
+		panic("unhandled DecodedString.Type")
+	}
+}
+
+func encodeString(str string) []byte {
+	return append(encodeDefHead(3, big.NewInt(int64(len(str)))), []byte(str)...)
 }
 
 func decodeStringInternal(s *Stream) (string, error) {
@@ -133,6 +133,10 @@ func TestDecodeCbor(t *testing.T) {
 			name: "basic UTXO",
 			cbor: "84a500d901028182582098c8f9429ebf08e16cc77a1cb50c564f7d75c49d036d32c5ada4c4552ca7942201018382581d601cf478b0e8b0c2ba179dc0ddfadcca4fb9e149244dcfc7813fc5bbcb1a00989680825839003a5904074323a4cddfe1103969962a5807c6c37495db9df48d019f9a5a0987ee3ec775d90cb16851a5f3cc9d8b03bd6492329e89368442291b0000000251cce8e3825839003a5904074323a4cddfe1103969962a5807c6c37495db9df48d019f9a5a0987ee3ec775d90cb16851a5f3cc9d8b03bd6492329e89368442291a004c4b40021a00029939031a05ae1d580801a100d90102818258202e44aa608940b750a7369b15f3830c067b3149450937b3020a9a674329c4d79d584025de808e1190cebf8370dbb76b49bf96feec109e180a74eb07cefd13c01261af6c4eb0ab584f94957fcef1ca22b3b57b0c9289b1e2d7533d732a81587a82ee06f5f6",
 		},
+		{
+			name: "text string",
+			cbor: "a10063616263",
+		},
 		{
 			name: "basic tx",
 			cbor: "84ab00838258205561b1849ca0725f25febcfabe496607ad9acaf856ef584c0d61f3d0f985833e008258205561b1849ca0725f25febcfabe496607ad9acaf856ef584c0d61f3d0f985833e02825820b1bbbbcf999728c6c515a2900bac401b8449fae23d9cfd06caa2f48177fb16b9010183a300581d706398de8bd177d8f84c8f87d2f0d19c16b7a638fc01db3ba257cf721901821a001e8480a1581c1791a1daaaa529d486a6681a9503301c17e1901b67dd3b6c686f51b0a1484e6f64654665656401028201d818583cd87a9fd8799f581c1ba65a0886f021ef293646bf903f733139c72b9341b19b578346612ed8799fd8799f1a000234121b00000197ae907af3ffffffff82581d601ba65a0886f021ef293646bf903f733139c72b9341b19b578346612e1a0089544082581d601ba65a0886f021ef293646bf903f733139c72b9341b19b578346612e1a007a2994021a000793f4031a05ae1f27081a05ae1eaf0b5820bccf2d628e3df2f5397eb9dca0490681478070340b07a695298ae90f47f8b4cc0d818258205561b1849ca0725f25febcfabe496607ad9acaf856ef584c0d61f3d0f985833e020e81581c1ba65a0886f021ef293646bf903f733139c72b9341b19b578346612e1082581d601ba65a0886f021ef293646bf903f733139c72b9341b19b578346612e1a004ab149111a00370c3f12818258207ca10f331a500d5352f48a32aff29eaab445e23d1ed2db59b0631eb6cc3ecdc800a200818258209a843ee906ddaa30ae99f6041db5f66f2af23a34d16fc95f20f8685da7d14ff85840953c2d958f44f567e33dd9209a3c39590fac59ac99d3e174a3763a166d942c1fb52238e9339aa5cd025ad2d41ce96395dcf75a70358514ed34d3b144bf01fe0f05a182000082d87980821a0011ef051a0fd6d27ef5f6",
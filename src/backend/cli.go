@@ -165,14 +165,44 @@ type CardanoCollateralInfo struct {
 	Provided int64 `json:"provided"`
 }
 
+// CardanoSizeMismatch is returned when a size or count exceeds its protocol limit.
+type CardanoSizeMismatch struct {
+	Supplied int `json:"supplied"`
+	Expected int `json:"expected"`
+}
+
+// CardanoValidityInterval is returned when the current slot is outside the validity interval of a tx.
+type CardanoValidityInterval struct {
+	InvalidBefore    uint64 `json:"invalidBefore,omitempty"`
+	InvalidHereafter uint64 `json:"invalidHereafter,omitempty"`
+	Slot             uint64 `json:"slot"`
+}
+
+// CardanoTxOutTooSmall describes an output that doesn't contain the minimum lovelace.
+type CardanoTxOutTooSmall struct {
+	Index       int    `json:"index"`
+	Lovelace    uint64 `json:"lovelace"`
+	MinLovelace uint64 `json:"minLovelace"`
+}
+
 // CardanoCLITxSubmitError represents a parsed transaction submission error.
 type CardanoCLITxSubmitError struct {
-	Raw                    string                 `json:"raw"`
-	BadInputs              []CardanoTxIn          `json:"badInputs,omitempty"`
-	MissingInputs          []CardanoTxIn          `json:"missingInputs,omitempty"`
-	ValueMismatch          *CardanoValueMismatch  `json:"valueMismatch,omitempty"`
-	InsufficientCollateral *CardanoCollateralInfo `json:"insufficientCollateral,omitempty"`
-	NoCollateralInputs     bool                   `json:"noCollateralInputs,omitempty"`
+	Raw                      string                   `json:"raw"`
+	BadInputs                []CardanoTxIn            `json:"badInputs,omitempty"`
+	MissingInputs            []CardanoTxIn            `json:"missingInputs,omitempty"`
+	ValueMismatch            *CardanoValueMismatch    `json:"valueMismatch,omitempty"`
+	InsufficientCollateral   *CardanoCollateralInfo   `json:"insufficientCollateral,omitempty"`
+	NoCollateralInputs       bool                     `json:"noCollateralInputs,omitempty"`
+	TxTooLarge               *CardanoSizeMismatch     `json:"txTooLarge,omitempty"`
+	FeeTooSmall              *CardanoValueMismatch    `json:"feeTooSmall,omitempty"`
+	OutsideValidityInterval  *CardanoValidityInterval `json:"outsideValidityInterval,omitempty"`
+	OutputsTooSmall          []CardanoTxOutTooSmall   `json:"outputsTooSmall,omitempty"`
+	TooManyCollateralInputs  *CardanoSizeMismatch     `json:"tooManyCollateralInputs,omitempty"`
+	CollateralContainsNonADA bool                     `json:"collateralContainsNonADA,omitempty"`
+	ScriptCollateral         []CardanoTxIn            `json:"scriptCollateral,omitempty"`
+	IncorrectTotalCollateral *CardanoValueMismatch    `json:"incorrectTotalCollateral,omitempty"`
+	MissingSigners           []string                 `json:"missingSigners,omitempty"`   // key hashes
+	InvalidWitnesses         []string                 `json:"invalidWitnesses,omitempty"` // verification keys
 }
 
 func (c *CardanoCLI) Tip() (CardanoCLITip, error) {
@@ -296,7 +326,7 @@ func (c *CardanoCLI) invoke(args ...string) (string, error) {
 		args = append(args, "--testnet-magic", "1")
 	}
 
-	args = append(args, "--socket-path", "/run/cardano-node/node.socket")
+	args = append(args, "--socket-path", NodeSocketPath)
 
 	cmd := exec.Command("cardano-cli", args...)
 
@@ -347,6 +377,36 @@ func ParseTxSubmitError(msg string) CardanoCLITxSubmitError {
 		}
 	}
 
+	reFee := regexp.MustCompile(`FeeTooSmallUTxO \(Mismatch {mismatchSupplied = Coin ([0-9]+), mismatchExpected = Coin ([0-9]+)}\)`)
+	if m := reFee.FindStringSubmatch(msg); m != nil {
+		supplied, _ := strconv.ParseInt(m[1], 10, 64)
+		expected, _ := strconv.ParseInt(m[2], 10, 64)
+		res.FeeTooSmall = &CardanoValueMismatch{Supplied: supplied, Expected: expected}
+	}
+
+	reSize := regexp.MustCompile(`MaxTxSizeUTxO \(Mismatch {mismatchSupplied = ([0-9]+), mismatchExpected = ([0-9]+)}\)`)
+	if m := reSize.FindStringSubmatch(msg); m != nil {
+		supplied, _ := strconv.Atoi(m[1])
+		expected, _ := strconv.Atoi(m[2])
+		res.TxTooLarge = &CardanoSizeMismatch{Supplied: supplied, Expected: expected}
+	}
+
+	reInterval := regexp.MustCompile(`OutsideValidityIntervalUTxO \(ValidityInterval {invalidBefore = (?:SJust \(SlotNo ([0-9]+)\)|SNothing), invalidHereafter = (?:SJust \(SlotNo ([0-9]+)\)|SNothing)}\) \(SlotNo ([0-9]+)\)`)
+	if m := reInterval.FindStringSubmatch(msg); m != nil {
+		before, _ := strconv.ParseUint(m[1], 10, 64)
+		hereafter, _ := strconv.ParseUint(m[2], 10, 64)
+		slot, _ := strconv.ParseUint(m[3], 10, 64)
+		res.OutsideValidityInterval = &CardanoValidityInterval{InvalidBefore: before, InvalidHereafter: hereafter, Slot: slot}
+	}
+
+	reMissingSigners := regexp.MustCompile(`MissingVKeyWitnessesUTXOW \(fromList \[(.*?)\]\)`)
+	if m := reMissingSigners.FindStringSubmatch(msg); m != nil {
+		reKeyHash := regexp.MustCompile(`KeyHash {unKeyHash = \"([0-9a-f]+)\"}`)
+		for _, km := range reKeyHash.FindAllStringSubmatch(m[1], -1) {
+			res.MissingSigners = append(res.MissingSigners, km[1])
+		}
+	}
+
 	reMissing := regexp.MustCompile(`TranslationLogicMissingInput \(TxIn \(TxId {unTxId = SafeHash \"([0-9a-f]+)\"}\) \(TxIx {unTxIx = ([0-9]+)}\)\)`)
 	if m := reMissing.FindStringSubmatch(msg); m != nil {
 		idx, _ := strconv.Atoi(m[2])
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -68,6 +69,24 @@ func TestParseTxSubmitError(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:   "fee too small + expired + missing signer",
+			errStr: "ShelleyTxValidationError ShelleyBasedEraConway (ApplyTxError (ConwayUtxowFailure (MissingVKeyWitnessesUTXOW (fromList [KeyHash {unKeyHash = \"2ab98a3e4d0b1c5f8e2bfa9c2a0e1e7d56a2e4a3b1f0a8cda2e5e9f1\"}])) :| [ConwayUtxowFailure (UtxoFailure (FeeTooSmallUTxO (Mismatch {mismatchSupplied = Coin 100000, mismatchExpected = Coin 168405}))),ConwayUtxowFailure (UtxoFailure (OutsideValidityIntervalUTxO (ValidityInterval {invalidBefore = SNothing, invalidHereafter = SJust (SlotNo 1000)}) (SlotNo 1500))),ConwayUtxowFailure (UtxoFailure (MaxTxSizeUTxO (Mismatch {mismatchSupplied = 17000, mismatchExpected = 16384})))]))",
+			check: func(t *testing.T, e CardanoCLITxSubmitError) {
+				if e.FeeTooSmall == nil || e.FeeTooSmall.Supplied != 100000 || e.FeeTooSmall.Expected != 168405 {
+					t.Fatalf("fee too small not parsed correctly: %#v", e.FeeTooSmall)
+				}
+				if e.OutsideValidityInterval == nil || e.OutsideValidityInterval.InvalidBefore != 0 || e.OutsideValidityInterval.InvalidHereafter != 1000 || e.OutsideValidityInterval.Slot != 1500 {
+					t.Fatalf("validity interval not parsed correctly: %#v", e.OutsideValidityInterval)
+				}
+				if e.TxTooLarge == nil || e.TxTooLarge.Supplied != 17000 || e.TxTooLarge.Expected != 16384 {
+					t.Fatalf("tx size not parsed correctly: %#v", e.TxTooLarge)
+				}
+				if len(e.MissingSigners) != 1 || e.MissingSigners[0] != "2ab98a3e4d0b1c5f8e2bfa9c2a0e1e7d56a2e4a3b1f0a8cda2e5e9f1" {
+					t.Fatalf("missing signers not parsed correctly: %#v", e.MissingSigners)
+				}
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -77,3 +96,23 @@ func TestParseTxSubmitError(t *testing.T) {
 		})
 	}
 }
+
+func TestIsNodeRejection(t *testing.T) {
+	tests := []struct {
+		name     string
+		errStr   string
+		expected bool
+	}{
+		{"FeeTooSmall", "command failed: exit status 1, ShelleyTxValidationError ShelleyBasedEraConway (ApplyTxError (ConwayUtxowFailure (UtxoFailure (FeeTooSmallUTxO (Mismatch {mismatchSupplied = Coin 100000, mismatchExpected = Coin 168405})))))", true},
+		{"MissingInput", "command failed: exit status 1, ShelleyTxValidationError ShelleyBasedEraConway (ApplyTxError (ConwayUtxowFailure (UtxoFailure (UtxosFailure (CollectErrors [BadTranslation (BabbageContextError (AlonzoContextError (TranslationLogicMissingInput (TxIn (TxId {unTxId = SafeHash \"82e7dc25de3699cb0cfd3e55c4115ac8c23ffd18471645ca6d2832cdb1be65f0\"}) (TxIx {unTxIx = 1})))))])))))", false},
+		{"NodeUnreachable", "command failed: exit status 1, Network.Socket.connect: <socket: 11>: does not exist (No such file or directory)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := isNodeRejection(errors.New(tt.errStr)); res != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+)
+
+const (
+	coinSelectionLargestFirst  = "largest-first"
+	coinSelectionSmallestFirst = "smallest-first"
+	coinSelectionRandomImprove = "random-improve"
+)
+
+// CoinSelectionOptions configures SelectCoins
+type CoinSelectionOptions struct {
+	Algorithm     string // one of largest-first, smallest-first or random-improve
+	MaxInputs     int    // 0 means no limit
+	ChangeAddress string // used to check that the change output contains enough lovelace
+	Params        CardanoCLIParameters
+	Rand          *rand.Rand // defaults to a randomly seeded source
+}
+
+// CoinSelectionError is returned if the target can't be reached with the available UTXOs
+type CoinSelectionError struct {
+	Message string
+}
+
+func (e *CoinSelectionError) Error() string {
+	return e.Message
+}
+
+func newCoinSelectionError(format string, args ...any) *CoinSelectionError {
+	return &CoinSelectionError{fmt.Sprintf(format, args...)}
+}
+
+// a UTXO with its value parsed once
+type coinSelectionCandidate struct {
+	utxo  UTXO
+	value txValue
+}
+
+type coinSelection struct {
+	target    txValue
+	opts      CoinSelectionOptions
+	remaining []coinSelectionCandidate
+	selected  []UTXO
+	total     txValue
+}
+
+// SelectCoins selects UTXOs covering the target value, and returns them together with the algorithm that was actually used.
+// UTXOs with datums or reference scripts are never selected. The value exceeding the target must fit in a change output to the change address.
+// Random-improve (CIP-2) falls back to largest-first when it can't reach the target, for example because of the max number of inputs.
+func SelectCoins(utxos []UTXO, target txValue, opts CoinSelectionOptions) ([]UTXO, string, error) {
+	candidates := make([]coinSelectionCandidate, 0, len(utxos))
+	for _, u := range utxos {
+		if u.DatumHash != "" || u.InlineDatum != "" || u.RefScript != "" {
+			continue
+		}
+
+		lovelace, err := strconv.ParseUint(u.Lovelace, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid lovelace %q of UTXO %s#%d", u.Lovelace, u.TxID, u.OutputIndex)
+		}
+
+		value := newTxValue()
+		if err := value.add(lovelace, u.Assets); err != nil {
+			return nil, "", err
+		}
+
+		candidates = append(candidates, coinSelectionCandidate{u, value})
+	}
+
+	if opts.Rand == nil {
+		opts.Rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+
+	switch opts.Algorithm {
+	case coinSelectionLargestFirst, coinSelectionSmallestFirst:
+		s := newCoinSelection(candidates, target, opts)
+		if err := s.selectOrdered(opts.Algorithm == coinSelectionLargestFirst); err != nil {
+			return nil, "", err
+		}
+
+		return s.selected, opts.Algorithm, nil
+	case coinSelectionRandomImprove:
+		s := newCoinSelection(candidates, target, opts)
+		if err := s.selectRandomImprove(); err == nil {
+			return s.selected, opts.Algorithm, nil
+		} else if _, ok := err.(*CoinSelectionError); !ok {
+			return nil, "", err
+		}
+
+		s = newCoinSelection(candidates, target, opts)
+		if err := s.selectOrdered(true); err != nil {
+			return nil, "", err
+		}
+
+		return s.selected, coinSelectionLargestFirst, nil
+	default:
+		return nil, "", fmt.Errorf("unknown coin selection algorithm %q", opts.Algorithm)
+	}
+}
+
+func newCoinSelection(candidates []coinSelectionCandidate, target txValue, opts CoinSelectionOptions) *coinSelection {
+	return &coinSelection{
+		target:    target,
+		opts:      opts,
+		remaining: append([]coinSelectionCandidate{}, candidates...),
+		total:     newTxValue(),
+	}
+}
+
+// returns the assets of the target followed by lovelace (the empty key), assets first because their UTXOs also contain lovelace
+func (s *coinSelection) targetKeys() []string {
+	keys := []string{}
+	for _, asset := range sortedAssetKeys(s.target.assets) {
+		if s.target.assets[asset].Sign() > 0 {
+			keys = append(keys, asset)
+		}
+	}
+
+	return append(keys, "")
+}
+
+// returns the quantity of an asset in a value, or its lovelace if the asset is empty
+func valueQuantity(v txValue, asset string) *big.Int {
+	if asset == "" {
+		return new(big.Int).SetUint64(v.lovelace)
+	}
+
+	if qty, ok := v.assets[asset]; ok {
+		return qty
+	}
+
+	return new(big.Int)
+}
+
+func (s *coinSelection) covered(asset string) bool {
+	return valueQuantity(s.total, asset).Cmp(valueQuantity(s.target, asset)) >= 0
+}
+
+// moves the remaining candidate at index i to the selection
+func (s *coinSelection) take(i int) error {
+	if s.opts.MaxInputs > 0 && len(s.selected) >= s.opts.MaxInputs {
+		return newCoinSelectionError("target can't be reached with at most %d inputs", s.opts.MaxInputs)
+	}
+
+	c := s.remaining[i]
+	s.remaining = append(s.remaining[:i], s.remaining[i+1:]...)
+
+	s.selected = append(s.selected, c.utxo)
+	s.total.lovelace += c.value.lovelace
+	for asset, qty := range c.value.assets {
+		addAssetQuantity(s.total.assets, asset, qty)
+	}
+
+	return nil
+}
+
+// returns the indices of the remaining candidates containing the asset
+func (s *coinSelection) containing(asset string) []int {
+	indices := []int{}
+	for i, c := range s.remaining {
+		if valueQuantity(c.value, asset).Sign() > 0 {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+// selects the remaining candidates containing the asset in order of decreasing or increasing quantity until it is covered
+func (s *coinSelection) selectOrderedAsset(asset string, largestFirst bool) error {
+	for !s.covered(asset) {
+		indices := s.containing(asset)
+		if len(indices) == 0 {
+			return s.insufficient(asset)
+		}
+
+		best := indices[0]
+		for _, i := range indices[1:] {
+			cmp := valueQuantity(s.remaining[i].value, asset).Cmp(valueQuantity(s.remaining[best].value, asset))
+			if (largestFirst && cmp > 0) || (!largestFirst && cmp < 0) {
+				best = i
+			}
+		}
+
+		if err := s.take(best); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *coinSelection) selectOrdered(largestFirst bool) error {
+	for _, asset := range s.targetKeys() {
+		if err := s.selectOrderedAsset(asset, largestFirst); err != nil {
+			return err
+		}
+	}
+
+	return s.balanceChange(func() int {
+		best := 0
+		for i, c := range s.remaining {
+			if (largestFirst && c.value.lovelace > s.remaining[best].value.lovelace) || (!largestFirst && c.value.lovelace < s.remaining[best].value.lovelace) {
+				best = i
+			}
+		}
+
+		return best
+	})
+}
+
+// CIP-2 random-improve: each target is first covered by random UTXOs, then more random UTXOs are added as long as
+// they bring the selected quantity closer to twice the target without exceeding three times the target
+func (s *coinSelection) selectRandomImprove() error {
+	keys := s.targetKeys()
+
+	for _, asset := range keys {
+		for !s.covered(asset) {
+			indices := s.containing(asset)
+			if len(indices) == 0 {
+				return s.insufficient(asset)
+			}
+
+			if err := s.take(indices[s.opts.Rand.IntN(len(indices))]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, asset := range keys {
+		target := valueQuantity(s.target, asset)
+		ideal := new(big.Int).Mul(target, big.NewInt(2))
+		limit := new(big.Int).Mul(target, big.NewInt(3))
+
+		for s.opts.MaxInputs == 0 || len(s.selected) < s.opts.MaxInputs {
+			indices := s.containing(asset)
+			if len(indices) == 0 {
+				break
+			}
+
+			i := indices[s.opts.Rand.IntN(len(indices))]
+
+			current := valueQuantity(s.total, asset)
+			next := new(big.Int).Add(current, valueQuantity(s.remaining[i].value, asset))
+
+			distance := new(big.Int).Abs(new(big.Int).Sub(ideal, current))
+			nextDistance := new(big.Int).Abs(new(big.Int).Sub(ideal, next))
+
+			if nextDistance.Cmp(distance) >= 0 || next.Cmp(limit) > 0 {
+				break
+			}
+
+			if err := s.take(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.balanceChange(func() int {
+		return s.opts.Rand.IntN(len(s.remaining))
+	})
+}
+
+// adds the candidates returned by next until the change output contains enough lovelace for its size
+func (s *coinSelection) balanceChange(next func() int) error {
+	for {
+		ok, err := s.changeValid()
+		if err != nil || ok {
+			return err
+		}
+
+		if len(s.remaining) == 0 {
+			return newCoinSelectionError("not enough lovelace for the change output")
+		}
+
+		if err := s.take(next()); err != nil {
+			return err
+		}
+	}
+}
+
+// returns true if there is no change, or if the change contains at least the min lovelace of its output
+func (s *coinSelection) changeValid() (bool, error) {
+	assets, _ := s.total.assetsExceeding(s.target)
+	lovelace := s.total.lovelace - s.target.lovelace
+
+	if lovelace == 0 && len(assets) == 0 {
+		return true, nil
+	}
+
+	change, err := EncodeTxOutput(s.opts.ChangeAddress, strconv.FormatUint(lovelace, 10), assets, "", "", "")
+	if err != nil {
+		return false, fmt.Errorf("invalid change address: %v", err)
+	}
+
+	decoded, err := ledger.NewTransactionOutputFromCbor(change)
+	if err != nil {
+		return false, err
+	}
+
+	return lovelace >= MinOutputLovelace(s.opts.Params, decoded), nil
+}
+
+func (s *coinSelection) insufficient(asset string) error {
+	name := asset
+	if name == "" {
+		name = "lovelace"
+	}
+
+	return newCoinSelectionError("not enough %s: need %s, selected %s", name, valueQuantity(s.target, asset).String(), valueQuantity(s.total, asset).String())
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestSelectCoins(t *testing.T) {
+	_, addr := newValidatorTestKey(1)
+	params := newValidatorTestParams()
+
+	tokenA := strings.Repeat("aa", 28) + "41"
+	tokenB := strings.Repeat("bb", 28) + "42"
+
+	utxo := func(index int, lovelace string, assets ...PolicyAsset) UTXO {
+		return UTXO{TxID: strings.Repeat("cc", 32), OutputIndex: index, Address: addr.String(), Lovelace: lovelace, Assets: assets}
+	}
+
+	utxos := []UTXO{
+		utxo(0, "1000000"),
+		utxo(1, "5000000"),
+		utxo(2, "3000000"),
+		utxo(3, "2000000", PolicyAsset{tokenA, "10"}),
+		utxo(4, "2000000", PolicyAsset{tokenA, "50"}, PolicyAsset{tokenB, "7"}),
+		func() UTXO { u := utxo(5, "90000000"); u.InlineDatum = "00"; return u }(),
+		func() UTXO { u := utxo(6, "90000000"); u.RefScript = "00"; return u }(),
+	}
+
+	target := func(lovelace uint64, assets ...PolicyAsset) txValue {
+		v := newTxValue()
+		if err := v.add(lovelace, assets); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	testCases := []struct {
+		name      string
+		target    txValue
+		algorithm string
+		maxInputs int
+		selected  []int // nil if the selection must fail
+		used      string
+	}{
+		{"LargestFirst", target(6000000), coinSelectionLargestFirst, 0, []int{1, 2}, coinSelectionLargestFirst},
+		{"SmallestFirst", target(1000000), coinSelectionSmallestFirst, 0, []int{0}, coinSelectionSmallestFirst},
+		// the change of 500000 lovelace and 10 tokens needs more lovelace
+		{"ChangeWithAssets", target(2500000), coinSelectionSmallestFirst, 0, []int{0, 3, 4}, coinSelectionSmallestFirst},
+		{"NoDatumsOrRefScripts", target(20000000), coinSelectionLargestFirst, 0, nil, ""},
+		{"MultiAsset", target(1000000, PolicyAsset{tokenA, "20"}, PolicyAsset{tokenB, "1"}), coinSelectionSmallestFirst, 0, []int{3, 4}, coinSelectionSmallestFirst},
+		{"MissingAsset", target(1000000, PolicyAsset{tokenB, "8"}), coinSelectionLargestFirst, 0, nil, ""},
+		{"MaxInputs", target(9000000), coinSelectionSmallestFirst, 2, nil, ""},
+		// the change of 100000 lovelace is below the min lovelace of an output, so another UTXO is selected
+		{"ChangeMinLovelace", target(4900000), coinSelectionLargestFirst, 0, []int{1, 2}, coinSelectionLargestFirst},
+		// random-improve needs at least 3 inputs to cover the target with at most 3 inputs, largest-first needs 2
+		{"RandomImproveFallback", target(8000000), coinSelectionRandomImprove, 2, []int{1, 2}, coinSelectionLargestFirst},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, used, err := SelectCoins(utxos, tc.target, CoinSelectionOptions{
+				Algorithm:     tc.algorithm,
+				MaxInputs:     tc.maxInputs,
+				ChangeAddress: addr.String(),
+				Params:        params,
+				Rand:          rand.New(rand.NewPCG(1, 2)),
+			})
+
+			if tc.selected == nil {
+				var selectionErr *CoinSelectionError
+				if !errors.As(err, &selectionErr) {
+					t.Fatalf("expected coin selection error, got %v (selected %v)", err, selected)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			indices := []int{}
+			for _, u := range selected {
+				indices = append(indices, u.OutputIndex)
+			}
+
+			if fmt.Sprint(indices) != fmt.Sprint(tc.selected) {
+				t.Errorf("expected UTXOs %v, got %v", tc.selected, indices)
+			}
+
+			if used != tc.used {
+				t.Errorf("expected algorithm %s, got %s", tc.used, used)
+			}
+		})
+	}
+}
+
+func TestSelectCoinsRandomImprove(t *testing.T) {
+	_, addr := newValidatorTestKey(1)
+
+	utxos := []UTXO{}
+	for i := 0; i < 50; i++ {
+		utxos = append(utxos, UTXO{TxID: strings.Repeat("cc", 32), OutputIndex: i, Address: addr.String(), Lovelace: "1000000"})
+	}
+
+	for seed := uint64(0); seed < 20; seed++ {
+		selected, used, err := SelectCoins(utxos, txValue{lovelace: 10000000, assets: map[string]*big.Int{}}, CoinSelectionOptions{
+			Algorithm:     coinSelectionRandomImprove,
+			ChangeAddress: addr.String(),
+			Params:        newValidatorTestParams(),
+			Rand:          rand.New(rand.NewPCG(seed, seed)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if used != coinSelectionRandomImprove {
+			t.Fatalf("expected random-improve, got %s", used)
+		}
+
+		// with equal UTXOs, the improvement phase reaches the ideal of twice the target
+		if len(selected) != 20 {
+			t.Errorf("seed %d: expected 20 UTXOs, got %d", seed, len(selected))
+		}
+	}
+}
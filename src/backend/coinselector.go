@@ -1,20 +1,84 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 )
 
+const (
+	// default lifetime of the reservations made by POST /api/address/{address}/utxos
+	defaultReservationTTL = 10 * time.Second
+
+	// reservations can't be made or extended for longer, so that abandoned selections are eventually released
+	maxReservationTTL = 30 * time.Minute
+)
+
+var (
+	errReservationNotFound  = errors.New("reservation not found or expired")
+	errReservationForbidden = errors.New("reservation belongs to another client")
+)
+
+// Reservation is a set of UTXOs selected by a client, which aren't selected again until the reservation is released or expires.
+// Reservations are also released as soon as a mempool tx spends one of their UTXOs.
+type Reservation struct {
+	ID      string    `json:"id"`
+	Client  string    `json:"client,omitempty"` // SHA-256 hex of the client token, anyone knowing the ID can manage the reservation if empty
+	UTXOs   []string  `json:"utxos"`            // <tx-hash><index>
+	Expires time.Time `json:"expires"`
+}
+
 type CoinSelector struct {
-	mu     sync.Mutex
-	locked map[string]time.Time
+	mu           sync.Mutex
+	locked       map[string]time.Time // internal locks, e.g. inputs of txs built by Iris
+	reservations map[string]*Reservation
+	reserved     map[string]string // UTXO key -> reservation ID
+	path         string            // reservations are saved to this file if not empty
+	mempool      *Mempool
 }
 
-func NewCoinSelector() *CoinSelector {
-	return &CoinSelector{locked: make(map[string]time.Time)}
+// NewCoinSelector loads the reservations saved in path, which can be empty to keep the reservations in memory only
+func NewCoinSelector(path string, mempool *Mempool) (*CoinSelector, error) {
+	cs := &CoinSelector{
+		locked:       make(map[string]time.Time),
+		reservations: make(map[string]*Reservation),
+		reserved:     make(map[string]string),
+		path:         path,
+		mempool:      mempool,
+	}
+
+	if path == "" {
+		return cs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var reservations []*Reservation
+	if err := json.Unmarshal(data, &reservations); err != nil {
+		return nil, fmt.Errorf("invalid reservations file %s: %v", path, err)
+	}
+
+	for _, r := range reservations {
+		cs.addReservation(r)
+	}
+
+	return cs, nil
 }
 
+// must be called with mu locked, like isLocked, lock and reserve
 func (cs *CoinSelector) pruneExpired() {
 	now := time.Now()
 	for k, v := range cs.locked {
@@ -22,17 +86,202 @@ func (cs *CoinSelector) pruneExpired() {
 			delete(cs.locked, k)
 		}
 	}
+
+	if len(cs.reservations) == 0 {
+		return
+	}
+
+	spent := cs.mempool.SpentUTXOs()
+	changed := false
+
+	for id, r := range cs.reservations {
+		release := now.After(r.Expires)
+		for _, key := range r.UTXOs {
+			if _, ok := spent[key]; ok {
+				release = true
+			}
+		}
+
+		if release {
+			cs.removeReservation(id)
+			changed = true
+		}
+	}
+
+	if changed {
+		cs.save()
+	}
 }
 
 func (cs *CoinSelector) isLocked(key string) bool {
-	ttl, ok := cs.locked[key]
-	return ok && time.Now().Before(ttl)
+	if ttl, ok := cs.locked[key]; ok && time.Now().Before(ttl) {
+		return true
+	}
+
+	id, ok := cs.reserved[key]
+	return ok && time.Now().Before(cs.reservations[id].Expires)
 }
 
 func (cs *CoinSelector) lock(key string, ttl time.Duration) {
 	cs.locked[key] = time.Now().Add(ttl)
 }
 
+// reserve creates a reservation of the UTXOs owned by the client token, which can be empty
+func (cs *CoinSelector) reserve(utxos []UTXO, token string, ttl time.Duration) (Reservation, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Reservation{}, err
+	}
+
+	r := &Reservation{
+		ID:      hex.EncodeToString(id),
+		Client:  reservationClient(token),
+		UTXOs:   make([]string, 0, len(utxos)),
+		Expires: time.Now().Add(min(ttl, maxReservationTTL)),
+	}
+
+	for _, u := range utxos {
+		r.UTXOs = append(r.UTXOs, utxoKey(u))
+	}
+
+	cs.addReservation(r)
+	cs.save()
+
+	return *r, nil
+}
+
+// Reservation returns the reservation if it belongs to the client token
+func (cs *CoinSelector) Reservation(id string, token string) (Reservation, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.pruneExpired()
+
+	r, err := cs.ownedReservation(id, token)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	return *r, nil
+}
+
+// Extend sets the expiry of the reservation to ttl from now
+func (cs *CoinSelector) Extend(id string, token string, ttl time.Duration) (Reservation, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.pruneExpired()
+
+	r, err := cs.ownedReservation(id, token)
+	if err != nil {
+		return Reservation{}, err
+	}
+
+	r.Expires = time.Now().Add(min(ttl, maxReservationTTL))
+	cs.save()
+
+	return *r, nil
+}
+
+// Release makes the UTXOs of the reservation available again
+func (cs *CoinSelector) Release(id string, token string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.pruneExpired()
+
+	if _, err := cs.ownedReservation(id, token); err != nil {
+		return err
+	}
+
+	cs.removeReservation(id)
+	cs.save()
+
+	return nil
+}
+
+func (cs *CoinSelector) ownedReservation(id string, token string) (*Reservation, error) {
+	r, ok := cs.reservations[id]
+	if !ok {
+		return nil, errReservationNotFound
+	}
+
+	if r.Client != "" && r.Client != reservationClient(token) {
+		return nil, errReservationForbidden
+	}
+
+	return r, nil
+}
+
+func (cs *CoinSelector) addReservation(r *Reservation) {
+	cs.reservations[r.ID] = r
+	for _, key := range r.UTXOs {
+		cs.reserved[key] = r.ID
+	}
+}
+
+func (cs *CoinSelector) removeReservation(id string) {
+	for _, key := range cs.reservations[id].UTXOs {
+		if cs.reserved[key] == id {
+			delete(cs.reserved, key)
+		}
+	}
+
+	delete(cs.reservations, id)
+}
+
+// failing to save the reservations isn't fatal, they are only lost when Iris restarts
+func (cs *CoinSelector) save() {
+	if cs.path == "" {
+		return
+	}
+
+	if err := cs.writeReservations(); err != nil {
+		log.Printf("failed to save the UTXO reservations to %s: %v", cs.path, err)
+	}
+}
+
+func (cs *CoinSelector) writeReservations() error {
+	reservations := make([]*Reservation, 0, len(cs.reservations))
+	for _, r := range cs.reservations {
+		reservations = append(reservations, r)
+	}
+
+	data, err := json.Marshal(reservations)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cs.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cs.path), ".reservations-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), cs.path)
+}
+
+// the client tokens themselves aren't kept, so that they can't be read from the reservations file
+func reservationClient(token string) string {
+	if token == "" {
+		return ""
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 func utxoKey(u UTXO) string {
 	return fmt.Sprintf("%s%d", u.TxID, u.OutputIndex)
 }
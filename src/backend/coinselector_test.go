@@ -0,0 +1,108 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+func TestCoinSelectorReservations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "reservations.json")
+	mempool := NewMempool(nil)
+
+	cs, err := NewCoinSelector(path, mempool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, addr := newValidatorTestKey(1)
+	utxos := []UTXO{
+		{TxID: strings.Repeat("aa", 32), OutputIndex: 0, Address: addr.String(), Lovelace: "2000000"},
+		{TxID: strings.Repeat("aa", 32), OutputIndex: 1, Address: addr.String(), Lovelace: "3000000"},
+		{TxID: strings.Repeat("bb", 32), OutputIndex: 0, Address: addr.String(), Lovelace: "4000000"},
+	}
+
+	cs.mu.Lock()
+	owned, err := cs.reserve(utxos[:2], "client-a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := cs.reserve(utxos[2:], "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.mu.Unlock()
+
+	if anonymous.Expires.After(time.Now().Add(maxReservationTTL)) {
+		t.Errorf("expected ttl to be capped at %v", maxReservationTTL)
+	}
+
+	if _, err := cs.Reservation(owned.ID, "client-b"); err != errReservationForbidden {
+		t.Errorf("expected reservation of another client to be forbidden, got %v", err)
+	}
+
+	if err := cs.Release(owned.ID, "client-b"); err != errReservationForbidden {
+		t.Errorf("expected release by another client to be forbidden, got %v", err)
+	}
+
+	if _, err := cs.Reservation(anonymous.ID, "client-b"); err != nil {
+		t.Errorf("expected reservation without client to be accessible by id, got %v", err)
+	}
+
+	extended, err := cs.Extend(owned.ID, "client-a", 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !extended.Expires.After(owned.Expires) {
+		t.Errorf("expected expiry to be extended")
+	}
+
+	// reservations are reloaded after a restart
+	reloaded, err := NewCoinSelector(path, mempool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := reloaded.Reservation(owned.ID, "client-a"); err != nil || !r.Expires.Equal(extended.Expires) {
+		t.Fatalf("expected reservation to be persisted, got %v, %v", r, err)
+	}
+
+	reloaded.mu.Lock()
+	if !reloaded.isLocked(utxoKey(utxos[0])) || !reloaded.isLocked(utxoKey(utxos[2])) {
+		t.Errorf("expected reserved UTXOs to be locked")
+	}
+	reloaded.mu.Unlock()
+
+	// a tx spending one of the reserved UTXOs releases the whole reservation
+	_, otherAddr := newValidatorTestKey(2)
+	tx := encodeSponsorTestTx(t, validatorTestBody{
+		inputs:  []common.TransactionInput{shelley.NewShelleyTransactionInput(utxos[1].TxID, utxos[1].OutputIndex)},
+		outputs: []validatorTestOutput{{otherAddr, 2800000}},
+		fee:     200000,
+		ttl:     2000,
+	}.encoded())
+	mempool.AddTx(tx, time.Now().Add(time.Hour))
+
+	if _, err := reloaded.Reservation(owned.ID, "client-a"); err != errReservationNotFound {
+		t.Errorf("expected reservation to be released once spent, got %v", err)
+	}
+
+	reloaded.mu.Lock()
+	if reloaded.isLocked(utxoKey(utxos[0])) {
+		t.Errorf("expected UTXOs of the released reservation to be unlocked")
+	}
+	reloaded.mu.Unlock()
+
+	if err := reloaded.Release(anonymous.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reloaded.Reservation(anonymous.ID, ""); err != errReservationNotFound {
+		t.Errorf("expected released reservation to be gone, got %v", err)
+	}
+}
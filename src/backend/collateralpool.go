@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+)
+
+// interval between checks of the collateral UTXOs
+const collateralPoolInterval = time.Minute
+
+// the inputs of a collateral creation tx are reserved while it is signed and submitted, submission retries take up to 15 seconds
+const collateralReservationTTL = 2 * time.Minute
+
+// CollateralPool keeps track of the collateral UTXOs of the wallet, which are handed out round-robin through the collateralUTXO network parameter.
+// If size is 0, only the collateral configured in /etc/cardano-iris/collateral is used.
+// Otherwise the pool is managed: all wallet UTXOs containing exactly the configured lovelace are used, and missing ones are created using the other wallet funds.
+type CollateralPool struct {
+	size     int
+	lovelace uint64
+	fixed    string // <tx-hash><index>, only used if size is 0
+
+	mu          sync.Mutex
+	members     []UTXO // sorted by key
+	next        int
+	consumed    []string
+	created     int
+	pendingTx   string // latest tx creating collateral UTXOs
+	lastCheck   time.Time
+	lastError   string
+	lastWarning string
+}
+
+type CollateralPoolStatus struct {
+	Collateral string    `json:"collateral,omitempty"` // configured collateral, if the pool isn't managed
+	Managed    bool      `json:"managed"`
+	Size       int       `json:"size"`     // target number of UTXOs
+	Lovelace   uint64    `json:"lovelace"` // of each UTXO
+	UTXOs      []string  `json:"utxos"`    // available collateral UTXOs
+	Consumed   []string  `json:"consumed"` // collateral UTXOs that disappeared since Iris started
+	Created    int       `json:"created"`  // number of collateral UTXOs created since Iris started
+	PendingTx  string    `json:"pendingTx,omitempty"`
+	LastCheck  time.Time `json:"lastCheck"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+func NewCollateralPool(size int, lovelace uint64, fixed string) *CollateralPool {
+	return &CollateralPool{
+		size:     size,
+		lovelace: lovelace,
+		fixed:    fixed,
+		consumed: []string{},
+	}
+}
+
+func (p *CollateralPool) Managed() bool {
+	return p.size > 0
+}
+
+// Next returns the key of the next collateral UTXO, false if none is available
+func (p *CollateralPool) Next() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.members) == 0 {
+		return "", false
+	}
+
+	member := p.members[p.next%len(p.members)]
+	p.next = (p.next + 1) % len(p.members)
+
+	return utxoKey(member), true
+}
+
+// Contains returns true if the key (<tx-hash><index>) refers to one of the collateral UTXOs
+func (p *CollateralPool) Contains(key string) bool {
+	_, ok := p.Get(key)
+	return ok
+}
+
+// Get returns the collateral UTXO with the key (<tx-hash><index>)
+func (p *CollateralPool) Get(key string) (UTXO, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, m := range p.members {
+		if utxoKey(m) == key {
+			return m, true
+		}
+	}
+
+	return UTXO{}, false
+}
+
+// Update replaces the collateral UTXOs using the current UTXOs of the wallet, and returns the number of missing collateral UTXOs.
+// Collateral UTXOs that disappeared are logged, they are normally consumed by txs with failing scripts.
+func (p *CollateralPool) Update(walletUTXOs []UTXO, now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	members := []UTXO{}
+	for _, u := range walletUTXOs {
+		if p.isCandidate(u) {
+			members = append(members, u)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool { return utxoKey(members[i]) < utxoKey(members[j]) })
+
+	if p.Managed() && len(members) > p.size {
+		members = members[:p.size]
+	}
+
+	for _, old := range p.members {
+		found := false
+		for _, m := range members {
+			if utxoKey(m) == utxoKey(old) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			log.Printf("collateral UTXO %s#%d disappeared", old.TxID, old.OutputIndex)
+			p.consumed = append(p.consumed, utxoKey(old))
+		}
+	}
+
+	p.members = members
+	p.lastCheck = now
+
+	if !p.Managed() {
+		if len(members) == 0 && p.fixed != "" {
+			p.warn("collateral %s isn't an unspent UTXO of the wallet", p.fixed)
+		}
+
+		return 0
+	}
+
+	if len(members) < p.size {
+		p.warn("only %d of %d collateral UTXOs available", len(members), p.size)
+	} else {
+		p.lastWarning = ""
+	}
+
+	return p.size - len(members)
+}
+
+// collateral UTXOs only contain lovelace
+func (p *CollateralPool) isCandidate(u UTXO) bool {
+	if !p.Managed() {
+		return utxoKey(u) == p.fixed
+	}
+
+	if len(u.Assets) > 0 || u.DatumHash != "" || u.InlineDatum != "" || u.RefScript != "" {
+		return false
+	}
+
+	lovelace, err := strconv.ParseUint(u.Lovelace, 10, 64)
+
+	return err == nil && lovelace == p.lovelace
+}
+
+// logs a warning once, until it changes
+func (p *CollateralPool) warn(format string, args ...any) {
+	if msg := fmt.Sprintf(format, args...); msg != p.lastWarning {
+		log.Print(msg)
+		p.lastWarning = msg
+	}
+}
+
+// SetResult records the outcome of the latest replenishment attempt
+func (p *CollateralPool) SetResult(txID string, created int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.lastError = err.Error()
+		return
+	}
+
+	p.lastError = ""
+	p.pendingTx = txID
+	p.created += created
+}
+
+func (p *CollateralPool) Status() CollateralPoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := CollateralPoolStatus{
+		Managed:   p.Managed(),
+		Size:      p.size,
+		Lovelace:  p.lovelace,
+		UTXOs:     []string{},
+		Consumed:  append([]string{}, p.consumed...),
+		Created:   p.created,
+		PendingTx: p.pendingTx,
+		LastCheck: p.lastCheck,
+		LastError: p.lastError,
+	}
+
+	if !p.Managed() {
+		status.Collateral = p.fixed
+		status.Size = 1
+		status.Lovelace = 0
+	}
+
+	for _, m := range p.members {
+		status.UTXOs = append(status.UTXOs, utxoKey(m))
+	}
+
+	return status
+}
+
+// checks the collateral UTXOs periodically
+func (h *Handler) watchCollateralPool() {
+	for {
+		if err := h.refreshCollateralPool(context.Background()); err != nil {
+			log.Printf("failed to refresh the collateral pool (%v)", err)
+		}
+
+		time.Sleep(collateralPoolInterval)
+	}
+}
+
+// refreshCollateralPool updates the collateral UTXOs, and creates the missing ones using the other funds of the wallet.
+// The global mutex is only locked while the wallet UTXOs are read, the creation tx is built, signed and submitted without it.
+func (h *Handler) refreshCollateralPool(ctx context.Context) error {
+	addr := h.signer.Address()
+
+	// includes the outputs of pending creation txs, so these aren't created twice
+	h.mu.RLock()
+	utxos, err := h.getAddressUTXOs(ctx, addr, "")
+	h.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	missing := h.collateral.Update(utxos, time.Now())
+	if missing == 0 {
+		return nil
+	}
+
+	txID, err := h.createCollateral(ctx, addr, utxos, missing)
+	h.collateral.SetResult(txID, missing, err)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("creating %d collateral UTXOs in tx %s", missing, txID)
+
+	return nil
+}
+
+// builds, signs and submits a tx sending n collateral UTXOs to the wallet.
+// The inputs are reserved in the coin selector until the tx is in the mempool, so they aren't selected by concurrent requests.
+func (h *Handler) createCollateral(ctx context.Context, addr string, walletUTXOs []UTXO, n int) (string, error) {
+	params, err := h.protocolParameters()
+	if err != nil {
+		return "", err
+	}
+
+	tx, inputs, reservation, err := h.buildCollateralTx(params, addr, walletUTXOs, n)
+	if err != nil {
+		return "", err
+	}
+
+	txID, err := h.submitCollateralTx(ctx, tx, inputs)
+	if err != nil {
+		// a failed submission doesn't spend the inputs, so they are released right away
+		h.selector.Release(reservation.ID, "")
+		return "", err
+	}
+
+	return txID, nil
+}
+
+// selects the inputs among the unlocked wallet UTXOs and reserves them
+func (h *Handler) buildCollateralTx(params CardanoCLIParameters, addr string, walletUTXOs []UTXO, n int) (ledger.Transaction, []UTXO, Reservation, error) {
+	h.selector.mu.Lock()
+	defer h.selector.mu.Unlock()
+	h.selector.pruneExpired()
+
+	available := []UTXO{}
+	for _, u := range walletUTXOs {
+		if h.selector.isLocked(utxoKey(u)) || h.collateral.Contains(utxoKey(u)) || u.DatumHash != "" || u.InlineDatum != "" {
+			continue
+		}
+
+		available = append(available, u)
+	}
+
+	req := BuildTxRequest{From: []string{addr}}
+	for range n {
+		req.Outputs = append(req.Outputs, BuildTxOutput{Address: addr, Lovelace: strconv.FormatUint(h.collateral.lovelace, 10)})
+	}
+
+	tx, inputs, err := BuildTx(params, req, available, nil)
+	if err != nil {
+		return nil, nil, Reservation{}, err
+	}
+
+	reservation, err := h.selector.reserve(inputs, "", collateralReservationTTL)
+	if err != nil {
+		return nil, nil, Reservation{}, err
+	}
+
+	return tx, inputs, reservation, nil
+}
+
+func (h *Handler) submitCollateralTx(ctx context.Context, tx ledger.Transaction, inputs []UTXO) (string, error) {
+	tx, _, err := h.signTx(tx, signPurposeCollateralPool, inputs)
+	if err != nil {
+		return "", err
+	}
+
+	validator, err := h.newTxValidator(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if verr, err := validator.Validate(tx); err != nil {
+		return "", err
+	} else if verr != nil {
+		return "", errors.New(verr.Raw)
+	}
+
+	if _, _, err := h.submitValidatedTx(tx, nil); err != nil {
+		return "", err
+	}
+
+	return tx.Hash().String(), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollateralPool(t *testing.T) {
+	newUTXO := func(txID string, lovelace string) UTXO {
+		return UTXO{TxID: strings.Repeat(txID, 32), OutputIndex: 0, Lovelace: lovelace}
+	}
+
+	a := newUTXO("0a", "5000000")
+	b := newUTXO("0b", "5000000")
+	c := newUTXO("0c", "5000000")
+	funds := newUTXO("0d", "100000000")
+	withAsset := newUTXO("0e", "5000000")
+	withAsset.Assets = []PolicyAsset{{Asset: strings.Repeat("ab", 28), Quantity: "1"}}
+
+	t.Run("Managed", func(t *testing.T) {
+		pool := NewCollateralPool(2, 5000000, "")
+
+		if _, ok := pool.Next(); ok {
+			t.Fatalf("expected empty pool")
+		}
+
+		if missing := pool.Update([]UTXO{funds, withAsset}, time.Now()); missing != 2 {
+			t.Fatalf("expected 2 missing collateral UTXOs, got %d", missing)
+		}
+
+		if missing := pool.Update([]UTXO{funds, c, b, a}, time.Now()); missing != 0 {
+			t.Fatalf("expected no missing collateral UTXOs, got %d", missing)
+		}
+
+		// round-robin over the first size UTXOs
+		for _, expected := range []UTXO{a, b, a} {
+			if key, ok := pool.Next(); !ok || key != utxoKey(expected) {
+				t.Errorf("expected %s, got %s", utxoKey(expected), key)
+			}
+		}
+
+		if !pool.Contains(utxoKey(b)) || pool.Contains(utxoKey(c)) || pool.Contains(utxoKey(funds)) {
+			t.Errorf("unexpected members %v", pool.Status().UTXOs)
+		}
+
+		// a is consumed, and replaced by c
+		if missing := pool.Update([]UTXO{funds, b, c}, time.Now()); missing != 0 {
+			t.Fatalf("expected no missing collateral UTXOs, got %d", missing)
+		}
+
+		if missing := pool.Update([]UTXO{funds, c}, time.Now()); missing != 1 {
+			t.Fatalf("expected 1 missing collateral UTXO, got %d", missing)
+		}
+
+		status := pool.Status()
+		if len(status.Consumed) != 2 || status.Consumed[0] != utxoKey(a) || status.Consumed[1] != utxoKey(b) || len(status.UTXOs) != 1 {
+			t.Errorf("unexpected status %#v", status)
+		}
+	})
+
+	t.Run("Fixed", func(t *testing.T) {
+		pool := NewCollateralPool(0, 0, utxoKey(b))
+
+		if missing := pool.Update([]UTXO{a, b, funds}, time.Now()); missing != 0 {
+			t.Fatalf("expected nothing to be created for the configured collateral, got %d", missing)
+		}
+
+		if key, ok := pool.Next(); !ok || key != utxoKey(b) {
+			t.Errorf("expected configured collateral, got %s", key)
+		}
+
+		pool.Update([]UTXO{a, funds}, time.Now())
+
+		if _, ok := pool.Next(); ok {
+			t.Errorf("expected spent collateral not to be handed out")
+		}
+
+		if status := pool.Status(); status.Collateral != utxoKey(b) || len(status.Consumed) != 1 {
+			t.Errorf("unexpected status %#v", status)
+		}
+	})
+}
+
+func TestBuildCollateralTx(t *testing.T) {
+	selector, err := NewCoinSelector("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handler{selector: selector, collateral: NewCollateralPool(2, 5000000, "")}
+
+	_, addr := newValidatorTestKey(1)
+	walletUTXOs := []UTXO{
+		{TxID: strings.Repeat("aa", 32), OutputIndex: 0, Address: addr.String(), Lovelace: "20000000"},
+		{TxID: strings.Repeat("bb", 32), OutputIndex: 0, Address: addr.String(), Lovelace: "30000000"},
+	}
+
+	_, inputs, reservation, err := h.buildCollateralTx(newValidatorTestParams(), addr.String(), walletUTXOs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inputs) != 1 {
+		t.Fatalf("expected a single input, got %d", len(inputs))
+	}
+
+	// a concurrent refresh can't select the reserved input
+	_, others, _, err := h.buildCollateralTx(newValidatorTestParams(), addr.String(), walletUTXOs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(others) != 1 || utxoKey(others[0]) == utxoKey(inputs[0]) {
+		t.Errorf("expected the other UTXO to be selected, got %v", others)
+	}
+
+	if err := h.selector.Release(reservation.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	h.selector.mu.Lock()
+	if h.selector.isLocked(utxoKey(inputs[0])) {
+		t.Errorf("expected released input to be unlocked")
+	}
+	h.selector.mu.Unlock()
+}
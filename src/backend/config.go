@@ -1,15 +1,27 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
 )
 
 const (
-	WalletFile     = "/etc/cardano-iris/wallet"
+	WalletFile     = "/etc/cardano-iris/wallet" // plaintext mnemonic, takes precedence over the keystore
+	KeystoreFile   = "/etc/cardano-iris/wallet.keystore"
 	CollateralFile = "/etc/cardano-iris/collateral"
 	NetworkFile    = "/etc/cardano-iris/network"
+	AdminTokenFile = "/etc/cardano-iris/admin-token"
+	SponsorFile    = "/etc/cardano-iris/sponsorship"
+	NodeSocketPath = "/run/cardano-node/node.socket"
+
+	ReservationsFile = "/var/lib/cardano-iris/reservations.json"
 )
 
 // Config holds global configuration settings.
@@ -17,6 +29,36 @@ type Config struct {
 	Wallet      []string
 	Collateral  string
 	NetworkName string
+	AdminToken  string             // admin endpoints are disabled if empty
+	Sponsorship *SponsorshipConfig // fee sponsorship is disabled if nil
+
+	// approximate memory budget in bytes for caching decoded blocks, set using the --block-cache-size flag
+	BlockCacheSize int64
+
+	// interval between snapshots of the node's mempool, set using the --node-mempool-interval flag, 0 disables mirroring
+	NodeMempoolInterval time.Duration
+
+	// command used to evaluate the redeemers of txs, set using the --tx-evaluator flag, /api/tx/evaluate is disabled if empty
+	TxEvaluator string
+
+	// number of collateral UTXOs kept by the wallet, set using the --collateral-pool-size flag, only the configured collateral is used if 0
+	CollateralPoolSize int
+
+	// lovelace of each collateral UTXO, set using the --collateral-lovelace flag
+	CollateralLovelace uint64
+
+	// policy of the in-process signer, set using the --signer-max-lovelace flag
+	SignerPolicy SignerPolicy
+
+	// signer process holding the wallet key, used if no mnemonic is configured, set using the --remote-signer flags
+	RemoteSigner RemoteSignerConfig
+
+	// UTXO reservations made by clients, set using the --reservations-file flag, reservations are lost on restart if empty
+	ReservationsFile string
+
+	// enables /admin/wallet/sign, set using the --wallet-signing flag.
+	// The endpoint derives the keys of the wallet in-process and signs with them outside the Signer and its policy, so it is only available with a local mnemonic.
+	WalletSigning bool
 }
 
 // NewConfig reads configuration from disk.
@@ -25,7 +67,32 @@ func NewConfig() *Config {
 		Wallet:      readWalletPhrase(),
 		Collateral:  readCollateral(),
 		NetworkName: readNetworkName(),
+		AdminToken:  readAdminToken(),
+		Sponsorship: readSponsorship(),
+	}
+}
+
+// ChainDBDir returns the directory of the cardano-node chain database
+func (c *Config) ChainDBDir() string {
+	return filepath.Join("/var/cache/cardano-node", c.NetworkName)
+}
+
+// NetworkMagic returns the magic number used to connect to the node, matching the network used by cardano-cli
+func (c *Config) NetworkMagic() uint32 {
+	if c.NetworkName == "mainnet" {
+		return 764824073
 	}
+
+	return 1
+}
+
+// AddressNetwork returns the network that addresses accepted by the API must belong to
+func (c *Config) AddressNetwork() AddressNetwork {
+	if c.NetworkName == "mainnet" {
+		return AddressNetwork{common.AddressNetworkMainnet, c.NetworkMagic()}
+	}
+
+	return AddressNetwork{common.AddressNetworkTestnet, c.NetworkMagic()}
 }
 
 func readWalletPhrase() []string {
@@ -40,6 +107,27 @@ func readWalletPhrase() []string {
 	return words
 }
 
+// unlockWallet decrypts the keystore if no plaintext mnemonic is configured, a missing keystore leaves the wallet disabled
+func (c *Config) unlockWallet(keystore string, source PassphraseSource) error {
+	if c.Wallet != nil {
+		log.Printf("using the plaintext mnemonic in %s, import it into an encrypted keystore using cardano-iris wallet import", WalletFile)
+		return nil
+	}
+
+	if _, err := os.Stat(keystore); os.IsNotExist(err) {
+		return nil
+	}
+
+	words, err := UnlockKeystore(keystore, source)
+	if err != nil {
+		return fmt.Errorf("unable to unlock wallet keystore %s (%w)", keystore, err)
+	}
+
+	c.Wallet = words
+
+	return nil
+}
+
 func readCollateral() string {
 	data, err := os.ReadFile(CollateralFile)
 	if err != nil {
@@ -51,6 +139,38 @@ func readCollateral() string {
 	return strings.TrimSpace(string(data))
 }
 
+func readAdminToken() string {
+	data, err := os.ReadFile(AdminTokenFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ""
+		}
+		log.Fatalf("Error reading file %s: %v", AdminTokenFile, err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSponsorship() *SponsorshipConfig {
+	data, err := os.ReadFile(SponsorFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		log.Fatalf("Error reading file %s: %v", SponsorFile, err)
+	}
+
+	var cfg SponsorshipConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		log.Fatalf("Invalid sponsorship config in %s: %v", SponsorFile, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid sponsorship config in %s: %v", SponsorFile, err)
+	}
+
+	return &cfg
+}
+
 func readNetworkName() string {
 	data, err := os.ReadFile(NetworkFile)
 	if err != nil {
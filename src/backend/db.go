@@ -209,6 +209,244 @@ func (db *DB) AddressUTXOsWithAsset(addr string, asset string, ctx context.Conte
 	return utxos, err
 }
 
+// CredentialUTXOs returns the UTXOs of all the addresses with the payment credential, or with the stake address (header and hash) if paymentCred is nil
+func (db *DB) CredentialUTXOs(paymentCred []byte, stakeAddress []byte, ctx context.Context) ([]UTXO, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, queries["addresses_credential_utxos_pure"], paymentCred, stakeAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := make([]UTXO, 0)
+
+	var (
+		txID           string
+		outputIndex    int
+		address        string
+		lovelace       string
+		rawAssets      *string
+		rawDatumHash   *string
+		rawInlineDatum *string
+		rawRefScript   *string
+	)
+
+	_, err = pgx.ForEachRow(rows, []any{
+		&txID,
+		&outputIndex,
+		&address,
+		&lovelace,
+		&rawAssets,
+		&rawDatumHash,
+		&rawInlineDatum,
+		&rawRefScript,
+	}, func() error {
+		assets := []PolicyAsset{}
+
+		if rawAssets != nil {
+			if err := json.Unmarshal([]byte(*rawAssets), &assets); err != nil {
+				return err
+			}
+		}
+
+		datumHash := ""
+		if rawDatumHash != nil {
+			datumHash = *rawDatumHash
+		}
+
+		inlineDatum := ""
+		if rawInlineDatum != nil {
+			inlineDatum = *rawInlineDatum
+		}
+
+		refScript := ""
+		if rawRefScript != nil {
+			refScript = *rawRefScript
+		}
+
+		utxos = append(utxos, UTXO{
+			TxID:        txID,
+			OutputIndex: outputIndex,
+			Address:     address,
+			Lovelace:    lovelace,
+			Assets:      assets,
+			DatumHash:   datumHash,
+			InlineDatum: inlineDatum,
+			RefScript:   refScript,
+			ConsumedBy:  "",
+		})
+
+		return nil
+	})
+
+	return utxos, err
+}
+
+// QueryUTXOs returns in a single round trip the UTXOs of all the addresses, payment credentials, stake addresses (header and hash) and output refs
+func (db *DB) QueryUTXOs(addresses []string, paymentCreds [][]byte, stakeAddresses [][]byte, refs []UTXORef, ctx context.Context) ([]UTXO, error) {
+	txHashes := make([][]byte, 0, len(refs))
+	indices := make([]int32, 0, len(refs))
+	for _, ref := range refs {
+		txHashes = append(txHashes, ref.TxHash)
+		indices = append(indices, int32(ref.Index))
+	}
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, queries["utxos_query"], addresses, paymentCreds, stakeAddresses, txHashes, indices)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := make([]UTXO, 0)
+
+	var (
+		txID           string
+		outputIndex    int
+		address        string
+		lovelace       string
+		rawAssets      *string
+		rawDatumHash   *string
+		rawInlineDatum *string
+		rawRefScript   *string
+	)
+
+	_, err = pgx.ForEachRow(rows, []any{
+		&txID,
+		&outputIndex,
+		&address,
+		&lovelace,
+		&rawAssets,
+		&rawDatumHash,
+		&rawInlineDatum,
+		&rawRefScript,
+	}, func() error {
+		assets := []PolicyAsset{}
+
+		if rawAssets != nil {
+			if err := json.Unmarshal([]byte(*rawAssets), &assets); err != nil {
+				return err
+			}
+		}
+
+		datumHash := ""
+		if rawDatumHash != nil {
+			datumHash = *rawDatumHash
+		}
+
+		inlineDatum := ""
+		if rawInlineDatum != nil {
+			inlineDatum = *rawInlineDatum
+		}
+
+		refScript := ""
+		if rawRefScript != nil {
+			refScript = *rawRefScript
+		}
+
+		utxos = append(utxos, UTXO{
+			TxID:        txID,
+			OutputIndex: outputIndex,
+			Address:     address,
+			Lovelace:    lovelace,
+			Assets:      assets,
+			DatumHash:   datumHash,
+			InlineDatum: inlineDatum,
+			RefScript:   refScript,
+			ConsumedBy:  "",
+		})
+
+		return nil
+	})
+
+	return utxos, err
+}
+
+// AddressBalance returns in a single round trip the confirmed balance of an address, or of all the addresses with the payment credential if it isn't nil
+func (db *DB) AddressBalance(addr string, paymentCred []byte, ctx context.Context) (AddressBalance, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return AddressBalance{}, err
+	}
+
+	defer conn.Release()
+
+	batch := &pgx.Batch{}
+	batch.Queue(queries["blockfrost/addresses_address"], addr, paymentCred)
+	batch.Queue(queries["blockfrost/addresses_address_total"], addr, paymentCred)
+	batch.Queue(queries["addresses_address_utxo_count"], addr, paymentCred)
+
+	results := conn.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var (
+		balance           AddressBalance
+		rawAmount         *string
+		rawSentAmount     *string
+		rawReceivedAmount *string
+	)
+
+	// nil destinations skip the address, stake address and script columns
+	if err := results.QueryRow().Scan(nil, &balance.Lovelace, &rawAmount, nil, nil); err != nil {
+		return AddressBalance{}, err
+	}
+
+	if err := results.QueryRow().Scan(nil, &balance.Sent.Lovelace, &rawSentAmount, &balance.Received.Lovelace, &rawReceivedAmount, &balance.TxCount); err != nil {
+		return AddressBalance{}, err
+	}
+
+	if err := results.QueryRow().Scan(&balance.UTXOCount); err != nil {
+		return AddressBalance{}, err
+	}
+
+	if balance.Assets, err = parseBlockfrostAmount(rawAmount); err != nil {
+		return AddressBalance{}, err
+	}
+
+	if balance.Sent.Assets, err = parseBlockfrostAmount(rawSentAmount); err != nil {
+		return AddressBalance{}, err
+	}
+
+	if balance.Received.Assets, err = parseBlockfrostAmount(rawReceivedAmount); err != nil {
+		return AddressBalance{}, err
+	}
+
+	return balance, results.Close()
+}
+
+// the blockfrost queries return amounts as a JSON list of { unit, quantity } objects, or NULL if the list is empty
+func parseBlockfrostAmount(raw *string) ([]PolicyAsset, error) {
+	assets := []PolicyAsset{}
+	if raw == nil {
+		return assets, nil
+	}
+
+	var amount []struct {
+		Unit     string `json:"unit"`
+		Quantity string `json:"quantity"`
+	}
+
+	if err := json.Unmarshal([]byte(*raw), &amount); err != nil {
+		return nil, err
+	}
+
+	for _, a := range amount {
+		assets = append(assets, PolicyAsset{Asset: a.Unit, Quantity: a.Quantity})
+	}
+
+	return assets, nil
+}
+
 func (db *DB) AssetAddresses(asset string, ctx context.Context) ([]AssetAddress, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -388,6 +626,26 @@ func (db *DB) LatestEpoch(ctx context.Context) (uint64, error) {
 	return epoch, nil
 }
 
+// returns the slot of the block at the given height
+func (db *DB) BlockSlot(height uint64, ctx context.Context) (uint64, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer conn.Release()
+
+	query := conn.QueryRow(ctx, queries["blocks_number_slot"], height)
+
+	var slot uint64
+
+	if err := query.Scan(&slot); err != nil {
+		return 0, err
+	}
+
+	return slot, nil
+}
+
 func (db *DB) PolicyAssets(policy string, ctx context.Context) ([]PolicyAsset, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -480,6 +738,30 @@ func (db *DB) FilterMissingTxs(txIDs []string, ctx context.Context) ([]string, e
 	return missing, err
 }
 
+// FilterUsedAddresses returns the addresses that appear in at least one tx output
+func (db *DB) FilterUsedAddresses(addrs []string, ctx context.Context) ([]string, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, queries["addresses_filter_used"], addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	used := make([]string, 0)
+	var addr string
+	_, err = pgx.ForEachRow(rows, []any{&addr}, func() error {
+		used = append(used, addr)
+		return nil
+	})
+
+	return used, err
+}
+
 func (db *DB) UTXO(txID string, outputIndex int, ctx context.Context) (UTXO, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
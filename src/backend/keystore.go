@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	bip39 "github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+
+	// environment variables and systemd credentials holding keystore passphrases
+	keystorePassphraseEnv           = "IRIS_WALLET_PASSPHRASE"
+	keystoreNewPassphraseEnv        = "IRIS_WALLET_NEW_PASSPHRASE"
+	keystorePassphraseCredential    = "wallet-passphrase"
+	keystoreNewPassphraseCredential = "wallet-new-passphrase"
+)
+
+// Keystore is the JSON content of the encrypted wallet file.
+// The BIP-39 entropy of the wallet is encrypted with XChaCha20-Poly1305, using a key derived from the passphrase with argon2id or scrypt.
+type Keystore struct {
+	Version    int         `json:"version"`
+	KDF        KeystoreKDF `json:"kdf"`
+	Cipher     string      `json:"cipher"`
+	Nonce      string      `json:"nonce"`
+	Ciphertext string      `json:"ciphertext"`
+}
+
+type KeystoreKDF struct {
+	Name string `json:"name"` // argon2id or scrypt
+	Salt string `json:"salt"`
+
+	// argon2id
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"` // in KiB
+	Threads uint8  `json:"threads,omitempty"`
+
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+}
+
+// PassphraseSource describes where a passphrase is read from, in order of precedence: the file descriptor, the environment variable and the systemd credential
+type PassphraseSource struct {
+	FD         int // ignored if negative
+	Env        string
+	Credential string // name of the file in $CREDENTIALS_DIRECTORY
+}
+
+var (
+	keystoreFile          string
+	keystoreKDF           string
+	passphraseFD          int
+	newPassphraseFD       int
+	importMnemonicFile    string
+	exportPublicAccounts  uint32
+	errKeystorePassphrase = errors.New("wrong passphrase or corrupted keystore")
+)
+
+func defaultKeystoreKDF(name string) (KeystoreKDF, error) {
+	switch name {
+	case "argon2id":
+		return KeystoreKDF{Name: name, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+	case "scrypt":
+		return KeystoreKDF{Name: name, N: 1 << 17, R: 8, P: 1}, nil
+	default:
+		return KeystoreKDF{}, fmt.Errorf("unsupported KDF %s, expected argon2id or scrypt", name)
+	}
+}
+
+func (kdf KeystoreKDF) deriveKey(passphrase []byte) ([]byte, error) {
+	salt, err := hex.DecodeString(kdf.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keystore salt: %w", err)
+	}
+
+	switch kdf.Name {
+	case "argon2id":
+		return argon2.IDKey(passphrase, salt, kdf.Time, kdf.Memory, kdf.Threads, chacha20poly1305.KeySize), nil
+	case "scrypt":
+		return scrypt.Key(passphrase, salt, kdf.N, kdf.R, kdf.P, chacha20poly1305.KeySize)
+	default:
+		return nil, fmt.Errorf("unsupported KDF %s", kdf.Name)
+	}
+}
+
+// EncryptKeystore encrypts the entropy of a mnemonic, a new salt is generated for the KDF
+func EncryptKeystore(entropy []byte, passphrase []byte, kdf KeystoreKDF) (*Keystore, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	kdf.Salt = hex.EncodeToString(salt)
+
+	key, err := kdf.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	defer zeroBytes(key)
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{
+		Version: keystoreVersion,
+		KDF:     kdf,
+		Cipher:  "xchacha20-poly1305",
+		Nonce:   hex.EncodeToString(nonce),
+	}
+
+	ks.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, entropy, ks.additionalData()))
+
+	return ks, nil
+}
+
+// Decrypt returns the entropy of the mnemonic, which should be zeroed by the caller once it isn't needed anymore
+func (ks *Keystore) Decrypt(passphrase []byte) ([]byte, error) {
+	if ks.Version != keystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d", ks.Version)
+	}
+
+	if ks.Cipher != "xchacha20-poly1305" {
+		return nil, fmt.Errorf("unsupported keystore cipher %s", ks.Cipher)
+	}
+
+	nonce, err := hex.DecodeString(ks.Nonce)
+	if err != nil || len(nonce) != chacha20poly1305.NonceSizeX {
+		return nil, errors.New("invalid keystore nonce")
+	}
+
+	ciphertext, err := hex.DecodeString(ks.Ciphertext)
+	if err != nil {
+		return nil, errors.New("invalid keystore ciphertext")
+	}
+
+	key, err := ks.KDF.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	defer zeroBytes(key)
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	entropy, err := aead.Open(nil, nonce, ciphertext, ks.additionalData())
+	if err != nil {
+		return nil, errKeystorePassphrase
+	}
+
+	return entropy, nil
+}
+
+// the KDF parameters are authenticated, so they can't be weakened without invalidating the keystore
+func (ks *Keystore) additionalData() []byte {
+	kdf, _ := json.Marshal(ks.KDF)
+	return fmt.Appendf(nil, "cardano-iris keystore v%d %s %s", ks.Version, ks.Cipher, kdf)
+}
+
+func ReadKeystore(path string) (*Keystore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ks Keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("invalid keystore %s: %w", path, err)
+	}
+
+	return &ks, nil
+}
+
+// WriteKeystore atomically replaces the keystore file, which is only readable by its owner
+func WriteKeystore(path string, ks *Keystore) error {
+	data, err := json.MarshalIndent(ks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// UnlockKeystore decrypts the keystore file and returns the words of the mnemonic
+func UnlockKeystore(path string, source PassphraseSource) ([]string, error) {
+	ks, err := ReadKeystore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := source.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	defer zeroBytes(passphrase)
+
+	entropy, err := ks.Decrypt(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	defer zeroBytes(entropy)
+
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(mnemonic), nil
+}
+
+// Read returns the passphrase without the trailing newline
+func (s PassphraseSource) Read() ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+
+	if s.FD >= 0 {
+		f := os.NewFile(uintptr(s.FD), fmt.Sprintf("fd %d", s.FD))
+		if f == nil {
+			return nil, fmt.Errorf("invalid passphrase file descriptor %d", s.FD)
+		}
+
+		data, err = io.ReadAll(f)
+		f.Close()
+	} else if env, ok := os.LookupEnv(s.Env); ok {
+		data = []byte(env)
+
+		// the passphrase shouldn't be inherited by child processes
+		os.Unsetenv(s.Env)
+	} else if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" && s.Credential != "" {
+		data, err = os.ReadFile(filepath.Join(dir, s.Credential))
+	} else {
+		return nil, fmt.Errorf("no passphrase supplied, set %s or use a file descriptor or the %s systemd credential", s.Env, s.Credential)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read passphrase (%w)", err)
+	}
+
+	passphrase := []byte(strings.TrimRight(string(data), "\r\n"))
+	zeroBytes(data)
+
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	return passphrase, nil
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func keystorePassphrase() PassphraseSource {
+	return PassphraseSource{FD: passphraseFD, Env: keystorePassphraseEnv, Credential: keystorePassphraseCredential}
+}
+
+// passphrase of new keystores, for create and import the regular passphrase sources are used
+func keystoreNewPassphrase(rotate bool) PassphraseSource {
+	if !rotate {
+		return keystorePassphrase()
+	}
+
+	return PassphraseSource{FD: newPassphraseFD, Env: keystoreNewPassphraseEnv, Credential: keystoreNewPassphraseCredential}
+}
+
+// writes a new keystore, without overwriting an existing one
+func createKeystore(entropy []byte, source PassphraseSource) error {
+	if _, err := os.Stat(keystoreFile); err == nil {
+		return fmt.Errorf("keystore %s already exists, use rotate to change its passphrase", keystoreFile)
+	}
+
+	return encryptKeystoreFile(entropy, source)
+}
+
+func encryptKeystoreFile(entropy []byte, source PassphraseSource) error {
+	kdf, err := defaultKeystoreKDF(keystoreKDF)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := source.Read()
+	if err != nil {
+		return err
+	}
+
+	defer zeroBytes(passphrase)
+
+	ks, err := EncryptKeystore(entropy, passphrase, kdf)
+	if err != nil {
+		return err
+	}
+
+	return WriteKeystore(keystoreFile, ks)
+}
+
+func createWallet(cmd *cobra.Command, args []string) error {
+	entropy, err := bip39.NewEntropy(256)
+	if err != nil {
+		return err
+	}
+
+	defer zeroBytes(entropy)
+
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return err
+	}
+
+	if err := createKeystore(entropy, keystoreNewPassphrase(false)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Created %s, write down the mnemonic below as a backup:\n", keystoreFile)
+	fmt.Println(mnemonic)
+
+	return nil
+}
+
+// imports a mnemonic from a file (e.g. the legacy plaintext wallet file) or stdin
+func importWallet(cmd *cobra.Command, args []string) error {
+	var (
+		data []byte
+		err  error
+	)
+
+	if importMnemonicFile == "" || importMnemonicFile == "-" {
+		data, err = io.ReadAll(bufio.NewReader(os.Stdin))
+	} else {
+		data, err = os.ReadFile(importMnemonicFile)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer zeroBytes(data)
+
+	mnemonic := strings.Join(strings.Fields(string(data)), " ")
+
+	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+	if err != nil {
+		return fmt.Errorf("invalid mnemonic (%w)", err)
+	}
+
+	defer zeroBytes(entropy)
+
+	if err := createKeystore(entropy, keystoreNewPassphrase(false)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported the wallet into %s\n", keystoreFile)
+
+	if importMnemonicFile == WalletFile {
+		fmt.Fprintf(os.Stderr, "Remove %s, otherwise the plaintext mnemonic keeps being used\n", WalletFile)
+	}
+
+	return nil
+}
+
+// re-encrypts the keystore with a new passphrase, and optionally a different KDF
+func rotateWallet(cmd *cobra.Command, args []string) error {
+	ks, err := ReadKeystore(keystoreFile)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := keystorePassphrase().Read()
+	if err != nil {
+		return err
+	}
+
+	defer zeroBytes(passphrase)
+
+	entropy, err := ks.Decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+
+	defer zeroBytes(entropy)
+
+	if !cmd.Flags().Changed("kdf") {
+		keystoreKDF = ks.KDF.Name
+	}
+
+	if err := encryptKeystoreFile(entropy, keystoreNewPassphrase(true)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Changed the passphrase of %s\n", keystoreFile)
+
+	return nil
+}
+
+type WalletPublicKeys struct {
+	Network  string                    `json:"network"`
+	Address  string                    `json:"address"` // first enterprise address, holding the collateral
+	Accounts []WalletAccountPublicKeys `json:"accounts"`
+}
+
+type WalletAccountPublicKeys struct {
+	Index        uint32 `json:"index"`
+	Path         string `json:"path"`
+	XPubKey      string `json:"xpub"` // bech32 acct_xvk, from which all payment and stake keys of the account can be derived
+	StakeKeyHash string `json:"stakeKeyHash"`
+	StakeAddress string `json:"stakeAddress"`
+}
+
+// prints the account public keys, e.g. for watch-only wallets
+func exportWalletPublicKeys(cmd *cobra.Command, args []string) error {
+	cfg := NewConfig()
+
+	words := cfg.Wallet
+	if words == nil {
+		var err error
+		if words, err = UnlockKeystore(keystoreFile, keystorePassphrase()); err != nil {
+			return err
+		}
+	}
+
+	wallet, err := NewHDWallet(words, cfg.NetworkName)
+	if err != nil {
+		return err
+	}
+
+	defer wallet.Close()
+
+	enterprise, err := wallet.EnterpriseAddress(0, walletRoleExternal, 0)
+	if err != nil {
+		return err
+	}
+
+	res := WalletPublicKeys{Network: cfg.NetworkName, Address: enterprise.Address, Accounts: []WalletAccountPublicKeys{}}
+
+	for account := range exportPublicAccounts {
+		stakeAddr, err := wallet.StakeAddress(account)
+		if err != nil {
+			return err
+		}
+
+		stakeKeyHash, err := wallet.StakeKeyHash(account)
+		if err != nil {
+			return err
+		}
+
+		res.Accounts = append(res.Accounts, WalletAccountPublicKeys{
+			Index:        account,
+			Path:         fmt.Sprintf("m/1852'/1815'/%d'", account),
+			XPubKey:      wallet.AccountXPubKey(account),
+			StakeKeyHash: stakeKeyHash,
+			StakeAddress: stakeAddr,
+		})
+	}
+
+	content, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(content))
+
+	return nil
+}
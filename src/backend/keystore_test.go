@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bip39 "github.com/tyler-smith/go-bip39"
+)
+
+func TestKeystore(t *testing.T) {
+	entropy, err := bip39.EntropyFromMnemonic(sponsorTestMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cheap parameters, to keep the test fast
+	kdfs := []KeystoreKDF{
+		{Name: "argon2id", Time: 1, Memory: 1024, Threads: 1},
+		{Name: "scrypt", N: 1024, R: 8, P: 1},
+	}
+
+	for _, kdf := range kdfs {
+		t.Run(kdf.Name, func(t *testing.T) {
+			ks, err := EncryptKeystore(entropy, []byte("correct horse"), kdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decrypted, err := ks.Decrypt([]byte("correct horse"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(decrypted, entropy) {
+				t.Errorf("decrypted entropy doesn't match")
+			}
+
+			if _, err := ks.Decrypt([]byte("wrong horse")); err != errKeystorePassphrase {
+				t.Errorf("expected wrong passphrase error, got %v", err)
+			}
+
+			// the KDF parameters are authenticated
+			weakened := *ks
+			weakened.KDF.Salt = strings.Repeat("00", 32)
+			if _, err := weakened.Decrypt([]byte("correct horse")); err == nil {
+				t.Errorf("expected modified keystore to be rejected")
+			}
+		})
+	}
+}
+
+func TestUnlockKeystore(t *testing.T) {
+	entropy, err := bip39.EntropyFromMnemonic(sponsorTestMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := EncryptKeystore(entropy, []byte("secret"), KeystoreKDF{Name: "argon2id", Time: 1, Memory: 1024, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wallet.keystore")
+
+	if err := WriteKeystore(path, ks); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected keystore only readable by its owner, got %v", info.Mode())
+	}
+
+	credentials := filepath.Join(dir, "credentials")
+	if err := os.Mkdir(credentials, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(credentials, "wallet-passphrase"), []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	source := PassphraseSource{FD: -1, Env: "IRIS_TEST_PASSPHRASE", Credential: "wallet-passphrase"}
+
+	t.Run("NoPassphrase", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", "")
+
+		if _, err := UnlockKeystore(path, source); err == nil {
+			t.Errorf("expected missing passphrase error")
+		}
+	})
+
+	t.Run("Env", func(t *testing.T) {
+		t.Setenv("IRIS_TEST_PASSPHRASE", "secret")
+
+		words, err := UnlockKeystore(path, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Join(words, " ") != sponsorTestMnemonic {
+			t.Errorf("unexpected mnemonic %v", words)
+		}
+
+		if _, ok := os.LookupEnv("IRIS_TEST_PASSPHRASE"); ok {
+			t.Errorf("expected passphrase to be removed from the environment")
+		}
+	})
+
+	t.Run("Credential", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", credentials)
+
+		words, err := UnlockKeystore(path, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Join(words, " ") != sponsorTestMnemonic {
+			t.Errorf("unexpected mnemonic %v", words)
+		}
+	})
+}
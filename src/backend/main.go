@@ -6,19 +6,36 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/crypto/acme/autocert"
 )
 
 var (
-	useHTTP bool
+	useHTTP             bool
+	blockCacheSize      int64 // in MiB
+	chainDBDir          string
+	nodeMempoolInterval time.Duration
+	txEvaluator         string
+	collateralPoolSize  int
+	collateralLovelace  uint64
+	signerMaxLovelace   uint64
+	remoteSigner        RemoteSignerConfig
+	signerListen        string
+	signerClientUIDs    []int
+	signerTLSCert       string
+	signerTLSKey        string
+	signerClientCA      string
+	reservationsFile    string
+	walletSigning       bool
 )
 
 func main() {
@@ -35,12 +52,190 @@ func makeCLI() *cobra.Command {
 	}
 
 	cli.Flags().BoolVar(&useHTTP, "http", false, "host using HTTP instead of HTTPS (more suitable for localhost)")
+	cli.Flags().Int64Var(&blockCacheSize, "block-cache-size", 256, "approximate memory budget in MiB for caching decoded blocks (0 disables caching)")
+	cli.Flags().DurationVar(&nodeMempoolInterval, "node-mempool-interval", 5*time.Second, "interval between snapshots of the node's mempool (0 disables mirroring)")
+	cli.Flags().StringVar(&txEvaluator, "tx-evaluator", "", "command used to evaluate the redeemers of txs (disables /api/tx/evaluate if empty)")
+	cli.Flags().IntVar(&collateralPoolSize, "collateral-pool-size", 0, "number of collateral UTXOs created and kept by the wallet (0 only uses the collateral configured in /etc/cardano-iris/collateral)")
+	cli.Flags().Uint64Var(&collateralLovelace, "collateral-lovelace", 5000000, "lovelace of each collateral UTXO created by the wallet")
+	cli.Flags().Uint64Var(&signerMaxLovelace, "signer-max-lovelace", 0, "maximum lovelace leaving the wallet per tx signed in-process (0 for no limit)")
+	cli.Flags().StringVar(&reservationsFile, "reservations-file", ReservationsFile, "file in which the UTXO reservations are kept across restarts (reservations are kept in memory only if empty)")
+	cli.Flags().BoolVar(&walletSigning, "wallet-signing", false, "enable /admin/wallet/sign, which signs with any key of the in-process wallet outside the signer policy")
+	cli.Flags().StringVar(&remoteSigner.URL, "remote-signer", "", "URL of the signer process holding the wallet key (unix:///path/to/socket or https://host:port), used if no mnemonic is configured")
+	cli.Flags().StringVar(&remoteSigner.Cert, "remote-signer-cert", "", "client certificate for the HTTPS remote signer")
+	cli.Flags().StringVar(&remoteSigner.Key, "remote-signer-key", "", "client key for the HTTPS remote signer")
+	cli.Flags().StringVar(&remoteSigner.CA, "remote-signer-ca", "", "CA of the certificate of the HTTPS remote signer")
+	cli.Flags().IntVar(&remoteSigner.UID, "remote-signer-uid", -1, "user ID of the signer process listening on the Unix socket")
+
+	cli.PersistentFlags().StringVar(&keystoreFile, "keystore", KeystoreFile, "encrypted wallet keystore, used if "+WalletFile+" doesn't exist")
+	cli.PersistentFlags().IntVar(&passphraseFD, "passphrase-fd", -1, "file descriptor to read the keystore passphrase from (defaults to $"+keystorePassphraseEnv+" or the "+keystorePassphraseCredential+" systemd credential)")
+
+	cli.AddCommand(makeStoreCmd())
+	cli.AddCommand(makeWalletCmd())
+	cli.AddCommand(makeSignerCmd())
 
 	return cli
 }
 
+func makeStoreCmd() *cobra.Command {
+	store := &cobra.Command{
+		Use:   "store",
+		Short: "Inspect the cardano-node chain database",
+	}
+
+	verify := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the integrity of all immutable and volatile chunks",
+		RunE:  verifyStore,
+	}
+
+	verify.Flags().StringVar(&chainDBDir, "dir", "", "chain database directory (defaults to /var/cache/cardano-node/<network>)")
+
+	store.AddCommand(verify)
+
+	return store
+}
+
+func makeWalletCmd() *cobra.Command {
+	wallet := &cobra.Command{
+		Use:   "wallet",
+		Short: "Manage the encrypted wallet keystore",
+	}
+
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Generate a new mnemonic and store it in a new keystore",
+		RunE:  createWallet,
+	}
+
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Store an existing mnemonic in a new keystore",
+		RunE:  importWallet,
+	}
+
+	importCmd.Flags().StringVar(&importMnemonicFile, "mnemonic-file", "", "file containing the mnemonic, e.g. "+WalletFile+" (defaults to stdin)")
+
+	rotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "Re-encrypt the keystore with a new passphrase",
+		RunE:  rotateWallet,
+	}
+
+	rotate.Flags().IntVar(&newPassphraseFD, "new-passphrase-fd", -1, "file descriptor to read the new passphrase from (defaults to $"+keystoreNewPassphraseEnv+" or the "+keystoreNewPassphraseCredential+" systemd credential)")
+
+	export := &cobra.Command{
+		Use:   "export-public-keys",
+		Short: "Print the account public keys and stake addresses of the wallet",
+		RunE:  exportWalletPublicKeys,
+	}
+
+	export.Flags().Uint32Var(&exportPublicAccounts, "accounts", 1, "number of accounts to export")
+
+	for _, cmd := range []*cobra.Command{create, importCmd, rotate} {
+		cmd.Flags().StringVar(&keystoreKDF, "kdf", "argon2id", "key derivation function used to encrypt the keystore (argon2id or scrypt)")
+	}
+
+	wallet.AddCommand(create, importCmd, rotate, export)
+
+	return wallet
+}
+
+func makeSignerCmd() *cobra.Command {
+	signer := &cobra.Command{
+		Use:   "signer",
+		Short: "Run the process holding the wallet key",
+	}
+
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "Sign the txs of remote Iris processes, within the policy limits",
+		RunE:  serveSigner,
+	}
+
+	serve.Flags().StringVar(&signerListen, "listen", "unix:///run/cardano-iris-signer/signer.sock", "Unix socket (unix:///path) or TCP address (host:port, using mutual TLS) to listen on")
+	serve.Flags().IntSliceVar(&signerClientUIDs, "client-uid", nil, "user IDs of the Iris processes allowed to connect to the Unix socket")
+	serve.Flags().StringVar(&signerTLSCert, "tls-cert", "", "server certificate for mutual TLS")
+	serve.Flags().StringVar(&signerTLSKey, "tls-key", "", "server key for mutual TLS")
+	serve.Flags().StringVar(&signerClientCA, "client-ca", "", "CA of the client certificates for mutual TLS")
+	serve.Flags().Uint64Var(&signerMaxLovelace, "max-lovelace", 0, "maximum lovelace leaving the wallet per tx (0 for no limit)")
+
+	signer.AddCommand(serve)
+
+	return signer
+}
+
+func serveSigner(cmd *cobra.Command, args []string) error {
+	cfg := NewConfig()
+
+	if err := cfg.unlockWallet(keystoreFile, keystorePassphrase()); err != nil {
+		return err
+	}
+
+	if cfg.Wallet == nil {
+		return fmt.Errorf("no wallet configured in %s or %s", WalletFile, keystoreFile)
+	}
+
+	// the inputs of the txs are resolved using the signer's own connection to db-sync, not trusting the Iris processes
+	db, err := NewDB(cfg.NetworkName)
+	if err != nil {
+		return err
+	}
+
+	signer, err := NewLocalSigner(cfg.Wallet, cfg.NetworkName, SignerPolicy{MaxLovelace: signerMaxLovelace}, chainInputResolver(db, context.Background()))
+	if err != nil {
+		return err
+	}
+
+	listener, err := ListenSigner(signerListen, signerClientUIDs, signerTLSCert, signerTLSKey, signerClientCA)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("signer for %s listening on %s", signer.Address(), signerListen)
+
+	return http.Serve(listener, &SignerServer{signer})
+}
+
+func verifyStore(cmd *cobra.Command, args []string) error {
+	dir := chainDBDir
+	if dir == "" {
+		dir = NewConfig().ChainDBDir()
+	}
+
+	report, err := NewStoreVerifier(dir).Run()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(content))
+
+	if !report.OK() {
+		return fmt.Errorf("found %d missing chunks and %d problems", len(report.MissingChunks), len(report.Problems))
+	}
+
+	return nil
+}
+
 func serve(cmd *cobra.Command, args []string) error {
 	cfg := NewConfig()
+	cfg.BlockCacheSize = blockCacheSize * 1024 * 1024
+	cfg.NodeMempoolInterval = nodeMempoolInterval
+	cfg.TxEvaluator = txEvaluator
+	cfg.CollateralPoolSize = collateralPoolSize
+	cfg.CollateralLovelace = collateralLovelace
+	cfg.SignerPolicy = SignerPolicy{MaxLovelace: signerMaxLovelace}
+	cfg.RemoteSigner = remoteSigner
+	cfg.ReservationsFile = reservationsFile
+	cfg.WalletSigning = walletSigning
+
+	if err := cfg.unlockWallet(keystoreFile, keystorePassphrase()); err != nil {
+		return err
+	}
 
 	if useHTTP {
 		return serveHTTP(cfg)
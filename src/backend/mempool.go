@@ -21,6 +21,8 @@ type MempoolTx struct {
 	Tx          ledger.Transaction
 	SubmittedAt time.Time
 	TTL         time.Time
+	Attempts    int  // number of times the tx was submitted to the node, including retries and rebroadcasts
+	External    bool // submitted to the node by another client, and mirrored from the node's mempool
 }
 
 // Mempool holds recently submitted transactions.
@@ -28,11 +30,20 @@ type Mempool struct {
 	mu  sync.RWMutex
 	txs map[string]MempoolTx
 	db  *DB
+
+	// dependency graph, children spend outputs of their parents
+	graph *MempoolGraph
+
+	// read-only mirror of the txs in the node's mempool that weren't submitted through Iris, replaced by each snapshot
+	external map[string]MempoolTx
+
+	// hashes of all the txs in the latest snapshot of the node's mempool, nil if no snapshot was taken yet
+	inNode map[string]struct{}
 }
 
 // NewMempool creates an empty mempool instance.
 func NewMempool(db *DB) *Mempool {
-	return &Mempool{txs: make(map[string]MempoolTx), db: db}
+	return &Mempool{txs: make(map[string]MempoolTx), db: db, graph: NewMempoolGraph()}
 }
 
 // AddTx inserts a transaction into the mempool.
@@ -45,8 +56,26 @@ func (m *Mempool) AddTx(tx ledger.Transaction, ttl time.Time) {
 	if m.txs == nil {
 		m.txs = make(map[string]MempoolTx)
 	}
+	if m.graph == nil {
+		m.graph = NewMempoolGraph()
+	}
 	hash := tx.Hash().String()
 	m.txs[hash] = MempoolTx{Tx: tx, SubmittedAt: time.Now(), TTL: ttl}
+	m.linkLocked(hash, tx)
+}
+
+// RecordAttempts adds n to the number of submission attempts of a mempool tx, does nothing if the tx isn't in the mempool
+func (m *Mempool) RecordAttempts(txID string, n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mTx, ok := m.txs[txID]; ok {
+		mTx.Attempts += n
+		m.txs[txID] = mTx
+	}
 }
 
 // Returns nil if not found
@@ -58,6 +87,10 @@ func (m *Mempool) GetTx(txID string) ledger.Transaction {
 	defer m.mu.RUnlock()
 
 	mTx, ok := m.txs[txID]
+	if !ok {
+		mTx, ok = m.external[txID]
+	}
+
 	if !ok {
 		return nil
 	} else {
@@ -85,6 +118,8 @@ func (m *Mempool) GetUTXO(txID string, outputIndex int) (UTXO, bool) {
 }
 
 // prune removes expired or already confirmed transactions.
+// Expired transactions are evicted along with their descendants, because the outputs they spend will never exist.
+// The same happens to the descendants of confirmed transactions that are rolled back.
 func (m *Mempool) prune() {
 	if m == nil {
 		return
@@ -94,15 +129,20 @@ func (m *Mempool) prune() {
 
 	m.mu.Lock()
 
-	ids := make([]string, 0, len(m.txs))
 	for h, tx := range m.txs {
 		if !tx.TTL.IsZero() && now.After(tx.TTL) {
-			delete(m.txs, h)
-		} else {
-			ids = append(ids, h)
+			m.evictLocked(h)
 		}
 	}
 
+	ids := make([]string, 0, len(m.txs))
+	for h := range m.txs {
+		ids = append(ids, h)
+	}
+
+	// confirmed parents must remain on chain
+	ids = append(ids, m.graph.ConfirmedParents()...)
+
 	m.mu.Unlock()
 
 	if m.db == nil || len(ids) == 0 {
@@ -123,11 +163,187 @@ func (m *Mempool) prune() {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+
+	// rollbacks must be handled first, because the descendants of rolled back txs could be confirmed parents themselves
+	for _, id := range ids {
+		if _, ok := missSet[id]; ok {
+			for _, child := range m.graph.RolledBack(id) {
+				m.evictLocked(child)
+			}
+		}
+	}
+
 	for _, id := range ids {
 		if _, ok := missSet[id]; !ok {
-			delete(m.txs, id)
+			if _, ok := m.txs[id]; ok {
+				delete(m.txs, id)
+				m.graph.Confirm(id)
+			}
+		}
+	}
+}
+
+// MempoolConflict describes a mempool transaction spending an input that is also spent by a newly submitted transaction
+type MempoolConflict struct {
+	TxID     string `json:"txID"`
+	Input    string `json:"input"`    // <tx-id>#<output-index>
+	External bool   `json:"external"` // mirrored from the node's mempool, can't be replaced
+}
+
+// Conflicts returns the mempool transactions, including external ones, that spend any of the inputs of tx.
+// tx itself is ignored, so resubmitting a transaction doesn't conflict with itself.
+func (m *Mempool) Conflicts(tx ledger.Transaction) []MempoolConflict {
+	if m == nil {
+		return nil
+	}
+
+	hash := tx.Hash().String()
+
+	inputs := make(map[string]struct{})
+	for _, in := range tx.Consumed() {
+		inputs[inputKey(in)] = struct{}{}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	conflicts := []MempoolConflict{}
+
+	for _, txs := range []map[string]MempoolTx{m.txs, m.external} {
+		for h, mtx := range txs {
+			if h == hash {
+				continue
+			}
+
+			for _, in := range mtx.Tx.Consumed() {
+				key := inputKey(in)
+				if _, ok := inputs[key]; ok {
+					conflicts = append(conflicts, MempoolConflict{h, key, mtx.External})
+				}
+			}
 		}
 	}
+
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].TxID == conflicts[j].TxID {
+			return conflicts[i].Input < conflicts[j].Input
+		}
+
+		return conflicts[i].TxID < conflicts[j].TxID
+	})
+
+	return conflicts
+}
+
+// EvictTx removes a transaction, along with all the mempool transactions that spend its outputs (directly or indirectly).
+// Returns the hashes of the evicted transactions.
+func (m *Mempool) EvictTx(txID string) []string {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.evictLocked(txID)
+}
+
+// Ancestors returns the sorted hashes of the mempool transactions whose outputs are spent by txID, directly or indirectly.
+// Returns false if txID isn't in the mempool.
+func (m *Mempool) Ancestors(txID string) ([]string, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.txs[txID]; !ok {
+		return nil, false
+	}
+
+	return m.graph.Ancestors(txID), true
+}
+
+// Descendants returns the sorted hashes of the mempool transactions that spend outputs of txID, directly or indirectly.
+// Returns false if txID isn't in the mempool.
+func (m *Mempool) Descendants(txID string) ([]string, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.txs[txID]; !ok {
+		return nil, false
+	}
+
+	return m.graph.Descendants(txID), true
+}
+
+// adds the edges between tx and its parents and children that are already in the mempool
+func (m *Mempool) linkLocked(hash string, tx ledger.Transaction) {
+	for _, in := range tx.Consumed() {
+		parent := in.Id().String()
+		if _, ok := m.txs[parent]; ok && parent != hash {
+			m.graph.Link(parent, hash)
+		}
+	}
+
+	// children can be added before their parents when txs are resubmitted
+	for h, mtx := range m.txs {
+		if h == hash {
+			continue
+		}
+
+		for _, in := range mtx.Tx.Consumed() {
+			if in.Id().String() == hash {
+				m.graph.Link(hash, h)
+				break
+			}
+		}
+	}
+}
+
+// removes txID and all its descendants, returns the hashes of the evicted txs, starting with txID
+func (m *Mempool) evictLocked(txID string) []string {
+	if _, ok := m.txs[txID]; !ok {
+		return []string{}
+	}
+
+	evicted := append([]string{txID}, m.graph.Descendants(txID)...)
+
+	for _, id := range evicted {
+		delete(m.txs, id)
+	}
+
+	for _, id := range evicted {
+		m.graph.Remove(id)
+	}
+
+	return evicted
+}
+
+// SpentUTXOs returns the keys (<tx-hash><index>) of the UTXOs consumed by mempool transactions, including external ones.
+func (m *Mempool) SpentUTXOs() map[string]struct{} {
+	spent := make(map[string]struct{})
+	if m == nil {
+		return spent
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, txs := range []map[string]MempoolTx{m.txs, m.external} {
+		for _, mtx := range txs {
+			for _, cons := range mtx.Tx.Consumed() {
+				spent[fmt.Sprintf("%s%d", cons.Id().String(), cons.Index())] = struct{}{}
+			}
+		}
+	}
+
+	return spent
 }
 
 // Hashes returns the list of transaction hashes currently in the mempool.
@@ -168,7 +384,17 @@ func (m *Mempool) Overlay(base []UTXO, filter func(UTXO) bool) []UTXO {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	mtxs := make([]MempoolTx, 0, len(m.txs)+len(m.external))
 	for _, mtx := range m.txs {
+		mtxs = append(mtxs, mtx)
+	}
+
+	for _, mtx := range m.external {
+		mtxs = append(mtxs, mtx)
+	}
+
+	// all outputs must be added before removing the consumed ones, because mempool txs can spend each other's outputs
+	for _, mtx := range mtxs {
 		for _, prod := range mtx.Tx.Produced() {
 			u := ledgerUtxoToUTXO(prod)
 			key := fmt.Sprintf("%s%d", u.TxID, u.OutputIndex)
@@ -178,7 +404,9 @@ func (m *Mempool) Overlay(base []UTXO, filter func(UTXO) bool) []UTXO {
 				}
 			}
 		}
+	}
 
+	for _, mtx := range mtxs {
 		for _, cons := range mtx.Tx.Consumed() {
 			key := fmt.Sprintf("%s%d", cons.Id().String(), cons.Index())
 			delete(utxoMap, key)
@@ -193,6 +421,10 @@ func (m *Mempool) Overlay(base []UTXO, filter func(UTXO) bool) []UTXO {
 	return res
 }
 
+func inputKey(in common.TransactionInput) string {
+	return fmt.Sprintf("%s#%d", in.Id().String(), in.Index())
+}
+
 func isZeroHash(h common.Blake2b256) bool {
 	for _, b := range h {
 		if b != 0 {
@@ -263,4 +495,4 @@ func ledgerUtxoToUTXO(u common.Utxo) UTXO {
 func HashDatum(cbor []byte) string {
 	bs := blake2b.Sum256(cbor)
 	return hex.EncodeToString(bs[:])
-}
\ No newline at end of file
+}
@@ -3,9 +3,122 @@ package main
 import (
 	"encoding/hex"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
 )
 
+// only implements the methods used by the mempool conflict, dependency and inspection logic
+type mempoolTxStub struct {
+	ledger.Transaction
+	hash   common.Blake2b256
+	inputs []common.TransactionInput
+}
+
+func newMempoolTxStub(id byte, inputs ...string) mempoolTxStub {
+	tx := mempoolTxStub{}
+	tx.hash[0] = id
+
+	for _, in := range inputs {
+		parts := strings.Split(in, "#")
+
+		var index int
+		fmt.Sscanf(parts[1], "%d", &index)
+
+		tx.inputs = append(tx.inputs, shelley.NewShelleyTransactionInput(parts[0], index))
+	}
+
+	return tx
+}
+
+func (tx mempoolTxStub) Hash() common.Blake2b256 {
+	return tx.hash
+}
+
+func (tx mempoolTxStub) Consumed() []common.TransactionInput {
+	return tx.inputs
+}
+
+func (tx mempoolTxStub) Cbor() []byte {
+	return []byte{0x80, tx.hash[0]}
+}
+
+func (tx mempoolTxStub) Fee() uint64 {
+	return 170000
+}
+
+func (tx mempoolTxStub) Produced() []common.Utxo {
+	return nil
+}
+
+func stubTxID(id byte) string {
+	return newMempoolTxStub(id).Hash().String()
+}
+
+func TestMempoolConflicts(t *testing.T) {
+	external := strings.Repeat("ee", 32)
+
+	a := newMempoolTxStub(1, external+"#0")
+	b := newMempoolTxStub(2, stubTxID(1)+"#0")             // child of a
+	c := newMempoolTxStub(3, stubTxID(2)+"#1")             // grandchild of a
+	d := newMempoolTxStub(4, external+"#1")                // unrelated
+	e := newMempoolTxStub(5, external+"#0", external+"#1") // conflicts with a and d
+
+	m := NewMempool(nil)
+	ttl := time.Now().Add(time.Hour)
+	// the grandchild is added first, to check that it is linked once its parent arrives
+	for _, tx := range []mempoolTxStub{c, a, b, d} {
+		m.AddTx(tx, ttl)
+	}
+
+	conflicts := m.Conflicts(e)
+	expected := []MempoolConflict{
+		{stubTxID(1), external + "#0", false},
+		{stubTxID(4), external + "#1", false},
+	}
+
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Fatalf("expected conflicts %v, got %v", expected, conflicts)
+	}
+
+	// txs mirrored from the node's mempool conflict as well, but can't be replaced
+	f := newMempoolTxStub(6, external+"#2")
+	m.SetNodeTxs([]ledger.Transaction{f})
+
+	if conflicts := m.Conflicts(newMempoolTxStub(7, external+"#2")); !reflect.DeepEqual(conflicts, []MempoolConflict{{stubTxID(6), external + "#2", true}}) {
+		t.Errorf("expected a conflict with the external tx, got %v", conflicts)
+	}
+
+	if conflicts := m.Conflicts(a); len(conflicts) != 0 {
+		t.Errorf("resubmitting a tx shouldn't conflict with itself, got %v", conflicts)
+	}
+
+	if descendants, _ := m.Descendants(stubTxID(1)); !reflect.DeepEqual(descendants, []string{stubTxID(2), stubTxID(3)}) {
+		t.Errorf("expected txs 2 and 3 to descend from tx 1, got %v", descendants)
+	}
+
+	if ancestors, _ := m.Ancestors(stubTxID(3)); !reflect.DeepEqual(ancestors, []string{stubTxID(1), stubTxID(2)}) {
+		t.Errorf("expected txs 1 and 2 to be ancestors of tx 3, got %v", ancestors)
+	}
+
+	evicted := m.EvictTx(stubTxID(1))
+	sort.Strings(evicted)
+
+	if expected := []string{stubTxID(1), stubTxID(2), stubTxID(3)}; !reflect.DeepEqual(evicted, expected) {
+		t.Errorf("expected evicted %v, got %v", expected, evicted)
+	}
+
+	if hashes := m.Hashes(); !reflect.DeepEqual(hashes, []string{stubTxID(4)}) {
+		t.Errorf("expected only tx 4 to remain, got %v", hashes)
+	}
+}
+
 func TestHashDatum(t *testing.T) {
 	tests := []struct{
 		input string // hex encded 
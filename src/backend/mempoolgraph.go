@@ -0,0 +1,151 @@
+package main
+
+import (
+	"sort"
+)
+
+// MempoolGraph tracks the dependencies between mempool transactions: a child spends outputs of its parents.
+// It isn't thread-safe, and is protected by the mutex of the Mempool that owns it.
+type MempoolGraph struct {
+	parents  map[string]map[string]struct{}
+	children map[string]map[string]struct{}
+
+	// parents that left the mempool because they were confirmed on chain, keyed by child
+	// if such a parent is rolled back, its children spend outputs that no longer exist
+	confirmed map[string]map[string]struct{}
+}
+
+func NewMempoolGraph() *MempoolGraph {
+	return &MempoolGraph{
+		parents:   make(map[string]map[string]struct{}),
+		children:  make(map[string]map[string]struct{}),
+		confirmed: make(map[string]map[string]struct{}),
+	}
+}
+
+// Link adds an edge from parent to child
+func (g *MempoolGraph) Link(parent string, child string) {
+	addEdge(g.children, parent, child)
+	addEdge(g.parents, child, parent)
+}
+
+// Remove deletes all the edges of a tx
+func (g *MempoolGraph) Remove(txID string) {
+	for parent := range g.parents[txID] {
+		removeEdge(g.children, parent, txID)
+	}
+
+	for child := range g.children[txID] {
+		removeEdge(g.parents, child, txID)
+	}
+
+	delete(g.parents, txID)
+	delete(g.children, txID)
+	delete(g.confirmed, txID)
+}
+
+// Confirm removes a tx that was confirmed on chain, remembering it as a confirmed parent of its children
+func (g *MempoolGraph) Confirm(txID string) {
+	for child := range g.children[txID] {
+		addEdge(g.confirmed, child, txID)
+	}
+
+	g.Remove(txID)
+}
+
+// ConfirmedParents returns the unique confirmed parents of all pending txs
+func (g *MempoolGraph) ConfirmedParents() []string {
+	unique := make(map[string]struct{})
+	for _, parents := range g.confirmed {
+		for parent := range parents {
+			unique[parent] = struct{}{}
+		}
+	}
+
+	return sortedKeys(unique)
+}
+
+// RolledBack forgets a confirmed parent that is no longer on chain, and returns its former children
+func (g *MempoolGraph) RolledBack(txID string) []string {
+	children := []string{}
+
+	for child, parents := range g.confirmed {
+		if _, ok := parents[txID]; ok {
+			removeEdge(g.confirmed, child, txID)
+			children = append(children, child)
+		}
+	}
+
+	sort.Strings(children)
+
+	return children
+}
+
+// Parents returns the sorted hashes of the direct parents of a tx
+func (g *MempoolGraph) Parents(txID string) []string {
+	return sortedKeys(g.parents[txID])
+}
+
+// Children returns the sorted hashes of the direct children of a tx
+func (g *MempoolGraph) Children(txID string) []string {
+	return sortedKeys(g.children[txID])
+}
+
+// Ancestors returns the sorted hashes of all the direct and indirect parents of a tx
+func (g *MempoolGraph) Ancestors(txID string) []string {
+	return g.walk(g.parents, txID)
+}
+
+// Descendants returns the sorted hashes of all the direct and indirect children of a tx
+func (g *MempoolGraph) Descendants(txID string) []string {
+	return g.walk(g.children, txID)
+}
+
+func (g *MempoolGraph) walk(edges map[string]map[string]struct{}, txID string) []string {
+	visited := make(map[string]struct{})
+
+	for queue := []string{txID}; len(queue) > 0; queue = queue[1:] {
+		for next := range edges[queue[0]] {
+			if _, ok := visited[next]; !ok && next != txID {
+				visited[next] = struct{}{}
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return sortedKeys(visited)
+}
+
+func addEdge(edges map[string]map[string]struct{}, from string, to string) {
+	set, ok := edges[from]
+	if !ok {
+		set = make(map[string]struct{})
+		edges[from] = set
+	}
+
+	set[to] = struct{}{}
+}
+
+func removeEdge(edges map[string]map[string]struct{}, from string, to string) {
+	set, ok := edges[from]
+	if !ok {
+		return
+	}
+
+	delete(set, to)
+
+	if len(set) == 0 {
+		delete(edges, from)
+	}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMempoolGraph(t *testing.T) {
+	// a -> b -> c, a -> d, e -> d
+	g := NewMempoolGraph()
+	g.Link("a", "b")
+	g.Link("b", "c")
+	g.Link("a", "d")
+	g.Link("e", "d")
+
+	testCases := []struct {
+		name     string
+		got      []string
+		expected []string
+	}{
+		{"descendants of a", g.Descendants("a"), []string{"b", "c", "d"}},
+		{"descendants of c", g.Descendants("c"), []string{}},
+		{"ancestors of c", g.Ancestors("c"), []string{"a", "b"}},
+		{"ancestors of d", g.Ancestors("d"), []string{"a", "e"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tc.got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, tc.got)
+			}
+		})
+	}
+
+	g.Confirm("a")
+
+	if ancestors := g.Ancestors("d"); !reflect.DeepEqual(ancestors, []string{"e"}) {
+		t.Errorf("expected confirmed tx to be removed from ancestors, got %v", ancestors)
+	}
+
+	if parents := g.ConfirmedParents(); !reflect.DeepEqual(parents, []string{"a"}) {
+		t.Errorf("expected a to be a confirmed parent, got %v", parents)
+	}
+
+	if children := g.RolledBack("a"); !reflect.DeepEqual(children, []string{"b", "d"}) {
+		t.Errorf("expected b and d to be orphaned by rollback of a, got %v", children)
+	}
+
+	if parents := g.ConfirmedParents(); len(parents) != 0 {
+		t.Errorf("expected no more confirmed parents, got %v", parents)
+	}
+
+	g.Remove("b")
+
+	if descendants := g.Descendants("e"); !reflect.DeepEqual(descendants, []string{"d"}) {
+		t.Errorf("expected only d to descend from e, got %v", descendants)
+	}
+
+	if ancestors := g.Ancestors("c"); len(ancestors) != 0 {
+		t.Errorf("expected c to have no ancestors after removal of b, got %v", ancestors)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// MempoolTxDetails is the JSON representation of a mempool tx returned by the mempool inspection endpoints
+type MempoolTxDetails struct {
+	TxID          string    `json:"txID"`
+	CBORHex       string    `json:"cborHex"`
+	Size          int       `json:"size"` // number of CBOR bytes
+	Fee           string    `json:"fee"`
+	Inputs        []string  `json:"inputs"` // <tx-id>#<output-index>
+	Outputs       []UTXO    `json:"outputs"`
+	SubmittedAt   time.Time `json:"submittedAt"`
+	TTL           time.Time `json:"ttl"` // the tx is evicted from the mempool after this time
+	Attempts      int       `json:"attempts"`
+	Parents       []string  `json:"parents"`  // mempool txs spent by this tx
+	Children      []string  `json:"children"` // mempool txs spending this tx
+	External      bool      `json:"external"` // submitted by another client, mirrored from the node's mempool
+	PendingReason string    `json:"pendingReason"`
+}
+
+// Details returns false if txID isn't in the mempool
+func (m *Mempool) Details(txID string) (MempoolTxDetails, bool) {
+	if m == nil {
+		return MempoolTxDetails{}, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mTx, ok := m.txs[txID]
+	if !ok {
+		mTx, ok = m.external[txID]
+	}
+
+	if !ok {
+		return MempoolTxDetails{}, false
+	}
+
+	return m.detailsLocked(txID, mTx), true
+}
+
+// AllDetails returns the details of all mempool txs, including those mirrored from the node, sorted by hash
+func (m *Mempool) AllDetails() []MempoolTxDetails {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	details := make([]MempoolTxDetails, 0, len(m.txs)+len(m.external))
+	for h, mTx := range m.txs {
+		details = append(details, m.detailsLocked(h, mTx))
+	}
+
+	for h, mTx := range m.external {
+		details = append(details, m.detailsLocked(h, mTx))
+	}
+
+	sort.Slice(details, func(i, j int) bool { return details[i].TxID < details[j].TxID })
+
+	return details
+}
+
+func (m *Mempool) detailsLocked(txID string, mTx MempoolTx) MempoolTxDetails {
+	tx := mTx.Tx
+
+	inputs := []string{}
+	for _, in := range tx.Consumed() {
+		inputs = append(inputs, inputKey(in))
+	}
+
+	outputs := []UTXO{}
+	for _, prod := range tx.Produced() {
+		outputs = append(outputs, ledgerUtxoToUTXO(prod))
+	}
+
+	parents := m.graph.Parents(txID)
+
+	_, inNode := m.inNode[txID]
+
+	pendingReason := "waiting to be included in a block"
+	if mTx.External {
+		pendingReason = "submitted to the node by another client, waiting to be included in a block"
+	} else if m.inNode != nil && !inNode {
+		pendingReason = "not in the node's mempool"
+	} else if len(parents) > 0 {
+		pendingReason = "waiting for parent txs to be included in a block"
+	}
+
+	return MempoolTxDetails{
+		TxID:          txID,
+		CBORHex:       hex.EncodeToString(tx.Cbor()),
+		Size:          len(tx.Cbor()),
+		Fee:           strconv.FormatUint(tx.Fee(), 10),
+		Inputs:        inputs,
+		Outputs:       outputs,
+		SubmittedAt:   mTx.SubmittedAt,
+		TTL:           mTx.TTL,
+		Attempts:      mTx.Attempts,
+		Parents:       parents,
+		Children:      m.graph.Children(txID),
+		External:      mTx.External,
+		PendingReason: pendingReason,
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMempoolDetails(t *testing.T) {
+	external := strings.Repeat("ee", 32)
+
+	m := NewMempool(nil)
+	ttl := time.Now().Add(time.Hour)
+	m.AddTx(newMempoolTxStub(1, external+"#0"), ttl)
+	m.AddTx(newMempoolTxStub(2, stubTxID(1)+"#0"), ttl)
+	m.RecordAttempts(stubTxID(2), 2)
+
+	details, ok := m.Details(stubTxID(2))
+	if !ok {
+		t.Fatalf("expected tx 2 to be found")
+	}
+
+	if details.Size != 2 || details.Fee != "170000" || details.Attempts != 2 || !details.TTL.Equal(ttl) {
+		t.Errorf("unexpected details %#v", details)
+	}
+
+	if !reflect.DeepEqual(details.Inputs, []string{stubTxID(1) + "#0"}) || !reflect.DeepEqual(details.Parents, []string{stubTxID(1)}) {
+		t.Errorf("unexpected inputs %v or parents %v", details.Inputs, details.Parents)
+	}
+
+	if !strings.Contains(details.PendingReason, "parent") {
+		t.Errorf("expected pending reason to mention the parent tx, got %q", details.PendingReason)
+	}
+
+	all := m.AllDetails()
+	if len(all) != 2 || all[0].TxID != stubTxID(1) || !reflect.DeepEqual(all[0].Children, []string{stubTxID(2)}) {
+		t.Errorf("unexpected details of all txs %#v", all)
+	}
+
+	if _, ok := m.Details(stubTxID(3)); ok {
+		t.Errorf("expected tx 3 not to be found")
+	}
+}
@@ -0,0 +1,736 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/echovl/cardano-go/crypto"
+)
+
+const (
+	// pending multisig txs are forgotten after this duration, whatever their status
+	multisigRetention = 24 * time.Hour
+
+	// limits the memory used by registered txs
+	multisigMaxPending = 1000
+
+	// registrations are unauthenticated, a single client can't take all the slots
+	multisigMaxPendingPerClient = 20
+)
+
+// statuses of multisig txs
+const (
+	multisigPending   = "pending"
+	multisigSubmitted = "submitted"
+	multisigFailed    = "failed"
+)
+
+// NativeScript is a decoded timelock script, the native scripts of gouroboros don't keep their content
+type NativeScript struct {
+	Type    uint
+	KeyHash string         // type 0
+	Scripts []NativeScript // types 1, 2 and 3
+	N       uint           // type 3
+	Slot    uint64         // types 4 and 5
+	Hash    string
+}
+
+// MultisigTx is a registered tx collecting the witnesses of its co-signers
+type MultisigTx struct {
+	tx        ledger.Transaction
+	required  map[string]struct{} // key hashes that must sign, besides the native scripts
+	scripts   []NativeScript      // native scripts in the witness set
+	status    string
+	err       string
+	message   string
+	client    string // IP address of the client that registered the tx
+	createdAt time.Time
+}
+
+type MultisigStatus struct {
+	TxID      string                 `json:"txID"`
+	CBORHex   string                 `json:"cborHex"` // including the witnesses collected so far
+	Status    string                 `json:"status"`  // pending, submitted or failed
+	Required  []string               `json:"required"`
+	Signers   []string               `json:"signers"`
+	Missing   []string               `json:"missing"` // required signers that haven't signed yet
+	Scripts   []MultisigScriptStatus `json:"scripts"`
+	Message   string                 `json:"message,omitempty"` // of the node, once submitted
+	Error     string                 `json:"error,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+type MultisigScriptStatus struct {
+	Hash      string   `json:"hash"`
+	Signers   []string `json:"signers"` // key hashes appearing in the script
+	Satisfied bool     `json:"satisfied"`
+}
+
+type MultisigWitnessRequest struct {
+	Witness string `json:"witness"` // CBOR hex of the vkey witness
+	CBORHex string `json:"cborHex"` // alternatively, a cardano-cli witness file
+}
+
+// MultisigCoordinator keeps the registered multisig txs, keyed by tx hash
+type MultisigCoordinator struct {
+	mu  sync.Mutex
+	txs map[string]*MultisigTx
+}
+
+func NewMultisigCoordinator() *MultisigCoordinator {
+	return &MultisigCoordinator{txs: make(map[string]*MultisigTx)}
+}
+
+func decodeNativeScript(data []byte) (NativeScript, error) {
+	var items []cbor.RawMessage
+	if _, err := cbor.Decode(data, &items); err != nil {
+		return NativeScript{}, err
+	}
+
+	if len(items) < 2 {
+		return NativeScript{}, errors.New("native script isn't a list with at least 2 entries")
+	}
+
+	script := NativeScript{Hash: common.Blake2b224Hash(append([]byte{0}, data...)).String()}
+	if _, err := cbor.Decode(items[0], &script.Type); err != nil {
+		return NativeScript{}, err
+	}
+
+	decodeScripts := func(data []byte) error {
+		var scripts []cbor.RawMessage
+		if _, err := cbor.Decode(data, &scripts); err != nil {
+			return err
+		}
+
+		for _, s := range scripts {
+			sub, err := decodeNativeScript(s)
+			if err != nil {
+				return err
+			}
+
+			script.Scripts = append(script.Scripts, sub)
+		}
+
+		return nil
+	}
+
+	var err error
+
+	switch script.Type {
+	case 0:
+		var keyHash []byte
+		if _, err = cbor.Decode(items[1], &keyHash); err == nil {
+			script.KeyHash = hex.EncodeToString(keyHash)
+		}
+	case 1, 2:
+		err = decodeScripts(items[1])
+	case 3:
+		if len(items) != 3 {
+			return NativeScript{}, errors.New("n-of-k native script isn't a list with 3 entries")
+		}
+
+		if _, err = cbor.Decode(items[1], &script.N); err == nil {
+			err = decodeScripts(items[2])
+		}
+	case 4, 5:
+		_, err = cbor.Decode(items[1], &script.Slot)
+	default:
+		return NativeScript{}, fmt.Errorf("unknown native script type %d", script.Type)
+	}
+
+	if err != nil {
+		return NativeScript{}, fmt.Errorf("invalid native script (%w)", err)
+	}
+
+	return script, nil
+}
+
+// Satisfied evaluates the script like the ledger, given the key hashes of the vkey witnesses and the validity interval of the tx (0 if unset)
+func (s NativeScript) Satisfied(signers map[string]struct{}, validityStart uint64, ttl uint64) bool {
+	switch s.Type {
+	case 0:
+		_, ok := signers[s.KeyHash]
+		return ok
+	case 1:
+		for _, sub := range s.Scripts {
+			if !sub.Satisfied(signers, validityStart, ttl) {
+				return false
+			}
+		}
+
+		return true
+	case 2, 3:
+		n := uint(1)
+		if s.Type == 3 {
+			n = s.N
+		}
+
+		count := uint(0)
+		for _, sub := range s.Scripts {
+			if sub.Satisfied(signers, validityStart, ttl) {
+				count++
+			}
+		}
+
+		return count >= n
+	case 4:
+		return validityStart != 0 && validityStart >= s.Slot
+	case 5:
+		return ttl != 0 && ttl <= s.Slot
+	default:
+		return false
+	}
+}
+
+// KeyHashes returns the key hashes appearing in the script
+func (s NativeScript) KeyHashes() []string {
+	if s.Type == 0 {
+		return []string{s.KeyHash}
+	}
+
+	hashes := []string{}
+	for _, sub := range s.Scripts {
+		hashes = append(hashes, sub.KeyHashes()...)
+	}
+
+	return hashes
+}
+
+// returns the native scripts of the witness set of the tx
+func txNativeScripts(tx ledger.Transaction) ([]NativeScript, error) {
+	items, err := splitTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var witnessSet map[uint]cbor.RawMessage
+	if _, err := cbor.Decode(items[1], &witnessSet); err != nil {
+		return nil, err
+	}
+
+	raw, ok := witnessSet[1]
+	if !ok {
+		return []NativeScript{}, nil
+	}
+
+	// the list might be tagged as a set
+	var tagged cbor.RawTag
+	if _, err := cbor.Decode(raw, &tagged); err == nil {
+		raw = tagged.Content
+	}
+
+	var rawScripts []cbor.RawMessage
+	if _, err := cbor.Decode(raw, &rawScripts); err != nil {
+		return nil, err
+	}
+
+	scripts := []NativeScript{}
+	for _, s := range rawScripts {
+		script, err := decodeNativeScript(s)
+		if err != nil {
+			return nil, err
+		}
+
+		scripts = append(scripts, script)
+	}
+
+	return scripts, nil
+}
+
+// decodes a vkey witness, or the [0, witness] pair of cardano-cli witness files
+func decodeVkeyWitness(data []byte) (common.VkeyWitness, error) {
+	var items []cbor.RawMessage
+	if _, err := cbor.Decode(data, &items); err != nil {
+		return common.VkeyWitness{}, err
+	}
+
+	var witnessType uint
+	if len(items) == 2 {
+		if _, err := cbor.Decode(items[0], &witnessType); err == nil && witnessType == 0 {
+			data = items[1]
+		}
+	}
+
+	var witness common.VkeyWitness
+	if _, err := cbor.Decode(data, &witness); err != nil {
+		return common.VkeyWitness{}, err
+	}
+
+	if len(witness.Vkey) != 32 || len(witness.Signature) != 64 {
+		return common.VkeyWitness{}, errors.New("invalid vkey witness")
+	}
+
+	return witness, nil
+}
+
+func txSigners(tx ledger.Transaction) map[string]struct{} {
+	signers := make(map[string]struct{})
+	if ws := tx.Witnesses(); ws != nil {
+		for _, w := range ws.Vkey() {
+			signers[common.Blake2b224Hash(w.Vkey).String()] = struct{}{}
+		}
+	}
+
+	return signers
+}
+
+// Register adds a tx, required contains the key hashes that must sign it besides the native scripts.
+// The number of txs registered by the same client is limited.
+func (c *MultisigCoordinator) Register(tx ledger.Transaction, required map[string]struct{}, client string, now time.Time) (*MultisigTx, error) {
+	scripts, err := txNativeScripts(tx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid native scripts (%w)", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(now)
+
+	txID := tx.Hash().String()
+	if mtx, ok := c.txs[txID]; ok {
+		return mtx, nil
+	}
+
+	if len(c.txs) >= multisigMaxPending {
+		return nil, errors.New("too many pending multisig txs")
+	}
+
+	count := 0
+	for _, mtx := range c.txs {
+		if mtx.client == client {
+			count++
+		}
+	}
+
+	if count >= multisigMaxPendingPerClient {
+		return nil, fmt.Errorf("too many pending multisig txs registered by the client (at most %d)", multisigMaxPendingPerClient)
+	}
+
+	mtx := &MultisigTx{tx: tx, required: required, scripts: scripts, status: multisigPending, client: client, createdAt: now}
+	c.txs[txID] = mtx
+
+	return mtx, nil
+}
+
+func (c *MultisigCoordinator) Get(txID string, now time.Time) (*MultisigTx, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(now)
+
+	mtx, ok := c.txs[txID]
+
+	return mtx, ok
+}
+
+func (c *MultisigCoordinator) prune(now time.Time) {
+	for txID, mtx := range c.txs {
+		if now.Sub(mtx.createdAt) > multisigRetention {
+			delete(c.txs, txID)
+		}
+	}
+}
+
+// AddWitness checks that the witness signs the tx and belongs to a required signer or a key of the native scripts, and inserts it.
+// Adding the witness of a key that already signed has no effect.
+func (c *MultisigCoordinator) AddWitness(mtx *MultisigTx, witness common.VkeyWitness) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if mtx.status != multisigPending {
+		return fmt.Errorf("tx is already %s", mtx.status)
+	}
+
+	keyHash := common.Blake2b224Hash(witness.Vkey).String()
+
+	if !mtx.expects(keyHash) {
+		return fmt.Errorf("key %s isn't a signer of the tx", keyHash)
+	}
+
+	if !crypto.PubKey(witness.Vkey).Verify(mtx.tx.Hash().Bytes(), witness.Signature) {
+		return errors.New("invalid signature")
+	}
+
+	if _, ok := txSigners(mtx.tx)[keyHash]; ok {
+		return nil
+	}
+
+	tx, _, err := insertVkeyWitness(mtx.tx, witness)
+	if err != nil {
+		return err
+	}
+
+	mtx.tx = tx
+
+	return nil
+}
+
+func (mtx *MultisigTx) expects(keyHash string) bool {
+	if _, ok := mtx.required[keyHash]; ok {
+		return true
+	}
+
+	for _, script := range mtx.scripts {
+		for _, h := range script.KeyHashes() {
+			if h == keyHash {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Complete returns true once all required signers signed, and all native scripts are satisfied
+func (mtx *MultisigTx) Complete() bool {
+	status := mtx.Status()
+	if len(status.Missing) > 0 {
+		return false
+	}
+
+	for _, s := range status.Scripts {
+		if !s.Satisfied {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (mtx *MultisigTx) Status() MultisigStatus {
+	signers := txSigners(mtx.tx)
+
+	status := MultisigStatus{
+		TxID:      mtx.tx.Hash().String(),
+		CBORHex:   hex.EncodeToString(mtx.tx.Cbor()),
+		Status:    mtx.status,
+		Required:  []string{},
+		Signers:   []string{},
+		Missing:   []string{},
+		Scripts:   []MultisigScriptStatus{},
+		Message:   mtx.message,
+		Error:     mtx.err,
+		CreatedAt: mtx.createdAt,
+	}
+
+	for keyHash := range signers {
+		status.Signers = append(status.Signers, keyHash)
+	}
+
+	for keyHash := range mtx.required {
+		status.Required = append(status.Required, keyHash)
+
+		if _, ok := signers[keyHash]; !ok {
+			status.Missing = append(status.Missing, keyHash)
+		}
+	}
+
+	sort.Strings(status.Signers)
+	sort.Strings(status.Required)
+	sort.Strings(status.Missing)
+
+	for _, script := range mtx.scripts {
+		status.Scripts = append(status.Scripts, MultisigScriptStatus{
+			Hash:      script.Hash,
+			Signers:   script.KeyHashes(),
+			Satisfied: script.Satisfied(signers, mtx.tx.ValidityIntervalStart(), mtx.tx.TTL()),
+		})
+	}
+
+	return status
+}
+
+func (c *MultisigCoordinator) setResult(mtx *MultisigTx, message string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		mtx.status = multisigFailed
+		mtx.err = err.Error()
+	} else {
+		mtx.status = multisigSubmitted
+		mtx.message = message
+	}
+}
+
+// Retry sets a failed tx back to pending, so that it can be submitted again, e.g. once its inputs are on chain
+func (c *MultisigCoordinator) Retry(mtx *MultisigTx) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if mtx.status == multisigSubmitted {
+		return errors.New("tx is already submitted")
+	}
+
+	mtx.status = multisigPending
+	mtx.err = ""
+
+	return nil
+}
+
+func (c *MultisigCoordinator) status(mtx *MultisigTx) MultisigStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return mtx.Status()
+}
+
+func (h *Handler) multisig(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	txID, url := url.Pop()
+
+	if txID == "" {
+		if r.Method == "POST" {
+			h.registerMultisigTx(w, r)
+		} else {
+			invalidMethod(w, r)
+		}
+
+		return
+	}
+
+	cmp, url := url.Pop()
+
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	switch cmp {
+	case "":
+		if r.Method != "GET" {
+			invalidMethod(w, r)
+			return
+		}
+
+		h.multisigStatus(w, txID)
+	case "witness":
+		if r.Method != "POST" {
+			invalidMethod(w, r)
+			return
+		}
+
+		h.addMultisigWitness(w, r, txID)
+	case "submit":
+		if r.Method != "POST" {
+			invalidMethod(w, r)
+			return
+		}
+
+		h.resubmitMultisigTx(w, r, txID)
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
+// read query, only the coordinator is modified
+func (h *Handler) registerMultisigTx(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	txBytes, err := parseTxBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid tx: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	resolved, ok := h.resolveTxInputs(w, r, tx)
+	if !ok {
+		return
+	}
+
+	utxos := make(map[string]UTXO)
+	for _, utxo := range resolved {
+		utxos[fmt.Sprintf("%s#%d", utxo.TxID, utxo.OutputIndex)] = utxo
+	}
+
+	mtx, err := h.multisigTxs.Register(tx, requiredSigners(tx, utxos), multisigClient(r), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	respondWithJSONWithStatus(w, h.multisigTxs.status(mtx), http.StatusCreated)
+}
+
+// read query
+func (h *Handler) multisigStatus(w http.ResponseWriter, txID string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	mtx, ok := h.multisigTxs.Get(txID, time.Now())
+	if !ok {
+		http.Error(w, "multisig tx not found", http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, h.multisigTxs.status(mtx))
+}
+
+// adds the witness of a co-signer, and submits the tx once complete
+func (h *Handler) addMultisigWitness(w http.ResponseWriter, r *http.Request, txID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mtx, ok := h.multisigTxs.Get(txID, time.Now())
+	if !ok {
+		http.Error(w, "multisig tx not found", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	witnessBytes, err := parseWitnessBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	witness, err := decodeVkeyWitness(witnessBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid witness: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.multisigTxs.AddWitness(mtx, witness); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.multisigTxs.status(mtx).Status == multisigPending && mtx.Complete() {
+		message, err := h.submitMultisigTx(r, mtx.tx)
+		if err != nil {
+			log.Printf("failed to submit multisig tx %s (%v)", txID, err)
+		}
+
+		h.multisigTxs.setResult(mtx, message, err)
+	}
+
+	respondWithJSON(w, h.multisigTxs.status(mtx))
+}
+
+// submits a complete tx again after a failed submission
+func (h *Handler) resubmitMultisigTx(w http.ResponseWriter, r *http.Request, txID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mtx, ok := h.multisigTxs.Get(txID, time.Now())
+	if !ok {
+		http.Error(w, "multisig tx not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.multisigTxs.Retry(mtx); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !mtx.Complete() {
+		http.Error(w, "tx is still missing witnesses", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.submitMultisigTx(r, mtx.tx)
+	if err != nil {
+		log.Printf("failed to resubmit multisig tx %s (%v)", txID, err)
+	}
+
+	h.multisigTxs.setResult(mtx, message, err)
+
+	respondWithJSON(w, h.multisigTxs.status(mtx))
+}
+
+func (h *Handler) submitMultisigTx(r *http.Request, tx ledger.Transaction) (string, error) {
+	if conflicts := h.mempool.Conflicts(tx); len(conflicts) > 0 {
+		return "", fmt.Errorf("tx spends inputs already spent by mempool tx %s", conflicts[0].TxID)
+	}
+
+	validator, err := h.newTxValidator(r.Context())
+	if err != nil {
+		return "", err
+	}
+
+	if verr, err := validator.Validate(tx); err != nil {
+		return "", err
+	} else if verr != nil {
+		return "", errors.New(verr.Raw)
+	}
+
+	message, _, err := h.submitValidatedTx(tx, nil)
+
+	return message, err
+}
+
+// clients are identified by their IP address, not by a header they could change for every request
+func multisigClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// accepts the CBOR of the witness, its hex encoding, or a JSON object with either the hex encoded witness or the cborHex of a cardano-cli witness file
+func parseWitnessBody(contentType string, body []byte) ([]byte, error) {
+	switch contentType {
+	case "application/cbor":
+		return body, nil
+	case "application/json":
+		var req MultisigWitnessRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+
+		witnessHex := req.Witness
+		if witnessHex == "" {
+			witnessHex = req.CBORHex
+		}
+
+		return hex.DecodeString(witnessHex)
+	default:
+		if !utf8.Valid(body) {
+			return nil, errors.New("request body isn't valid utf-8")
+		}
+
+		witnessBytes, err := hex.DecodeString(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+
+		return witnessBytes, nil
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+func TestNativeScript(t *testing.T) {
+	keyHashes := [][]byte{}
+	for seed := byte(1); seed <= 3; seed++ {
+		_, addr := newValidatorTestKey(seed)
+		keyHash := addr.PaymentKeyHash()
+		keyHashes = append(keyHashes, keyHash[:])
+	}
+
+	pubkeys := []any{}
+	for _, kh := range keyHashes {
+		pubkeys = append(pubkeys, []any{0, kh})
+	}
+
+	signers := func(indices ...int) map[string]struct{} {
+		res := make(map[string]struct{})
+		for _, i := range indices {
+			res[common.Blake2b224(keyHashes[i]).String()] = struct{}{}
+		}
+		return res
+	}
+
+	testCases := []struct {
+		name          string
+		script        any
+		signers       map[string]struct{}
+		validityStart uint64
+		ttl           uint64
+		satisfied     bool
+	}{
+		{"TwoOfThree", []any{3, 2, pubkeys}, signers(0, 2), 0, 0, true},
+		{"OneOfTwoOfThree", []any{3, 2, pubkeys}, signers(1), 0, 0, false},
+		{"All", []any{1, pubkeys}, signers(0, 1), 0, 0, false},
+		{"Any", []any{2, pubkeys}, signers(1), 0, 0, true},
+		{"AnyWithoutSigners", []any{2, pubkeys}, signers(), 0, 0, false},
+		{"InvalidBefore", []any{1, []any{pubkeys[0], []any{4, 100}}}, signers(0), 150, 0, true},
+		{"InvalidBeforeTooEarly", []any{1, []any{pubkeys[0], []any{4, 100}}}, signers(0), 50, 0, false},
+		{"InvalidHereafter", []any{5, 100}, signers(), 0, 100, true},
+		{"InvalidHereafterWithoutTTL", []any{5, 100}, signers(), 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := cbor.Encode(tc.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			script, err := decodeNativeScript(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if satisfied := script.Satisfied(tc.signers, tc.validityStart, tc.ttl); satisfied != tc.satisfied {
+				t.Errorf("expected satisfied %v, got %v", tc.satisfied, satisfied)
+			}
+		})
+	}
+}
+
+func TestMultisigCoordinator(t *testing.T) {
+	keys := []ed25519.PrivateKey{}
+	pubkeys := []any{}
+	for seed := byte(1); seed <= 3; seed++ {
+		key, addr := newValidatorTestKey(seed)
+		keyHash := addr.PaymentKeyHash()
+		keys = append(keys, key)
+		pubkeys = append(pubkeys, []any{0, keyHash[:]})
+	}
+
+	outsider, _ := newValidatorTestKey(4)
+	_, otherAddr := newValidatorTestKey(5)
+
+	body := validatorTestBody{
+		inputs:  []common.TransactionInput{shelley.NewShelleyTransactionInput(strings.Repeat("aa", 32), 0)},
+		outputs: []validatorTestOutput{{otherAddr, 2000000}},
+		fee:     200000,
+		ttl:     2000,
+	}
+
+	txBytes, err := cbor.Encode([]any{body.encoded(), map[uint]any{1: []any{[]any{3, 2, pubkeys}}}, true, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(key ed25519.PrivateKey) common.VkeyWitness {
+		hash := tx.Hash()
+		return common.VkeyWitness{Vkey: key.Public().(ed25519.PublicKey), Signature: ed25519.Sign(key, hash[:])}
+	}
+
+	coordinator := NewMultisigCoordinator()
+	now := time.Now()
+
+	mtx, err := coordinator.Register(tx, map[string]struct{}{}, "192.0.2.1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := mtx.Status(); len(status.Scripts) != 1 || len(status.Scripts[0].Signers) != 3 || status.Scripts[0].Satisfied {
+		t.Fatalf("unexpected status %#v", status)
+	}
+
+	if err := coordinator.AddWitness(mtx, sign(outsider)); err == nil {
+		t.Errorf("expected witness of a key outside the script to be rejected")
+	}
+
+	forged := sign(keys[0])
+	forged.Signature = sign(keys[1]).Signature
+	if err := coordinator.AddWitness(mtx, forged); err == nil {
+		t.Errorf("expected invalid signature to be rejected")
+	}
+
+	if err := coordinator.AddWitness(mtx, sign(keys[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	// adding the same witness twice has no effect
+	if err := coordinator.AddWitness(mtx, sign(keys[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	if mtx.Complete() || len(mtx.Status().Signers) != 1 {
+		t.Fatalf("expected 1 of 2 signatures, got %v", mtx.Status().Signers)
+	}
+
+	// cardano-cli witness files contain [0, witness]
+	witnessBytes, err := cbor.Encode([]any{0, sign(keys[2])})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	witness, err := decodeVkeyWitness(witnessBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := coordinator.AddWitness(mtx, witness); err != nil {
+		t.Fatal(err)
+	}
+
+	if !mtx.Complete() {
+		t.Fatalf("expected threshold to be met, got %#v", mtx.Status())
+	}
+
+	if mtx.tx.Hash() != tx.Hash() {
+		t.Errorf("adding witnesses changed the tx body")
+	}
+
+	if again, err := coordinator.Register(tx, nil, "192.0.2.1", now); err != nil || again != mtx {
+		t.Errorf("expected registering the same tx to return the pending tx")
+	}
+
+	// a failed submission can be retried
+	coordinator.setResult(mtx, "", errors.New("input not found"))
+
+	if err := coordinator.Retry(mtx); err != nil || mtx.Status().Status != multisigPending || mtx.Status().Error != "" {
+		t.Errorf("expected failed tx to be pending again, got %v", err)
+	}
+
+	coordinator.setResult(mtx, "", nil)
+
+	if err := coordinator.Retry(mtx); err == nil {
+		t.Errorf("expected submitted tx not to be retried")
+	}
+
+	if err := coordinator.AddWitness(mtx, sign(keys[1])); err == nil {
+		t.Errorf("expected witnesses to be rejected once submitted")
+	}
+
+	if _, ok := coordinator.Get(tx.Hash().String(), now.Add(multisigRetention+time.Minute)); ok {
+		t.Errorf("expected tx to be forgotten after the retention period")
+	}
+}
+
+func TestMultisigClientLimit(t *testing.T) {
+	_, addr := newValidatorTestKey(1)
+
+	input := shelley.NewShelleyTransactionInput(strings.Repeat("aa", 32), 0)
+
+	coordinator := NewMultisigCoordinator()
+	now := time.Now()
+
+	register := func(ttl uint64, client string) error {
+		body := validatorTestBody{
+			inputs:  []common.TransactionInput{input},
+			outputs: []validatorTestOutput{{addr, 2000000}},
+			fee:     200000,
+			ttl:     ttl,
+		}
+
+		_, err := coordinator.Register(encodeValidatorTestTx(t, body, nil), nil, client, now)
+		return err
+	}
+
+	for i := range multisigMaxPendingPerClient {
+		if err := register(uint64(1000+i), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := register(999, "192.0.2.1"); err == nil {
+		t.Errorf("expected the client limit to be enforced")
+	}
+
+	if err := register(999, "192.0.2.2"); err != nil {
+		t.Errorf("expected another client to register txs, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	ouroboros "github.com/blinklabs-io/gouroboros"
+	"github.com/blinklabs-io/gouroboros/ledger"
+)
+
+// MirrorNode periodically snapshots the node's mempool using the LocalTxMonitor mini-protocol, and never returns
+func (m *Mempool) MirrorNode(socketPath string, networkMagic uint32, interval time.Duration) {
+	failing := false
+
+	for {
+		txs, err := snapshotNodeMempool(socketPath, networkMagic)
+		if err != nil {
+			// only log the first failure of a series, the node might be restarting
+			if !failing {
+				log.Printf("failed to snapshot the node's mempool, retrying every %v (%v)", interval, err)
+			}
+		} else {
+			if failing {
+				log.Printf("resumed snapshotting the node's mempool")
+			}
+
+			m.SetNodeTxs(txs)
+		}
+
+		failing = err != nil
+
+		time.Sleep(interval)
+	}
+}
+
+// SetNodeTxs replaces the mirror of the node's mempool.
+// Txs submitted through Iris are kept as is, the others are tracked as external txs.
+func (m *Mempool) SetNodeTxs(txs []ledger.Transaction) {
+	if m == nil {
+		return
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	external := make(map[string]MempoolTx)
+	inNode := make(map[string]struct{}, len(txs))
+
+	for _, tx := range txs {
+		hash := tx.Hash().String()
+		inNode[hash] = struct{}{}
+
+		if _, ok := m.txs[hash]; ok {
+			continue
+		}
+
+		// keep the time at which the tx was first seen
+		submittedAt := now
+		if prev, ok := m.external[hash]; ok {
+			submittedAt = prev.SubmittedAt
+		}
+
+		external[hash] = MempoolTx{Tx: tx, SubmittedAt: submittedAt, External: true}
+	}
+
+	m.external = external
+	m.inNode = inNode
+}
+
+func snapshotNodeMempool(socketPath string, networkMagic uint32) ([]ledger.Transaction, error) {
+	conn, err := ouroboros.NewConnection(
+		ouroboros.WithNetworkMagic(networkMagic),
+		ouroboros.WithNodeToNode(false),
+		ouroboros.WithKeepAlive(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Dial("unix", socketPath); err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	client := conn.LocalTxMonitor().Client
+
+	if err := client.Acquire(); err != nil {
+		return nil, err
+	}
+
+	txs := []ledger.Transaction{}
+
+	for {
+		txBytes, err := client.NextTx()
+		if err != nil {
+			return nil, err
+		}
+
+		// the end of the snapshot is signaled by an empty reply
+		if txBytes == nil {
+			break
+		}
+
+		tx, err := decodeTx(txBytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode node mempool tx: %w", err)
+		}
+
+		txs = append(txs, tx)
+	}
+
+	if err := client.Release(); err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
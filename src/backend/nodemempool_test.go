@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+)
+
+func TestMempoolSetNodeTxs(t *testing.T) {
+	external := strings.Repeat("ee", 32)
+
+	m := NewMempool(nil)
+	ttl := time.Now().Add(time.Hour)
+	m.AddTx(newMempoolTxStub(1, external+"#0"), ttl)
+	m.AddTx(newMempoolTxStub(2, external+"#1"), ttl)
+
+	// tx 1 was submitted through Iris and is in the node's mempool, tx 2 was dropped by the node, tx 3 was submitted by another client
+	m.SetNodeTxs([]ledger.Transaction{newMempoolTxStub(1, external+"#0"), newMempoolTxStub(3, external+"#2")})
+
+	if hashes := m.Hashes(); len(hashes) != 2 {
+		t.Errorf("expected external txs not to be listed as Iris txs, got %v", hashes)
+	}
+
+	if m.GetTx(stubTxID(3)) == nil {
+		t.Errorf("expected external tx 3 to be found")
+	}
+
+	testCases := []struct {
+		id       byte
+		external bool
+		reason   string
+	}{
+		{1, false, "waiting to be included in a block"},
+		{2, false, "not in the node's mempool"},
+		{3, true, "submitted to the node by another client, waiting to be included in a block"},
+	}
+
+	for _, tc := range testCases {
+		details, ok := m.Details(stubTxID(tc.id))
+		if !ok {
+			t.Fatalf("expected tx %d to be found", tc.id)
+		}
+
+		if details.External != tc.external || details.PendingReason != tc.reason {
+			t.Errorf("unexpected details for tx %d: external=%v, pendingReason=%q", tc.id, details.External, details.PendingReason)
+		}
+	}
+
+	if firstSeen, _ := m.Details(stubTxID(3)); firstSeen.SubmittedAt.IsZero() {
+		t.Errorf("expected external tx to have a first seen time")
+	}
+
+	// the next snapshot no longer contains tx 3
+	m.SetNodeTxs([]ledger.Transaction{newMempoolTxStub(1, external+"#0")})
+
+	if m.GetTx(stubTxID(3)) != nil {
+		t.Errorf("expected external tx 3 to be removed")
+	}
+
+	// Iris txs are never removed by snapshots
+	if m.GetTx(stubTxID(2)) == nil {
+		t.Errorf("expected tx 2 to remain in the mempool")
+	}
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"math/big"
 	"net/http"
 	"net/url"
@@ -24,6 +27,8 @@ import (
 	"github.com/blinklabs-io/gouroboros/cbor"
 	"github.com/blinklabs-io/gouroboros/ledger"
 	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/echovl/cardano-go/crypto"
+	"github.com/jackc/pgx/v5"
 )
 
 type Handler struct {
@@ -34,13 +39,24 @@ type Handler struct {
 	paramsCache *ParametersCache
 	mempool     *Mempool
 	selector    *CoinSelector
+	verifier    *StoreVerifier
+	evaluator   TxEvaluator     // nil if not configured
+	sponsor     *Sponsor        // nil if not configured
+	collateral  *CollateralPool // nil if neither the wallet nor the collateral are configured
+	signer      Signer          // nil if the wallet isn't configured
+	multisigTxs *MultisigCoordinator
+	walletCache *WalletAccountsCache
 	mu          sync.RWMutex // top-level RW Mutex. All read queries should call RLock, and all write queries should call Lock
 }
 
 type ParametersCache struct {
 	ttl    time.Time
-	params []byte
+	params *HeliosNetworkParams // without collateralUTXO, which is set for each request
 	mu     sync.RWMutex
+
+	// raw protocol parameters, used for local tx validation, valid until the end of the epoch
+	protocolTTL    time.Time
+	protocolParams *CardanoCLIParameters
 }
 
 type URLHelper struct {
@@ -49,10 +65,17 @@ type URLHelper struct {
 }
 
 type SelectRequest struct {
-	Lovelace    string `json:"lovelace"`
-	Asset       string `json:"asset"`
-	MinQuantity string `json:"minQuantity"`
-	Algorithm   string `json:"algorithm"`
+	Lovelace    string        `json:"lovelace"`
+	Asset       string        `json:"asset"`       // only selects UTXOs containing this asset, or only lovelace if "lovelace"
+	MinQuantity string        `json:"minQuantity"` // quantity of asset
+	Assets      []PolicyAsset `json:"assets"`      // additional asset targets
+	Algorithm   string        `json:"algorithm"`   // defaults to smallest-first
+	MaxInputs   int           `json:"maxInputs"`   // 0 means no limit
+	TTL         int           `json:"ttl"`         // seconds during which the selected UTXOs are reserved, defaults to 10
+}
+
+type ExtendReservationRequest struct {
+	TTL int `json:"ttl"` // seconds from now, defaults to 10
 }
 
 func NewHandler(cfg *Config) (*Handler, error) {
@@ -64,7 +87,14 @@ func NewHandler(cfg *Config) (*Handler, error) {
 	}
 
 	// this might take a while
-	store, err := LoadStore(filepath.Join("/var/cache/cardano-node", cfg.NetworkName))
+	store, err := LoadStore(cfg.ChainDBDir(), cfg.BlockCacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	mempool := NewMempool(db)
+
+	selector, err := NewCoinSelector(cfg.ReservationsFile, mempool)
 	if err != nil {
 		return nil, err
 	}
@@ -75,12 +105,47 @@ func NewHandler(cfg *Config) (*Handler, error) {
 		db,
 		store,
 		&ParametersCache{},
-		NewMempool(db),
-		NewCoinSelector(),
+		mempool,
+		selector,
+		NewStoreVerifier(cfg.ChainDBDir()),
+		nil,
+		nil,
+		nil,
+		nil,
+		NewMultisigCoordinator(),
+		&WalletAccountsCache{},
 		sync.RWMutex{},
 	}
 
-	go func() {
+	if cfg.Wallet != nil {
+		handler.signer, err = NewLocalSigner(cfg.Wallet, cfg.NetworkName, cfg.SignerPolicy, chainInputResolver(db, context.Background()))
+	} else if cfg.RemoteSigner.URL != "" {
+		handler.signer, err = NewRemoteSigner(cfg.RemoteSigner)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.TxEvaluator != "" {
+		evaluator, err := NewExternalTxEvaluator(cfg.TxEvaluator)
+		if err != nil {
+			return nil, err
+		}
+
+		handler.evaluator = evaluator
+	}
+
+	if cfg.Sponsorship != nil {
+		handler.sponsor = NewSponsor(cfg.Sponsorship)
+	}
+
+	if handler.signer != nil && (cfg.CollateralPoolSize > 0 || cfg.Collateral != "") {
+		handler.collateral = NewCollateralPool(cfg.CollateralPoolSize, cfg.CollateralLovelace, cfg.Collateral)
+		go handler.watchCollateralPool()
+	}
+
+	pollTip := func() {
 		for {
 			time.Sleep(5 * time.Second)
 
@@ -89,7 +154,23 @@ func NewHandler(cfg *Config) (*Handler, error) {
 				handler.store.NotifyTip(tip.Hash)
 			}
 		}
-	}()
+	}
+
+	// called from the watcher goroutine, which isn't used anymore
+	stopped := func() {
+		log.Println("falling back to polling the tip")
+		pollTip()
+	}
+
+	if err := store.Watch(stopped); err != nil {
+		log.Printf("unable to watch the chain database, falling back to polling the tip (%v)", err)
+
+		go pollTip()
+	}
+
+	if cfg.NodeMempoolInterval > 0 {
+		go handler.mempool.MirrorNode(NodeSocketPath, cfg.NetworkMagic(), cfg.NodeMempoolInterval)
+	}
 
 	// wait 2 minutes to create the indices that speed up queries a lot
 	go func() {
@@ -116,6 +197,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "*")
 	w.Header().Set("Access-Control-Allow-Headers", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "*")
 
 	if r.Method == http.MethodOptions {
 		// preflight request, return empty response
@@ -126,6 +208,8 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	cmp, url := NewURLHelper(r.URL).Pop()
 
 	switch cmp {
+	case "admin":
+		h.admin(w, r, url)
 	case "api":
 		h.api(w, r, url)
 	case "config":
@@ -135,6 +219,226 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// admin endpoints require the token configured in /etc/cardano-iris/admin-token
+func (h *Handler) admin(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	cmp, url := url.Pop()
+
+	switch cmp {
+	case "store":
+		h.adminStore(w, r, url)
+	case "wallet":
+		h.adminWallet(w, r, url)
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
+// responds with an error and returns false if the request doesn't carry the admin token as a bearer token
+func (h *Handler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if h.config.AdminToken == "" {
+		http.Error(w, "admin endpoints not enabled", http.StatusNotFound)
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) adminStore(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	cmp, url := url.Pop()
+
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	switch cmp {
+	case "cache":
+		if r.Method != http.MethodGet {
+			invalidMethod(w, r)
+			return
+		}
+
+		respondWithJSON(w, h.store.cache.Stats())
+	case "verify":
+		switch r.Method {
+		case http.MethodGet:
+			h.storeVerifyReport(w)
+		case http.MethodPost:
+			h.startStoreVerify(w)
+		default:
+			invalidMethod(w, r)
+		}
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
+func (h *Handler) adminWallet(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	cmp, url := url.Pop()
+
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	switch cmp {
+	case "sign":
+		h.signWithWallet(w, r)
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
+// signWithWallet adds the vkey witnesses of all the required signers of a tx that are keys of the discovered wallet addresses or stake keys of its accounts.
+// The keys are derived in-process, bypassing the Signer and its policy, so the endpoint must be enabled explicitly using --wallet-signing.
+func (h *Handler) signWithWallet(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if r.Method != "POST" {
+		invalidMethod(w, r)
+		return
+	}
+
+	if h.config.Wallet == nil {
+		http.Error(w, "wallet not configured", http.StatusNotFound)
+		return
+	}
+
+	if !h.config.WalletSigning {
+		http.Error(w, "wallet signing is disabled, it must be enabled using --wallet-signing", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	txBytes, err := parseTxBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid tx: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	resolved, ok := h.resolveTxInputs(w, r, tx)
+	if !ok {
+		return
+	}
+
+	utxos := make(map[string]UTXO)
+	for _, utxo := range resolved {
+		utxos[fmt.Sprintf("%s#%d", utxo.TxID, utxo.OutputIndex)] = utxo
+	}
+
+	wallet, accounts, err := h.discoverWallet(r.Context())
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	defer wallet.Close()
+
+	keys, err := wallet.Keys(accounts)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	defer zeroKeys(keys)
+
+	signed := make(map[string]struct{})
+	if ws := tx.Witnesses(); ws != nil {
+		for _, witness := range ws.Vkey() {
+			signed[common.Blake2b224Hash(witness.Vkey).String()] = struct{}{}
+		}
+	}
+
+	res := WalletSignResponse{Signers: []string{}, Witnesses: []string{}, Missing: []string{}}
+
+	required := []string{}
+	for signer := range requiredSigners(tx, utxos) {
+		required = append(required, signer)
+	}
+
+	sort.Strings(required)
+
+	for _, signer := range required {
+		if _, ok := signed[signer]; ok {
+			continue
+		}
+
+		key, ok := keys[signer]
+		if !ok {
+			res.Missing = append(res.Missing, signer)
+			continue
+		}
+
+		var witness []byte
+		tx, witness, err = addVkeyWitness(tx, key)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+
+		res.Signers = append(res.Signers, signer)
+		res.Witnesses = append(res.Witnesses, hex.EncodeToString(witness))
+	}
+
+	res.CBORHex = hex.EncodeToString(tx.Cbor())
+	res.TxID = tx.Hash().String()
+
+	respondWithJSON(w, res)
+}
+
+func (h *Handler) storeVerifyReport(w http.ResponseWriter) {
+	report, ok := h.verifier.Report()
+	if !ok {
+		http.Error(w, "store verification never started", http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, report)
+}
+
+// verification of the whole chain database takes a long time, so it is run in the background
+func (h *Handler) startStoreVerify(w http.ResponseWriter) {
+	if h.verifier.Running() {
+		http.Error(w, "store verification already running", http.StatusConflict)
+		return
+	}
+
+	go func() {
+		report, err := h.verifier.Run()
+		if err != nil {
+			log.Printf("store verification failed to start (%v)", err)
+		} else if !report.OK() {
+			log.Printf("store verification found %d missing chunks and %d problems", len(report.MissingChunks), len(report.Problems))
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
 func (h *Handler) api(w http.ResponseWriter, r *http.Request, url URLHelper) {
 	cmp, url := url.Pop()
 
@@ -143,6 +447,8 @@ func (h *Handler) api(w http.ResponseWriter, r *http.Request, url URLHelper) {
 		h.address(w, r, url)
 	case "block":
 		h.block(w, r, url)
+	case "blocks":
+		h.blocks(w, r, url)
 	case "chain":
 		h.chain(w, r, url)
 	case "parameters":
@@ -150,11 +456,17 @@ func (h *Handler) api(w http.ResponseWriter, r *http.Request, url URLHelper) {
 	case "policy":
 		h.policy(w, r, url)
 	case "mempool":
-		h.mempoolTxs(w, r)
+		h.mempoolRoutes(w, r, url)
+	case "multisig":
+		h.multisig(w, r, url)
+	case "reservation":
+		h.reservation(w, r, url)
 	case "tx":
 		h.tx(w, r, url)
 	case "utxo":
 		h.utxo(w, r, url)
+	case "utxos":
+		h.utxos(w, r, url)
 	default:
 		invalidEndpoint(w, r)
 	}
@@ -178,39 +490,52 @@ func (h *Handler) configRoutes(w http.ResponseWriter, r *http.Request, url URLHe
 	}
 }
 
-func (h *Handler) configWallet(w http.ResponseWriter, _ *http.Request) {
-	if h.config.Wallet == nil {
+// read query
+func (h *Handler) configWallet(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.signer == nil {
 		http.Error(w, "wallet not configured", http.StatusNotFound)
 		return
 	}
-	addr, err := firstEnterpriseAddress(h.config.Wallet, h.config.NetworkName)
+
+	// the accounts of a remote signer can't be derived
+	if h.config.Wallet == nil {
+		utxos, err := h.getAddressUTXOs(r.Context(), h.signer.Address(), "")
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+
+		res := WalletResponse{Address: h.signer.Address(), Accounts: []WalletAccount{}}
+		res.Lovelace, res.Assets = sumUTXOs(utxos)
+
+		respondWithJSON(w, res)
+		return
+	}
+
+	accounts, err := h.cachedWalletAccounts(r.Context())
 	if err != nil {
 		internalError(w, err)
 		return
 	}
-	respondWithJSON(w, map[string]string{"address": addr})
-}
 
-func (h *Handler) configCollateral(w http.ResponseWriter, _ *http.Request) {
-	if h.config.Collateral == "" {
-		http.Error(w, "collateral not set", http.StatusNotFound)
+	res, err := h.walletBalances(r.Context(), accounts)
+	if err != nil {
+		internalError(w, err)
 		return
 	}
-	respondWithJSON(w, map[string]string{"collateral": h.config.Collateral})
+
+	respondWithJSON(w, res)
 }
 
-func (h *Handler) validAddress(addr string) bool {
-	if h.config.NetworkName == "mainnet" {
-		if !strings.HasPrefix(addr, "addr1") {
-			return false
-		}
-	} else {
-		if !strings.HasPrefix(addr, "addr_test1") {
-			return false
-		}
+func (h *Handler) configCollateral(w http.ResponseWriter, _ *http.Request) {
+	if h.collateral == nil {
+		http.Error(w, "collateral not set", http.StatusNotFound)
+		return
 	}
-
-	return true
+	respondWithJSON(w, h.collateral.Status())
 }
 
 func (h *Handler) address(w http.ResponseWriter, r *http.Request, url URLHelper) {
@@ -220,8 +545,9 @@ func (h *Handler) address(w http.ResponseWriter, r *http.Request, url URLHelper)
 		return
 	}
 
-	if !h.validAddress(addr) {
-		http.Error(w, "invalid address", http.StatusNotFound)
+	query, err := ParseAddressQuery(addr, h.config.AddressNetwork())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid address %s: %v", addr, err), http.StatusBadRequest)
 		return
 	}
 
@@ -231,19 +557,26 @@ func (h *Handler) address(w http.ResponseWriter, r *http.Request, url URLHelper)
 	case "utxos":
 		switch r.Method {
 		case http.MethodGet:
-			h.addressUTXOs(w, r, addr, url)
+			h.addressUTXOs(w, r, query, url)
 		case http.MethodPost:
+			if query.Address == "" {
+				http.Error(w, "UTXOs can only be selected from an address, not from a credential", http.StatusBadRequest)
+				return
+			}
+
 			h.selectUTXOs(w, r, addr, url)
 		default:
 			invalidMethod(w, r)
 		}
+	case "balance":
+		h.addressBalance(w, r, addr, query, url)
 	default:
 		invalidEndpoint(w, r)
 	}
 }
 
 // read query
-func (h *Handler) addressUTXOs(w http.ResponseWriter, r *http.Request, addr string, url URLHelper) {
+func (h *Handler) addressUTXOs(w http.ResponseWriter, r *http.Request, query AddressQuery, url URLHelper) {
 	if !url.Empty() {
 		invalidEndpoint(w, r)
 		return
@@ -261,7 +594,17 @@ func (h *Handler) addressUTXOs(w http.ResponseWriter, r *http.Request, addr stri
 		asset = vals[0]
 	}
 
-	obj, err := h.getAddressUTXOs(r.Context(), addr, asset)
+	var (
+		obj []UTXO
+		err error
+	)
+
+	if query.Address != "" {
+		obj, err = h.getAddressUTXOs(r.Context(), query.Address, asset)
+	} else {
+		obj, err = h.getCredentialUTXOs(r.Context(), query, asset)
+	}
+
 	if err != nil {
 		internalError(w, err)
 		return
@@ -287,6 +630,18 @@ func (h *Handler) selectUTXOs(w http.ResponseWriter, r *http.Request, addr strin
 		return
 	}
 
+	target, algorithm, err := req.target()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params, err := h.protocolParameters()
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
 	utxos, err := h.getAddressUTXOs(r.Context(), addr, req.Asset)
 	if err != nil {
 		internalError(w, err)
@@ -305,98 +660,230 @@ func (h *Handler) selectUTXOs(w http.ResponseWriter, r *http.Request, addr strin
 		filtered = append(filtered, u)
 	}
 
-	utxos = filtered
-
-	sort.Slice(utxos, func(i, j int) bool {
-		li, _ := new(big.Int).SetString(utxos[i].Lovelace, 10)
-		lj, _ := new(big.Int).SetString(utxos[j].Lovelace, 10)
-		if strings.EqualFold(req.Algorithm, "largest") || strings.EqualFold(req.Algorithm, "largest-first") {
-			return li.Cmp(lj) > 0
-		}
-		return li.Cmp(lj) < 0
+	selected, algorithm, err := SelectCoins(filtered, target, CoinSelectionOptions{
+		Algorithm:     algorithm,
+		MaxInputs:     req.MaxInputs,
+		ChangeAddress: addr,
+		Params:        params,
 	})
 
-	needLov, _ := new(big.Int).SetString(req.Lovelace, 10)
-	gotLov := big.NewInt(0)
-	needAsset, _ := new(big.Int).SetString(req.MinQuantity, 10)
-	gotAsset := big.NewInt(0)
-
-	selected := []UTXO{}
-	for _, u := range utxos {
-		lv, _ := new(big.Int).SetString(u.Lovelace, 10)
-		gotLov.Add(gotLov, lv)
-
-		if req.Asset != "" {
-			for _, a := range u.Assets {
-				if strings.EqualFold(a.Asset, req.Asset) {
-					q, _ := new(big.Int).SetString(a.Quantity, 10)
-					gotAsset.Add(gotAsset, q)
-				}
-			}
-		}
-
-		selected = append(selected, u)
-		if gotLov.Cmp(needLov) >= 0 && (req.Asset == "" || gotAsset.Cmp(needAsset) >= 0) {
-			break
-		}
+	var selectionErr *CoinSelectionError
+	if errors.As(err, &selectionErr) {
+		http.Error(w, fmt.Sprintf("not enough UTXOs: %v", err), http.StatusNotFound)
+		return
+	} else if err != nil {
+		internalError(w, err)
+		return
 	}
 
-	if gotLov.Cmp(needLov) < 0 || (req.Asset != "" && gotAsset.Cmp(needAsset) < 0) {
-		http.Error(w, "not enough UTXOs", http.StatusNotFound)
+	reservation, err := h.selector.reserve(selected, r.Header.Get("Client-Token"), reservationTTL(req.TTL))
+	if err != nil {
+		internalError(w, err)
 		return
 	}
 
-	for _, u := range selected {
-		h.selector.lock(utxoKey(u), 10*time.Second)
-	}
+	w.Header().Set("Coin-Selection-Algorithm", algorithm)
+	w.Header().Set("Reservation-Id", reservation.ID)
+	w.Header().Set("Reservation-Expires", reservation.Expires.UTC().Format(time.RFC3339))
 
 	respondWithUTXOs(w, r, selected)
 }
 
-// internal method used by addressUTXOs and selectUTXOs
-func (h *Handler) getAddressUTXOs(ctx context.Context, addr string, asset string) ([]UTXO, error) {
-	var (
-		obj    []UTXO
-		err    error
-		filter func(UTXO) bool
-	)
+// returns the value to select and the coin selection algorithm
+func (req SelectRequest) target() (txValue, string, error) {
+	target := newTxValue()
 
-	if asset != "" {
-		obj, err = h.db.AddressUTXOsWithAsset(addr, asset, ctx)
+	if req.Lovelace != "" {
+		lovelace, err := strconv.ParseUint(req.Lovelace, 10, 64)
 		if err != nil {
-			return nil, err
+			return txValue{}, "", fmt.Errorf("invalid lovelace %q", req.Lovelace)
 		}
 
-		lower := strings.ToLower(asset)
-		if lower != "lovelace" {
-			filter = func(u UTXO) bool {
-				if u.Address != addr {
-					return false
-				}
-				for _, a := range u.Assets {
-					if strings.EqualFold(a.Asset, asset) {
-						return true
-					}
-				}
-				return false
-			}
-		} else {
-			filter = func(u UTXO) bool { return u.Address == addr && len(u.Assets) == 0 }
+		target.lovelace = lovelace
+	}
+
+	assets := req.Assets
+	if req.Asset != "" && !strings.EqualFold(req.Asset, "lovelace") && req.MinQuantity != "" {
+		assets = append([]PolicyAsset{{Asset: req.Asset, Quantity: req.MinQuantity}}, assets...)
+	}
+
+	for _, a := range assets {
+		qty, ok := new(big.Int).SetString(a.Quantity, 10)
+		if !ok || qty.Sign() < 0 {
+			return txValue{}, "", fmt.Errorf("invalid quantity %q for asset %s", a.Quantity, a.Asset)
+		}
+
+		if _, err := hex.DecodeString(a.Asset); err != nil || len(a.Asset) < 56 {
+			return txValue{}, "", fmt.Errorf("invalid asset %q", a.Asset)
+		}
+
+		addAssetQuantity(target.assets, strings.ToLower(a.Asset), qty)
+	}
+
+	if req.MaxInputs < 0 {
+		return txValue{}, "", fmt.Errorf("invalid maxInputs %d", req.MaxInputs)
+	}
+
+	if req.TTL < 0 {
+		return txValue{}, "", fmt.Errorf("invalid ttl %d", req.TTL)
+	}
+
+	switch strings.ToLower(req.Algorithm) {
+	case "", "smallest", coinSelectionSmallestFirst:
+		return target, coinSelectionSmallestFirst, nil
+	case "largest", coinSelectionLargestFirst:
+		return target, coinSelectionLargestFirst, nil
+	case coinSelectionRandomImprove:
+		return target, coinSelectionRandomImprove, nil
+	default:
+		return txValue{}, "", fmt.Errorf("unknown algorithm %q, expected largest-first, smallest-first or random-improve", req.Algorithm)
+	}
+}
+
+// seconds to duration, using the default if 0
+func reservationTTL(seconds int) time.Duration {
+	if seconds == 0 {
+		return defaultReservationTTL
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// reservations made by POST /api/address/{address}/utxos can only be managed with the same Client-Token header
+func (h *Handler) reservation(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	id, url := url.Pop()
+	if id == "" {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	cmp, url := url.Pop()
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	token := r.Header.Get("Client-Token")
+
+	var (
+		res Reservation
+		err error
+	)
+
+	switch {
+	case cmp == "" && r.Method == http.MethodGet:
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+
+		res, err = h.selector.Reservation(id, token)
+	case cmp == "" && r.Method == http.MethodDelete:
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if err = h.selector.Release(id, token); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
 		}
+	case cmp == "extend" && r.Method == http.MethodPost:
+		var req ExtendReservationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			http.Error(w, fmt.Sprintf("failed to decode request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if req.TTL < 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %d", req.TTL), http.StatusBadRequest)
+			return
+		}
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		res, err = h.selector.Extend(id, token, reservationTTL(req.TTL))
+	case cmp == "" || cmp == "extend":
+		invalidMethod(w, r)
+		return
+	default:
+		invalidEndpoint(w, r)
+		return
+	}
+
+	switch {
+	case errors.Is(err, errReservationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errReservationForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case err != nil:
+		internalError(w, err)
+	default:
+		respondWithJSON(w, res)
+	}
+}
+
+// internal method used by addressUTXOs and selectUTXOs
+func (h *Handler) getAddressUTXOs(ctx context.Context, addr string, asset string) ([]UTXO, error) {
+	var (
+		obj []UTXO
+		err error
+	)
+
+	if asset != "" {
+		obj, err = h.db.AddressUTXOsWithAsset(addr, asset, ctx)
 	} else {
 		obj, err = h.db.AddressUTXOs(addr, ctx)
-		if err != nil {
-			return nil, err
-		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	hasAsset := utxoAssetFilter(asset)
+
+	obj = h.mempool.Overlay(obj, func(u UTXO) bool { return u.Address == addr && hasAsset(u) })
+
+	return obj, nil
+}
+
+// returns the UTXOs of all the addresses matching a credential query, the mempool overlay is applied by credential as well
+func (h *Handler) getCredentialUTXOs(ctx context.Context, query AddressQuery, asset string) ([]UTXO, error) {
+	utxos, err := h.db.CredentialUTXOs(query.PaymentCred, query.StakeAddress, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hasAsset := utxoAssetFilter(asset)
 
-		filter = func(u UTXO) bool { return u.Address == addr }
+	obj := make([]UTXO, 0, len(utxos))
+	for _, u := range utxos {
+		if hasAsset(u) {
+			obj = append(obj, u)
+		}
 	}
 
-	obj = h.mempool.Overlay(obj, filter)
+	obj = h.mempool.Overlay(obj, func(u UTXO) bool { return query.Matches(u.Address) && hasAsset(u) })
 
 	return obj, nil
 }
 
+// returns a filter of the UTXOs containing the asset, only lovelace if the asset is "lovelace", or all UTXOs if the asset is empty
+func utxoAssetFilter(asset string) func(UTXO) bool {
+	switch strings.ToLower(asset) {
+	case "":
+		return func(UTXO) bool { return true }
+	case "lovelace":
+		return func(u UTXO) bool { return len(u.Assets) == 0 }
+	default:
+		return func(u UTXO) bool {
+			for _, a := range u.Assets {
+				if strings.EqualFold(a.Asset, asset) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+}
+
 func (h *Handler) block(w http.ResponseWriter, r *http.Request, url URLHelper) {
 	blockID, url := url.Pop()
 
@@ -411,6 +898,8 @@ func (h *Handler) block(w http.ResponseWriter, r *http.Request, url URLHelper) {
 		h.blockBytes(w, r, blockID)
 	} else {
 		switch cmp {
+		case "header":
+			h.blockHeader(w, r, url, blockID)
 		case "tx":
 			h.blockTx(w, r, url, blockID)
 		default:
@@ -439,6 +928,38 @@ func (h *Handler) blockBytes(w http.ResponseWriter, r *http.Request, blockID str
 	respondWithCBOR(w, r, block.Cbor())
 }
 
+// read query, but doesn't depend on recent write operations, so no need to lock
+func (h *Handler) blockHeader(w http.ResponseWriter, r *http.Request, url URLHelper, blockID string) {
+	if r.Method != "GET" {
+		invalidMethod(w, r)
+		return
+	}
+
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	block, err := h.store.Block(blockID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	if block == nil {
+		http.Error(w, fmt.Sprintf("block %s not found", blockID), http.StatusNotFound)
+		return
+	}
+
+	view, err := NewBlockHeaderView(block)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, view)
+}
+
 // read query, but doesn't depend on recent write operations, so no need to lock
 func (h *Handler) blockTx(w http.ResponseWriter, r *http.Request, url URLHelper, blockID string) {
 	if r.Method != "GET" {
@@ -482,6 +1003,217 @@ func (h *Handler) blockTx(w http.ResponseWriter, r *http.Request, url URLHelper,
 	respondWithCBOR(w, r, tx.Cbor())
 }
 
+const (
+	BlockRangeFormatCBORList           = "cbor-list"
+	BlockRangeFormatCBORLengthPrefixed = "cbor-length-prefixed"
+	BlockRangeFormatNDJSON             = "ndjson"
+)
+
+type BlockRangeLine struct {
+	Hash    string `json:"hash"` // also the resume token
+	Slot    uint64 `json:"slot"`
+	CBORHex string `json:"cborHex"`
+}
+
+// read query, but doesn't depend on recent write operations, so no need to lock
+// streams a contiguous range of blocks, without holding all of them in memory
+func (h *Handler) blocks(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	if r.Method != "GET" {
+		invalidMethod(w, r)
+		return
+	}
+
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	fromSlot, toSlot, err := h.blockRangeSlots(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		if r.Header.Get("Accept") == "application/cbor" {
+			format = BlockRangeFormatCBORList
+		} else {
+			format = BlockRangeFormatNDJSON
+		}
+	}
+
+	contentType := "application/cbor"
+
+	switch format {
+	case BlockRangeFormatCBORList, BlockRangeFormatCBORLengthPrefixed:
+	case BlockRangeFormatNDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		http.Error(w, fmt.Sprintf("invalid format '%s'", format), http.StatusBadRequest)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	started := false
+	n := 0
+
+	start := func() error {
+		started = true
+
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+
+		if format == BlockRangeFormatCBORList {
+			_, err := w.Write(encodeIndefListStart())
+			return err
+		}
+
+		return nil
+	}
+
+	err = h.store.BlockRange(fromSlot, toSlot, query.Get("resume"), func(b RawBlock) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		var err error
+
+		switch format {
+		case BlockRangeFormatCBORList:
+			_, err = w.Write(b.Cbor)
+		case BlockRangeFormatCBORLengthPrefixed:
+			prefix := make([]byte, 4)
+			binary.BigEndian.PutUint32(prefix, uint32(len(b.Cbor)))
+
+			if _, err = w.Write(prefix); err == nil {
+				_, err = w.Write(b.Cbor)
+			}
+		case BlockRangeFormatNDJSON:
+			var line []byte
+			line, err = json.Marshal(BlockRangeLine{b.Hash, b.Slot, hex.EncodeToString(b.Cbor)})
+			if err == nil {
+				_, err = w.Write(append(line, '\n'))
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		n++
+		if flusher != nil && n%100 == 0 {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, errUnknownResumeToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err == nil && !started {
+		err = start()
+	}
+
+	if err != nil {
+		if !started {
+			internalError(w, err)
+			return
+		}
+
+		// the status code has already been sent, so abort the connection to signal the client that the response is incomplete
+		log.Printf("block range streaming aborted after %d blocks (%v)", n, err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if format == BlockRangeFormatCBORList {
+		if _, err := w.Write(encodeIndefListEnd()); err != nil {
+			log.Printf("failed to end block range (%v)", err)
+		}
+	}
+}
+
+// either fromSlot/toSlot or fromHeight/toHeight can be used, heights are converted into slots using the db
+// the upper bound is optional, and is inclusive
+func (h *Handler) blockRangeSlots(r *http.Request) (uint64, uint64, error) {
+	query := r.URL.Query()
+
+	parse := func(name string) (uint64, bool, error) {
+		str := query.Get(name)
+		if str == "" {
+			return 0, false, nil
+		}
+
+		x, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s '%s'", name, str)
+		}
+
+		return x, true, nil
+	}
+
+	toSlotFromHeight := func(name string) (uint64, bool, error) {
+		height, ok, err := parse(name)
+		if err != nil || !ok {
+			return 0, ok, err
+		}
+
+		slot, err := h.db.BlockSlot(height, r.Context())
+		if err != nil {
+			return 0, false, fmt.Errorf("block at %s %d not found (%v)", name, height, err)
+		}
+
+		return slot, true, nil
+	}
+
+	fromSlot, hasFromSlot, err := parse("fromSlot")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	toSlot, hasToSlot, err := parse("toSlot")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if query.Has("fromHeight") || query.Has("toHeight") {
+		if hasFromSlot || hasToSlot {
+			return 0, 0, errors.New("slot and height ranges can't be combined")
+		}
+
+		fromSlot, hasFromSlot, err = toSlotFromHeight("fromHeight")
+		if err != nil {
+			return 0, 0, err
+		}
+
+		toSlot, hasToSlot, err = toSlotFromHeight("toHeight")
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if !hasFromSlot {
+		return 0, 0, errors.New("expected fromSlot or fromHeight query parameter")
+	}
+
+	if !hasToSlot {
+		toSlot = math.MaxUint64
+	}
+
+	if toSlot < fromSlot {
+		return 0, 0, fmt.Errorf("invalid range %d-%d", fromSlot, toSlot)
+	}
+
+	return fromSlot, toSlot, nil
+}
+
 func (h *Handler) chain(w http.ResponseWriter, r *http.Request, url URLHelper) {
 	cmp, url := url.Pop()
 	if cmp == "" {
@@ -552,57 +1284,45 @@ func (h *Handler) parameters(w http.ResponseWriter, r *http.Request) {
 	ttl := h.paramsCache.ttl
 	h.paramsCache.mu.RUnlock()
 
-	if cachedParams != nil && time.Now().Before(ttl) {
-		w.Header().Set("Content-Type", "application/json")
-		if _, err := w.Write(cachedParams); err != nil {
-			http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
+	if cachedParams == nil || !time.Now().Before(ttl) {
+		h.paramsCache.mu.Lock()
+		defer h.paramsCache.mu.Unlock()
+
+		heliosParams, err := h.cli.DeriveParameters()
+		if err != nil {
+			internalError(w, err)
+			return
 		}
-		return
+
+		tip, err := h.cli.Tip()
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+
+		h.paramsCache.params = &heliosParams
+		h.paramsCache.ttl = time.Now().Add(time.Duration(tip.SlotsToEpochEnd) * time.Second)
+
+		cachedParams = &heliosParams
 	}
 
-	h.paramsCache.mu.Lock()
-	defer h.paramsCache.mu.Unlock()
+	params := *cachedParams
 
-	heliosParams, err := h.cli.DeriveParameters()
+	// collateral UTXOs are handed out round-robin, so concurrent txs don't use the same collateral
+	if h.collateral != nil {
+		if collateral, ok := h.collateral.Next(); ok {
+			params.CollateralUTXO = collateral
+		}
+	}
+
+	content, err := json.Marshal(params)
 	if err != nil {
 		internalError(w, err)
 		return
 	}
 
-	if h.config.Collateral != "" && h.config.Wallet != nil && len(h.config.Collateral) > 64 {
-		txID := h.config.Collateral[:64]
-		outputIndexStr := h.config.Collateral[64:]
-		if idx, err := strconv.Atoi(outputIndexStr); err == nil {
-			utxo, err := h.db.UTXO(txID, idx, r.Context())
-			if err == nil && utxo.ConsumedBy == "" {
-				addr, err := firstEnterpriseAddress(h.config.Wallet, h.config.NetworkName)
-				if err == nil && utxo.Address == addr {
-					heliosParams.CollateralUTXO = h.config.Collateral
-				}
-			}
-		}
-	}
-
-	tip, err := h.cli.Tip()
-	if err != nil {
-		internalError(w, err)
-		return
-	}
-
-	ttlTime := time.Now().Add(time.Duration(tip.SlotsToEpochEnd) * time.Second)
-
-	content, err := json.Marshal(heliosParams)
-	if err != nil {
-		internalError(w, err)
-		return
-	}
-
-	encodedParams := []byte(content)
-	h.paramsCache.params = encodedParams
-	h.paramsCache.ttl = ttlTime
-
 	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(encodedParams); err != nil {
+	if _, err := w.Write(content); err != nil {
 		http.Error(w, fmt.Sprintf("internal error: %v", err), http.StatusInternalServerError)
 	}
 }
@@ -714,39 +1434,681 @@ func (h *Handler) tx(w http.ResponseWriter, r *http.Request, url URLHelper) {
 			invalidEndpoint(w, r)
 			return
 		}
+	} else if txID == "evaluate" {
+		h.evaluateTx(w, r)
+		return
+	} else if txID == "fee" {
+		h.estimateTxFee(w, r)
+		return
+	} else if txID == "min-lovelace" {
+		h.outputMinLovelace(w, r)
+		return
+	} else if txID == "build" {
+		h.buildTx(w, r)
+		return
+	} else if txID == "sponsor" {
+		h.sponsorTx(w, r)
+		return
+	}
+
+	cmp, url := url.Pop()
+
+	switch cmp {
+	case "":
+		h.txContent(w, r, txID)
+	case "block":
+		h.txBlockInfo(w, r, txID)
+	case "output":
+		h.txOutput(w, r, url, txID)
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
+type TxEnvelope struct {
+	CBORHex     string `json:"cborHex"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type SubmitTxResponse struct {
+	TxID            string   `json:"txID"`
+	Message         string   `json:"message,omitempty"`
+	ExtraSignatures []string `json:"extraSignatures,omitempty"`
+	Evicted         []string `json:"evicted,omitempty"` // mempool txs replaced by this tx, including their descendants
+}
+
+// returned with status 409 if the submitted tx double-spends an input of a pending mempool tx
+type SubmitTxConflictResponse struct {
+	Error     string            `json:"error"`
+	Conflicts []MempoolConflict `json:"conflicts"`
+}
+
+// write query
+func (h *Handler) submitTx(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r.Method != "POST" {
+		invalidMethod(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	txBytes, err := parseTxBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	// the node doesn't accept conflicting txs anyway, so when replacing, the conflicting txs are only evicted after a successful submission
+	replace := r.URL.Query().Get("replace") == "true"
+
+	conflicts := h.mempool.Conflicts(tx)
+	if len(conflicts) > 0 && !replace {
+		respondWithJSONWithStatus(w, SubmitTxConflictResponse{
+			Error:     fmt.Sprintf("tx spends inputs already spent by mempool tx %s", conflicts[0].TxID),
+			Conflicts: conflicts,
+		}, http.StatusConflict)
+		return
+	}
+
+	// txs submitted to the node by other clients aren't managed by Iris
+	for _, c := range conflicts {
+		if c.External {
+			respondWithJSONWithStatus(w, SubmitTxConflictResponse{
+				Error:     fmt.Sprintf("tx spends inputs already spent by node mempool tx %s, which can't be replaced", c.TxID),
+				Conflicts: conflicts,
+			}, http.StatusConflict)
+			return
+		}
+	}
+
+	tx, extraSignature, err := h.signCollateral(tx)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	// phase-1 validation, so that most invalid txs are rejected without a node round-trip
+	validator, err := h.newTxValidator(r.Context())
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	verr, err := validator.Validate(tx)
+	if err != nil {
+		internalError(w, err)
+		return
+	} else if verr != nil {
+		respondWithJSONWithStatus(w, verr, http.StatusBadRequest)
+		return
+	}
+
+	message, evicted, err := h.submitValidatedTx(tx, conflicts)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	txID := tx.Hash()
+
+	response := SubmitTxResponse{
+		TxID:            hex.EncodeToString(txID[:]),
+		Message:         message,
+		ExtraSignatures: []string{},
+		Evicted:         evicted,
+	}
+
+	if extraSignature != "" {
+		response.ExtraSignatures = append(response.ExtraSignatures, extraSignature)
+	}
+
+	respondWithJSON(w, response)
+}
+
+// submitValidatedTx submits a tx to the node and adds it to the mempool overlay, replacing the given conflicting mempool txs.
+// Returns the message of the node, and the hashes of the evicted mempool txs.
+func (h *Handler) submitValidatedTx(tx ledger.Transaction, conflicts []MempoolConflict) (string, []string, error) {
+	// save the tx JSON representation to a temporary file
+	txEnv := TxEnvelope{
+		hex.EncodeToString(tx.Cbor()),
+		"Tx ConwayEra", // TODO: automatic updating during hardforks
+		"Submitted through the Helios gateway",
+	}
+
+	content, err := json.Marshal(txEnv)
+	if err != nil {
+		return "", nil, err
+	}
+
+	txPath := getTxTmpPath(tx)
+	if err := os.WriteFile(txPath, content, 0444); err != nil {
+		return "", nil, err
+	}
+
+	message, attempts, err := h.submitTxWithRetries(txPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// save to mempool
+	ttlTime := time.Now().Add(10 * time.Minute)
+	if ttl := tx.TTL(); ttl != 0 {
+		if t, err := h.cli.ConvertSlotToTime(ttl); err == nil {
+			if t.Before(ttlTime) {
+				ttlTime = t
+			}
+		}
+	}
+
+	evicted := []string{}
+	for _, c := range conflicts {
+		evicted = append(evicted, h.mempool.EvictTx(c.TxID)...)
+	}
+
+	h.mempool.AddTx(tx, ttlTime)
+	h.mempool.RecordAttempts(tx.Hash().String(), attempts)
+
+	return message, evicted, nil
+}
+
+// parseTxBody returns the tx bytes of a request body, which is either raw CBOR, a JSON envelope or hex
+func parseTxBody(contentType string, body []byte) ([]byte, error) {
+	switch contentType {
+	case "application/cbor":
+		return body, nil
+	case "application/json":
+		if !utf8.Valid(body) {
+			return nil, errors.New("request body isn't valid utf-8")
+		}
+
+		var structuredBody TxEnvelope
+
+		if err := json.Unmarshal(body, &structuredBody); err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+
+		txBytes, err := hex.DecodeString(string(structuredBody.CBORHex))
+		if err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+
+		return txBytes, nil
+	default:
+		if !utf8.Valid(body) {
+			return nil, errors.New("request body isn't valid utf-8")
+		}
+
+		txBytes, err := hex.DecodeString(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+
+		return txBytes, nil
+	}
+}
+
+func (h *Handler) newTxValidator(ctx context.Context) (*TxValidator, error) {
+	params, err := h.protocolParameters()
+	if err != nil {
+		return nil, err
+	}
+
+	// the store follows the chain database of the node, which avoids a node round-trip per submitted tx
+	if slot, ok := h.store.TipSlot(); ok {
+		return NewTxValidator(params, slot, h.inputResolver(ctx)), nil
+	}
+
+	tip, err := h.cli.Tip()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTxValidator(params, tip.Slot, h.inputResolver(ctx)), nil
+}
+
+// inputResolver returns a function that looks up unspent outputs in the mempool first, and then on chain
+func (h *Handler) inputResolver(ctx context.Context) func(common.TransactionInput) (UTXO, bool, error) {
+	return func(in common.TransactionInput) (UTXO, bool, error) {
+		if utxo, ok := h.mempool.GetUTXO(in.Id().String(), int(in.Index())); ok {
+			return utxo, true, nil
+		}
+
+		return chainInputResolver(h.db, ctx)(in)
+	}
+}
+
+// chainInputResolver returns a function that looks up unspent outputs on chain only
+func chainInputResolver(db *DB, ctx context.Context) func(common.TransactionInput) (UTXO, bool, error) {
+	return func(in common.TransactionInput) (UTXO, bool, error) {
+		utxo, err := db.UTXO(in.Id().String(), int(in.Index()), ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UTXO{}, false, nil
+		} else if err != nil {
+			return UTXO{}, false, err
+		}
+
+		return utxo, utxo.ConsumedBy == "", nil
+	}
+}
+
+// protocolParameters returns the current protocol parameters, cached until the end of the epoch
+func (h *Handler) protocolParameters() (CardanoCLIParameters, error) {
+	h.paramsCache.mu.RLock()
+	cached := h.paramsCache.protocolParams
+	ttl := h.paramsCache.protocolTTL
+	h.paramsCache.mu.RUnlock()
+
+	if cached != nil && time.Now().Before(ttl) {
+		return *cached, nil
+	}
+
+	params, err := h.cli.Parameters()
+	if err != nil {
+		return CardanoCLIParameters{}, err
+	}
+
+	tip, err := h.cli.Tip()
+	if err != nil {
+		return CardanoCLIParameters{}, err
+	}
+
+	h.paramsCache.mu.Lock()
+	h.paramsCache.protocolParams = &params
+	h.paramsCache.protocolTTL = time.Now().Add(time.Duration(tip.SlotsToEpochEnd) * time.Second)
+	h.paramsCache.mu.Unlock()
+
+	return params, nil
+}
+
+// resolveTxInputs returns the UTXOs spent, referenced or used as collateral by a tx.
+// Responds with status 400 and returns false if some of them don't exist or are already spent.
+func (h *Handler) resolveTxInputs(w http.ResponseWriter, r *http.Request, tx ledger.Transaction) ([]UTXO, bool) {
+	resolve := h.inputResolver(r.Context())
+
+	utxos := []UTXO{}
+	badInputs := []CardanoTxIn{}
+	seen := make(map[string]struct{})
+
+	for _, inputs := range [][]common.TransactionInput{tx.Inputs(), tx.ReferenceInputs(), tx.Collateral()} {
+		for _, in := range inputs {
+			if _, ok := seen[inputKey(in)]; ok {
+				continue
+			}
+
+			seen[inputKey(in)] = struct{}{}
+
+			utxo, ok, err := resolve(in)
+			if err != nil {
+				internalError(w, err)
+				return nil, false
+			}
+
+			if ok {
+				utxos = append(utxos, utxo)
+			} else {
+				badInputs = append(badInputs, CardanoTxIn{TxID: in.Id().String(), Index: int(in.Index())})
+			}
+		}
+	}
+
+	if len(badInputs) > 0 {
+		respondWithJSONWithStatus(w, CardanoCLITxSubmitError{
+			Raw:       fmt.Sprintf("BadInputsUTxO %v", badInputs),
+			BadInputs: badInputs,
+		}, http.StatusBadRequest)
+		return nil, false
+	}
+
+	return utxos, true
+}
+
+// read query
+func (h *Handler) estimateTxFee(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if r.Method != "POST" {
+		invalidMethod(w, r)
+		return
+	}
+
+	extraWitnesses := 0
+	if s := r.URL.Query().Get("witnesses"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid witnesses %s", s), http.StatusBadRequest)
+			return
+		}
+
+		extraWitnesses = n
+	}
+
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	txBytes, err := parseTxBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid tx: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	utxos, ok := h.resolveTxInputs(w, r, tx)
+	if !ok {
+		return
+	}
+
+	utxosByInput := make(map[string]UTXO)
+	for _, utxo := range utxos {
+		utxosByInput[fmt.Sprintf("%s#%d", utxo.TxID, utxo.OutputIndex)] = utxo
+	}
+
+	params, err := h.protocolParameters()
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	respondWithJSON(w, EstimateTxFee(params, tx, refScriptsSize(tx, utxosByInput), extraWitnesses))
+}
+
+// write query, because the selected UTXOs are locked
+func (h *Handler) buildTx(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r.Method != "POST" {
+		invalidMethod(w, r)
+		return
+	}
+
+	var req BuildTxRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := req.validateAddresses(h.config.AddressNetwork()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collateralInput, err := req.collateralInput()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var collateral *UTXO
+
+	if collateralInput != nil {
+		utxo, ok, err := h.inputResolver(r.Context())(collateralInput)
+		if err != nil {
+			internalError(w, err)
+			return
+		} else if !ok {
+			http.Error(w, fmt.Sprintf("collateral %s not found", req.Collateral), http.StatusBadRequest)
+			return
+		}
+
+		collateral = &utxo
+	}
+
+	h.selector.mu.Lock()
+	defer h.selector.mu.Unlock()
+	h.selector.pruneExpired()
+
+	available := []UTXO{}
+	seen := make(map[string]struct{})
+
+	for _, addr := range req.From {
+		// the UTXOs of a repeated address would be added twice
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+
+		seen[addr] = struct{}{}
+
+		utxos, err := h.getAddressUTXOs(r.Context(), addr, "")
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+
+		for _, u := range utxos {
+			// UTXOs with datums are locked by scripts, and require redeemers
+			if h.selector.isLocked(utxoKey(u)) || u.DatumHash != "" || u.InlineDatum != "" {
+				continue
+			}
+
+			if collateral != nil && utxoKey(u) == utxoKey(*collateral) {
+				continue
+			}
+
+			available = append(available, u)
+		}
+	}
+
+	params, err := h.protocolParameters()
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	tx, selected, err := BuildTx(params, req, available, collateral)
+
+	var buildErr *TxBuildError
+	if errors.As(err, &buildErr) {
+		http.Error(w, buildErr.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	for _, u := range selected {
+		h.selector.lock(utxoKey(u), buildTxLockTTL)
+	}
+
+	if collateral != nil {
+		h.selector.lock(utxoKey(*collateral), buildTxLockTTL)
+	}
+
+	respondWithJSON(w, BuildTxResponse{
+		CBORHex: hex.EncodeToString(tx.Cbor()),
+		TxID:    tx.Hash().String(),
+		Fee:     tx.Fee(),
+		Inputs:  selected,
+	})
+}
+
+// write query, but the global mutex is only read-locked while the wallet input is selected and reserved, not while the tx is signed
+func (h *Handler) sponsorTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		invalidMethod(w, r)
+		return
+	}
+
+	if h.sponsor == nil || h.signer == nil {
+		http.Error(w, "sponsorship not configured", http.StatusNotImplemented)
+		return
+	}
+
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	client, ok := h.sponsor.Client(token)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	txBytes, err := parseTxBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid tx: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	sponsored, input, cost, reservation, ok := h.reserveSponsorInput(w, r, client, tx)
+	if !ok {
+		return
+	}
+
+	// the cost is charged before signing, so that concurrent requests can't exceed the caps, and refunded if signing fails
+	now := time.Now()
+
+	var sponsorErr *TxSponsorError
+	if err := h.sponsor.Reserve(client, cost, now); err != nil {
+		h.selector.Release(reservation.ID, "")
+
+		if errors.As(err, &sponsorErr) {
+			http.Error(w, sponsorErr.Error(), http.StatusForbidden)
+		} else {
+			internalError(w, err)
+		}
+
+		return
+	}
+
+	sponsored, witness, err := h.signTx(sponsored, signPurposeSponsor, []UTXO{input})
+	if err != nil {
+		h.sponsor.Refund(client, cost, now)
+		h.selector.Release(reservation.ID, "")
+
+		var policyErr *SignPolicyError
+		if errors.As(err, &policyErr) {
+			http.Error(w, policyErr.Error(), http.StatusForbidden)
+		} else {
+			internalError(w, err)
+		}
+
+		return
+	}
+
+	respondWithJSON(w, SponsorTxResponse{
+		CBORHex: hex.EncodeToString(sponsored.Cbor()),
+		TxID:    sponsored.Hash().String(),
+		Fee:     sponsored.Fee(),
+		Cost:    cost,
+		Input:   input,
+		Witness: hex.EncodeToString(witness),
+	})
+}
+
+// adds a wallet input to the tx, and reserves it until the sponsored tx is submitted or the reservation expires
+func (h *Handler) reserveSponsorInput(w http.ResponseWriter, r *http.Request, client SponsorshipClient, tx ledger.Transaction) (ledger.Transaction, UTXO, uint64, Reservation, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	resolved, ok := h.resolveTxInputs(w, r, tx)
+	if !ok {
+		return nil, UTXO{}, 0, Reservation{}, false
+	}
+
+	utxos := make(map[string]UTXO)
+	for _, utxo := range resolved {
+		utxos[fmt.Sprintf("%s#%d", utxo.TxID, utxo.OutputIndex)] = utxo
+	}
+
+	if err := checkSponsoredScripts(client, tx, utxos); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, UTXO{}, 0, Reservation{}, false
+	}
+
+	sponsorAddress := h.signer.Address()
+
+	h.selector.mu.Lock()
+	defer h.selector.mu.Unlock()
+	h.selector.pruneExpired()
+
+	walletUTXOs, err := h.getAddressUTXOs(r.Context(), sponsorAddress, "")
+	if err != nil {
+		internalError(w, err)
+		return nil, UTXO{}, 0, Reservation{}, false
+	}
+
+	available := []UTXO{}
+	for _, u := range walletUTXOs {
+		// only pure ADA UTXOs are used, and the collateral is kept aside
+		if h.selector.isLocked(utxoKey(u)) || (h.collateral != nil && h.collateral.Contains(utxoKey(u))) || len(u.Assets) > 0 || u.DatumHash != "" || u.InlineDatum != "" || u.RefScript != "" {
+			continue
+		}
+
+		available = append(available, u)
+	}
+
+	params, err := h.protocolParameters()
+	if err != nil {
+		internalError(w, err)
+		return nil, UTXO{}, 0, Reservation{}, false
+	}
+
+	sponsored, input, cost, err := SponsorTx(params, tx, utxos, available, sponsorAddress)
+
+	var sponsorErr *TxSponsorError
+	if errors.As(err, &sponsorErr) {
+		http.Error(w, sponsorErr.Error(), http.StatusBadRequest)
+		return nil, UTXO{}, 0, Reservation{}, false
+	} else if err != nil {
+		internalError(w, err)
+		return nil, UTXO{}, 0, Reservation{}, false
 	}
 
-	cmp, url := url.Pop()
-
-	switch cmp {
-	case "":
-		h.txContent(w, r, txID)
-	case "block":
-		h.txBlockInfo(w, r, txID)
-	case "output":
-		h.txOutput(w, r, url, txID)
-	default:
-		invalidEndpoint(w, r)
+	reservation, err := h.selector.reserve([]UTXO{input}, "", buildTxLockTTL)
+	if err != nil {
+		internalError(w, err)
+		return nil, UTXO{}, 0, Reservation{}, false
 	}
-}
 
-type TxEnvelope struct {
-	CBORHex     string `json:"cborHex"`
-	Type        string `json:"type,omitempty"`
-	Description string `json:"description,omitempty"`
+	return sponsored, input, cost, reservation, true
 }
 
-type SubmitTxResponse struct {
-	TxID            string   `json:"txID"`
-	Message         string   `json:"message,omitempty"`
-	ExtraSignatures []string `json:"extraSignatures,omitempty"`
+type OutputMinLovelaceResponse struct {
+	Lovelace    uint64 `json:"lovelace"`
+	MinLovelace uint64 `json:"minLovelace"`
 }
 
-// write query
-func (h *Handler) submitTx(w http.ResponseWriter, r *http.Request) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
+// read query, but doesn't depend on recent write operations, so no need to lock the global mutex
+func (h *Handler) outputMinLovelace(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		invalidMethod(w, r)
 		return
@@ -760,119 +2122,148 @@ func (h *Handler) submitTx(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var txBytes []byte
-
-	switch r.Header.Get("Content-Type") {
+	outputBytes, err := parseTxBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	case "application/cbor":
-		txBytes = body
-	case "application/json":
-		if !utf8.Valid(body) {
-			http.Error(w, "request body isn't valid utf-8", http.StatusBadRequest)
-			return
-		}
+	output, err := ledger.NewTransactionOutputFromCbor(outputBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid output: %v", err), http.StatusBadRequest)
+		return
+	}
 
-		var structuredBody TxEnvelope
+	params, err := h.protocolParameters()
+	if err != nil {
+		internalError(w, err)
+		return
+	}
 
-		if err := json.Unmarshal(body, &structuredBody); err != nil {
-			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
-			return
-		}
+	respondWithJSON(w, OutputMinLovelaceResponse{
+		Lovelace:    output.Amount(),
+		MinLovelace: RequiredOutputLovelace(params, output),
+	})
+}
 
-		txBytes, err = hex.DecodeString(string(structuredBody.CBORHex))
-		if err != nil {
-			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
-			return
-		}
-	case "text/plain":
-	default:
-		if !utf8.Valid(body) {
-			http.Error(w, "request body isn't valid utf-8", http.StatusBadRequest)
-			return
-		}
+type EvaluateTxResponse struct {
+	Redeemers []RedeemerEvaluation `json:"redeemers"`
+	Memory    uint64               `json:"memory"` // total of all redeemers
+	Steps     uint64               `json:"steps"`
+	Fee       uint64               `json:"fee"`
+}
 
-		txBytes, err = hex.DecodeString(string(body))
-		if err != nil {
-			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
-			return
-		}
+// read query
+func (h *Handler) evaluateTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		invalidMethod(w, r)
+		return
 	}
 
-	if len(txBytes) > 17000 {
-		http.Error(w, "tx too big", http.StatusBadRequest)
+	if h.evaluator == nil {
+		http.Error(w, "tx evaluator not configured", http.StatusNotImplemented)
 		return
 	}
 
-	tx, err := decodeTx(txBytes)
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+
 	if err != nil {
 		internalError(w, err)
 		return
 	}
 
-	tx, extraSignature, err := h.signCollateral(tx)
+	txBytes, err := parseTxBody(r.Header.Get("Content-Type"), body)
 	if err != nil {
-		internalError(w, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// save the tx JSON representation to a temporary file
-	txEnv := TxEnvelope{
-		hex.EncodeToString(tx.Cbor()),
-		"Tx ConwayEra", // TODO: automatic updating during hardforks
-		"Submitted through the Helios gateway",
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid tx: %v", err), http.StatusBadRequest)
+		return
 	}
 
-	content, err := json.Marshal(txEnv)
-	if err != nil {
-		internalError(w, err)
+	// the lock isn't held while the evaluator runs, so a slow evaluation doesn't block writes
+	utxos, params, evalParams, ok := h.evaluationInputs(w, r, tx)
+	if !ok {
 		return
 	}
 
-	txPath := getTxTmpPath(tx)
-	if err := os.WriteFile(txPath, content, 0444); err != nil {
+	evaluations, err := h.evaluator.Evaluate(r.Context(), tx, utxos, evalParams)
+
+	var evalErr *TxEvaluationError
+	if errors.As(err, &evalErr) {
+		respondWithJSONWithStatus(w, evalErr, http.StatusBadRequest)
+		return
+	} else if err != nil {
 		internalError(w, err)
 		return
 	}
 
-	message, err := h.submitTxWithRetries(txPath)
+	redeemers, err := completeRedeemerEvaluations(tx, evaluations, params)
 	if err != nil {
 		internalError(w, err)
 		return
 	}
 
-	// save to mempool
-	ttlTime := time.Now().Add(10 * time.Minute)
-	if ttl := tx.TTL(); ttl != 0 {
-		if t, err := h.cli.ConvertSlotToTime(ttl); err == nil {
-			if t.Before(ttlTime) {
-				ttlTime = t
-			}
-		}
+	response := EvaluateTxResponse{Redeemers: redeemers}
+
+	for _, rd := range redeemers {
+		response.Memory += rd.Memory
+		response.Steps += rd.Steps
 	}
 
-	h.mempool.AddTx(tx, ttlTime)
+	response.Fee = ExUnitsFee(params, common.ExUnits{Memory: response.Memory, Steps: response.Steps})
 
-	txID := tx.Hash()
+	respondWithJSON(w, response)
+}
 
-	response := SubmitTxResponse{
-		TxID:            hex.EncodeToString(txID[:]),
-		Message:         message,
-		ExtraSignatures: []string{},
+// evaluationInputs resolves the inputs of the tx and the chain state needed by the evaluator, writes the error response if it fails
+func (h *Handler) evaluationInputs(w http.ResponseWriter, r *http.Request, tx ledger.Transaction) ([]UTXO, CardanoCLIParameters, TxEvaluationParams, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	utxos, ok := h.resolveTxInputs(w, r, tx)
+	if !ok {
+		return nil, CardanoCLIParameters{}, TxEvaluationParams{}, false
 	}
 
-	if extraSignature != "" {
-		response.ExtraSignatures = append(response.ExtraSignatures, extraSignature)
+	params, err := h.protocolParameters()
+	if err != nil {
+		internalError(w, err)
+		return nil, CardanoCLIParameters{}, TxEvaluationParams{}, false
 	}
 
-	respondWithJSON(w, response)
+	refTime, refSlot, err := h.cli.GetRefTimeAndSlot()
+	if err != nil {
+		internalError(w, err)
+		return nil, CardanoCLIParameters{}, TxEvaluationParams{}, false
+	}
+
+	evalParams := TxEvaluationParams{
+		RefTipSlot:     int64(refSlot),
+		RefTipTime:     refTime.Unix() * 1000,
+		SecondsPerSlot: 1,
+		NetworkName:    h.config.NetworkName,
+	}
+
+	evalParams.CostModels.PlutusV1 = params.CostModels.PlutusV1
+	evalParams.CostModels.PlutusV2 = params.CostModels.PlutusV2
+	evalParams.CostModels.PlutusV3 = params.CostModels.PlutusV3
+	evalParams.MaxTxExecutionUnits.Memory = params.MaxTxExecutionUnits.Memory
+	evalParams.MaxTxExecutionUnits.Steps = params.MaxTxExecutionUnits.Steps
+
+	return utxos, params, evalParams, true
 }
 
 func (h *Handler) signCollateral(tx ledger.Transaction) (ledger.Transaction, string, error) {
-	if h.config.Wallet == nil {
+	if h.signer == nil {
 		return tx, "", nil
 	}
 
-	if h.config.Collateral == "" {
+	if h.collateral == nil {
 		return tx, "", nil
 	}
 
@@ -891,47 +2282,70 @@ func (h *Handler) signCollateral(tx ledger.Transaction) (ledger.Transaction, str
 	input := tx.Collateral()[0]
 	inputID := fmt.Sprintf("%s%d", input.Id().String(), input.Index())
 
-	if inputID != h.config.Collateral {
+	utxo, ok := h.collateral.Get(inputID)
+	if !ok {
 		return tx, "", nil
 	}
 
-	key, err := firstEnterprisePrvKey(h.config.Wallet)
+	addr, err := common.NewAddress(h.signer.Address())
 	if err != nil {
-		fmt.Printf("unable to generate collateral wallet key (%v)\n", err)
-		return tx, "", nil
+		return nil, "", err
+	}
+
+	// already signed by the wallet, e.g. because the tx is sponsored
+	if ws := tx.Witnesses(); ws != nil {
+		for _, w := range ws.Vkey() {
+			if common.Blake2b224Hash(w.Vkey) == addr.PaymentKeyHash() {
+				return tx, "", nil
+			}
+		}
 	}
 
+	tx, witnessBytes, err := h.signTx(tx, signPurposeCollateral, []UTXO{utxo})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to update tx bytes with signature for collateral (%v)", err)
+	}
+
+	return tx, hex.EncodeToString(witnessBytes), nil
+}
+
+// addVkeyWitness signs the tx hash using key, and inserts the resulting vkey witness into the witness set of the tx.
+// Only the witness set is re-encoded, the body, validity flag and auxiliary data are kept as is.
+// Also returns the CBOR bytes of the witness.
+func addVkeyWitness(tx ledger.Transaction, key crypto.PrvKey) (ledger.Transaction, []byte, error) {
 	hash := tx.Hash().Bytes()
-	witness := common.VkeyWitness{
+
+	return insertVkeyWitness(tx, common.VkeyWitness{
 		Vkey:      key.PubKey(),
 		Signature: key.Sign(hash),
-	}
+	})
+}
 
+// insertVkeyWitness inserts a vkey witness into the witness set of the tx, and also returns its CBOR bytes
+func insertVkeyWitness(tx ledger.Transaction, witness common.VkeyWitness) (ledger.Transaction, []byte, error) {
 	witnessBytes, err := cbor.Encode(witness)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	witness_, err := Decode(witnessBytes)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	d, err := Decode(tx.Cbor())
+	items, err := splitTx(tx)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	txList, ok := d.(*DecodedList)
-	if !ok || len(txList.Items) != 4 {
-		fmt.Println("decoded tx isn't a tuple with 4 entries")
-		return tx, "", nil
+	d, err := Decode(items[1])
+	if err != nil {
+		return nil, nil, err
 	}
 
-	txWitnessesMap, ok := (txList.Items[1]).(*DecodedMap)
-	if !ok || len(txWitnessesMap.Pairs) < 1 {
-		fmt.Println("decoded tx witnesses isn't a map with at least one entry")
-		return tx, "", nil
+	txWitnessesMap, ok := d.(*DecodedMap)
+	if !ok {
+		return nil, nil, errors.New("decoded tx witnesses isn't a map")
 	}
 
 	signaturesI := -1
@@ -944,9 +2358,8 @@ func (h *Handler) signCollateral(tx ledger.Transaction) (ledger.Transaction, str
 	}
 
 	if signaturesI == -1 {
-		// TODO: what to do if no signatures are needed because all inputs are from public smart contract?
+		// no signatures yet (e.g. all inputs are from public smart contracts)
 		// -> add to end
-		fmt.Println("signatures entry not found in map")
 		txWitnessesMap.Pairs = append(txWitnessesMap.Pairs, DecodedPair{
 			Key: &DecodedInt{big.NewInt(0)},
 			Value: &DecodedList{
@@ -958,20 +2371,44 @@ func (h *Handler) signCollateral(tx ledger.Transaction) (ledger.Transaction, str
 		pair := txWitnessesMap.Pairs[signaturesI]
 		signatures, ok := (pair.Value).(*DecodedList)
 		if !ok {
-			fmt.Println("signatures entry isn't a list")
-			return tx, "", nil
+			return nil, nil, errors.New("signatures entry isn't a list")
 		}
 
 		signatures.Items = append(signatures.Items, witness_)
 	}
 
-	updatedTxBytes := d.Cbor()
-	tx, err = decodeTx(updatedTxBytes)
+	items[1] = txWitnessesMap.Cbor()
+
+	tx, err = joinTx(items)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to update tx bytes with signature for collateral (%v)", err)
+		return nil, nil, err
 	}
 
-	return tx, hex.EncodeToString(witnessBytes), nil
+	return tx, witnessBytes, nil
+}
+
+// splitTx returns the CBOR bytes of the 4 entries of a tx: body, witness set, validity flag and auxiliary data
+func splitTx(tx ledger.Transaction) ([][]byte, error) {
+	var items []cbor.RawMessage
+	if _, err := cbor.Decode(tx.Cbor(), &items); err != nil {
+		return nil, err
+	}
+
+	if len(items) != 4 {
+		return nil, fmt.Errorf("decoded tx isn't a tuple with 4 entries (got %d)", len(items))
+	}
+
+	res := make([][]byte, len(items))
+	for i, item := range items {
+		res[i] = []byte(item)
+	}
+
+	return res, nil
+}
+
+// joinTx is the inverse of splitTx
+func joinTx(items [][]byte) (ledger.Transaction, error) {
+	return decodeTx(EncodeTuple(items...))
 }
 
 func isBabbageOrConwayTx(tx ledger.Transaction) bool {
@@ -986,7 +2423,8 @@ func isBabbageOrConwayTx(tx ledger.Transaction) bool {
 }
 
 // retries twice (first time after 5 seconds delay, second time after 10 seconds after first retry)
-func (h *Handler) submitTxWithRetries(txPath string) (string, error) {
+// also returns the number of submission attempts
+func (h *Handler) submitTxWithRetries(txPath string) (string, int, error) {
 	var (
 		result string
 		err    error
@@ -995,68 +2433,39 @@ func (h *Handler) submitTxWithRetries(txPath string) (string, error) {
 	for attempt := range 3 {
 		result, err = h.cli.SubmitTx(txPath)
 		if err == nil {
-			return result, nil
+			return result, attempt + 1, nil
 		}
 
 		parsedErr := ParseTxSubmitError(err.Error())
 
 		if len(parsedErr.MissingInputs) == 0 {
-			return "", err
+			// a resubmitted mempool tx rejected by the node is evicted along with its descendants
+			h.evictRejectedTx(txPath, err)
+			return "", attempt + 1, err
 		}
 
 		time.Sleep(time.Second * time.Duration((attempt+1)*5))
 	}
 
-	return result, err
+	return result, 3, err
 }
 
-func (h *Handler) submitTxWithDeps(txPath string) (string, error) {
-	result, err := h.cli.SubmitTx(txPath)
-	if err == nil {
-		return result, nil
+// evicts the tx stored at txPath if the node rejected it, not if cardano-cli failed to reach the node
+func (h *Handler) evictRejectedTx(txPath string, err error) {
+	if !isNodeRejection(err) {
+		return
 	}
 
-	parsedErr := ParseTxSubmitError(err.Error())
-
-	if len(parsedErr.MissingInputs) == 0 {
-		return "", err
+	if evicted := h.mempool.EvictTx(filepath.Base(txPath)); len(evicted) > 0 {
+		log.Printf("evicted mempool txs %s, rejected by the node", strings.Join(evicted, ", "))
 	}
+}
 
-	done := make(map[string]struct{})
-
-	for _, missingInput := range parsedErr.MissingInputs {
-		// get from disc instead of mempool, because disc maintains much more information
-		txID := missingInput.TxID
-
-		if _, ok := done[txID]; ok {
-			continue
-		}
-
-		done[txID] = struct{}{}
-
-		p := getTmpPath(missingInput.TxID)
-
-		if _, err := os.Stat(p); err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				fmt.Printf("tx %s not found, skipping\n", p)
-			} else {
-				fmt.Printf("problem reading tx %s, skipping (%v)\n", p, err)
-			}
-			continue
-			// path/to/whatever does not exist
-		}
-
-		fmt.Printf("resubmitting %s\n", missingInput.TxID)
-
-		// anything in the mempool should also have its content written to its tmp path
-		_, err := h.submitTxWithDeps(p)
-		if err != nil {
-			fmt.Printf("failed to resubmit %s: %v\n", missingInput.TxID, err)
-		}
-	}
+// the tx was validated by the node's ledger and rejected, without missing inputs that might still be resubmitted
+func isNodeRejection(err error) bool {
+	parsedErr := ParseTxSubmitError(err.Error())
 
-	// retry, with all mempool txs recently submitted
-	return h.cli.SubmitTx(txPath)
+	return strings.Contains(parsedErr.Raw, "ApplyTxError") && len(parsedErr.MissingInputs) == 0
 }
 
 func getTmpPath(txID string) string {
@@ -1262,6 +2671,30 @@ func (h *Handler) utxoContent(w http.ResponseWriter, r *http.Request, txID strin
 	}
 }
 
+func (h *Handler) mempoolRoutes(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	txID, url := url.Pop()
+	if txID == "" {
+		h.mempoolTxs(w, r)
+		return
+	}
+
+	cmp, url := url.Pop()
+
+	if !url.Empty() {
+		invalidEndpoint(w, r)
+		return
+	}
+
+	switch cmp {
+	case "":
+		h.mempoolTx(w, r, txID)
+	case "ancestors", "descendants":
+		h.mempoolTxDeps(w, r, txID, cmp)
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
 // read query
 func (h *Handler) mempoolTxs(w http.ResponseWriter, r *http.Request) {
 	h.mu.RLock()
@@ -1274,11 +2707,95 @@ func (h *Handler) mempoolTxs(w http.ResponseWriter, r *http.Request) {
 
 	h.mempool.prune()
 
+	if r.URL.Query().Get("details") == "true" {
+		respondWithJSON(w, h.mempool.AllDetails())
+		return
+	}
+
 	hashes := h.mempool.Hashes()
 
 	respondWithJSON(w, hashes)
 }
 
+func (h *Handler) mempoolTx(w http.ResponseWriter, r *http.Request, txID string) {
+	switch r.Method {
+	case http.MethodGet:
+		h.mempoolTxDetails(w, r, txID)
+	case http.MethodDelete:
+		h.evictMempoolTx(w, r, txID)
+	default:
+		invalidMethod(w, r)
+	}
+}
+
+// read query
+func (h *Handler) mempoolTxDetails(w http.ResponseWriter, r *http.Request, txID string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.mempool.prune()
+
+	details, ok := h.mempool.Details(txID)
+	if !ok {
+		http.Error(w, fmt.Sprintf("tx %s not found in mempool", txID), http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, details)
+}
+
+// write query, requires the admin token
+// evicts a stuck tx along with its descendants, the node might still have the tx in its own mempool
+func (h *Handler) evictMempoolTx(w http.ResponseWriter, r *http.Request, txID string) {
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	evicted := h.mempool.EvictTx(txID)
+	if len(evicted) == 0 {
+		http.Error(w, fmt.Sprintf("tx %s not found in mempool", txID), http.StatusNotFound)
+		return
+	}
+
+	log.Printf("evicted mempool txs %s", strings.Join(evicted, ", "))
+
+	respondWithJSON(w, evicted)
+}
+
+// read query
+func (h *Handler) mempoolTxDeps(w http.ResponseWriter, r *http.Request, txID string, kind string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if r.Method != "GET" {
+		invalidMethod(w, r)
+		return
+	}
+
+	h.mempool.prune()
+
+	var (
+		deps []string
+		ok   bool
+	)
+
+	if kind == "ancestors" {
+		deps, ok = h.mempool.Ancestors(txID)
+	} else {
+		deps, ok = h.mempool.Descendants(txID)
+	}
+
+	if !ok {
+		http.Error(w, fmt.Sprintf("tx %s not found in mempool", txID), http.StatusNotFound)
+		return
+	}
+
+	respondWithJSON(w, deps)
+}
+
 func (h *Handler) page(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	is404 := false
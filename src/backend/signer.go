@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/echovl/cardano-go/crypto"
+)
+
+// purposes of signing requests, each with its own policy
+const (
+	signPurposeCollateral     = "collateral"      // the wallet UTXO is the only collateral input
+	signPurposeSponsor        = "sponsor"         // the wallet UTXOs are spent to pay the fee of a client tx
+	signPurposeCollateralPool = "collateral-pool" // the wallet UTXOs are spent to create collateral UTXOs
+)
+
+const remoteSignerTimeout = 10 * time.Second
+
+// Signer holds the key of the first enterprise address of the wallet, and signs txs spending its UTXOs
+type Signer interface {
+	Address() string
+
+	// Sign checks the request against the policy of the signer, and returns the vkey witness of the tx body
+	Sign(req SignRequest) (common.VkeyWitness, error)
+}
+
+type SignRequest struct {
+	Purpose   string   `json:"purpose"`
+	TxBody    string   `json:"txBody"`    // CBOR hex, the signature is over its hash
+	Inputs    []UTXO   `json:"inputs"`    // wallet UTXOs spent by the tx, or used as its collateral
+	ParentTxs []string `json:"parentTxs"` // CBOR hex of the mempool txs producing inputs that aren't on chain yet
+}
+
+type SignResponse struct {
+	Witness string `json:"witness"` // CBOR hex of the vkey witness
+}
+
+type SignerAddressResponse struct {
+	Address string `json:"address"`
+}
+
+// SignerPolicy limits what a signer signs
+type SignerPolicy struct {
+	MaxLovelace uint64 // maximum lovelace leaving the wallet (or at risk, for collateral) per tx, 0 for no limit
+}
+
+// SignPolicyError is returned if the signer refuses to sign a tx
+type SignPolicyError struct {
+	msg string
+}
+
+func (e *SignPolicyError) Error() string {
+	return e.msg
+}
+
+func newSignPolicyError(format string, args ...any) error {
+	return &SignPolicyError{fmt.Sprintf(format, args...)}
+}
+
+// LocalSigner derives the key from the mnemonic for each signature, and zeroes it afterwards.
+// resolve looks up the inputs of the txs on chain, independently of the Iris process requesting the signature.
+type LocalSigner struct {
+	words   []string
+	address string
+	keyHash string
+	policy  SignerPolicy
+	resolve func(common.TransactionInput) (UTXO, bool, error)
+}
+
+func NewLocalSigner(words []string, network string, policy SignerPolicy, resolve func(common.TransactionInput) (UTXO, bool, error)) (*LocalSigner, error) {
+	addr, err := firstEnterpriseAddress(words, network)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := firstEnterprisePrvKey(words)
+	if err != nil {
+		return nil, err
+	}
+
+	defer zeroBytes(key)
+
+	return &LocalSigner{words, addr, common.Blake2b224Hash(key.PubKey()).String(), policy, resolve}, nil
+}
+
+func (s *LocalSigner) Address() string {
+	return s.address
+}
+
+func (s *LocalSigner) Sign(req SignRequest) (common.VkeyWitness, error) {
+	hash, err := checkSignRequest(req, s.keyHash, s.policy, s.resolve)
+	if err != nil {
+		return common.VkeyWitness{}, err
+	}
+
+	key, err := firstEnterprisePrvKey(s.words)
+	if err != nil {
+		return common.VkeyWitness{}, err
+	}
+
+	defer zeroBytes(key)
+
+	return common.VkeyWitness{Vkey: key.PubKey(), Signature: key.Sign(hash)}, nil
+}
+
+// checkSignRequest verifies that the tx body only uses the expected wallet inputs, in the way implied by the purpose, and doesn't move more than the maximum value out of the wallet.
+// The inputs and the collateral of the tx are resolved by the signer, on chain or in the parent txs of the request, the UTXOs reported by Iris are only compared with them.
+// Returns the hash of the tx body.
+func checkSignRequest(req SignRequest, keyHash string, policy SignerPolicy, resolve func(common.TransactionInput) (UTXO, bool, error)) ([]byte, error) {
+	body, err := hex.DecodeString(req.TxBody)
+	if err != nil {
+		return nil, newSignPolicyError("invalid tx body hex")
+	}
+
+	// the body is wrapped in an unsigned tx, so it can be decoded by the ledger
+	tx, err := decodeTx(EncodeTuple(body, []byte{0xa0}, []byte{0xf5}, []byte{0xf6}))
+	if err != nil {
+		return nil, newSignPolicyError("invalid tx body: %v", err)
+	}
+
+	if len(req.Inputs) == 0 {
+		return nil, newSignPolicyError("no wallet inputs")
+	}
+
+	// the outputs of a parent tx can be trusted because the tx hash, which is part of the input, is the hash of its body
+	parentOutputs := make(map[string]UTXO)
+	for _, parentHex := range req.ParentTxs {
+		parentBytes, err := hex.DecodeString(parentHex)
+		if err != nil {
+			return nil, newSignPolicyError("invalid parent tx hex")
+		}
+
+		parent, err := decodeTx(parentBytes)
+		if err != nil {
+			return nil, newSignPolicyError("invalid parent tx: %v", err)
+		}
+
+		for _, prod := range parent.Produced() {
+			parentOutputs[inputKey(prod.Id)] = ledgerUtxoToUTXO(prod)
+		}
+	}
+
+	isOwn := func(addr string) bool {
+		a, err := common.NewAddress(addr)
+		return err == nil && isKeyAddress(a) && a.PaymentKeyHash().String() == keyHash
+	}
+
+	// returns the wallet UTXOs among the inputs, an input that can't be resolved might belong to the wallet, so it is refused
+	walletUTXOs := func(inputs []common.TransactionInput) (map[string]UTXO, error) {
+		res := make(map[string]UTXO)
+
+		for _, in := range inputs {
+			u, ok := parentOutputs[inputKey(in)]
+			if !ok {
+				var err error
+				if u, ok, err = resolve(in); err != nil {
+					return nil, err
+				} else if !ok {
+					return nil, newSignPolicyError("input %s isn't an unspent output on chain or of a parent tx", inputKey(in))
+				}
+			}
+
+			if isOwn(u.Address) {
+				res[inputKey(in)] = u
+			}
+		}
+
+		return res, nil
+	}
+
+	walletInputs, err := walletUTXOs(tx.Inputs())
+	if err != nil {
+		return nil, err
+	}
+
+	walletCollateral, err := walletUTXOs(tx.Collateral())
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]struct{})
+	for _, u := range req.Inputs {
+		key := fmt.Sprintf("%s#%d", u.TxID, u.OutputIndex)
+		expected[key] = struct{}{}
+
+		_, spent := walletInputs[key]
+		_, collateral := walletCollateral[key]
+
+		if !spent && !collateral {
+			return nil, newSignPolicyError("input %s isn't a wallet UTXO used by the tx", key)
+		}
+	}
+
+	for _, used := range []map[string]UTXO{walletInputs, walletCollateral} {
+		for key := range used {
+			if _, ok := expected[key]; !ok {
+				return nil, newSignPolicyError("wallet UTXO %s is used by the tx but isn't an expected input", key)
+			}
+		}
+	}
+
+	sumLovelace := func(utxos map[string]UTXO) (uint64, error) {
+		var sum uint64
+		for key, u := range utxos {
+			lovelace, err := strconv.ParseUint(u.Lovelace, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid lovelace of input %s", key)
+			}
+
+			sum += lovelace
+		}
+
+		return sum, nil
+	}
+
+	var value uint64
+
+	switch req.Purpose {
+	case signPurposeCollateral:
+		if len(walletInputs) > 0 {
+			return nil, newSignPolicyError("wallet UTXOs can't be spent by a tx using the wallet collateral")
+		}
+
+		if len(walletCollateral) != 1 || len(tx.Collateral()) != 1 || tx.CollateralReturn() != nil {
+			return nil, newSignPolicyError("the wallet UTXO must be the only collateral, without collateral return")
+		}
+
+		if value, err = sumLovelace(walletCollateral); err != nil {
+			return nil, err
+		}
+	case signPurposeSponsor, signPurposeCollateralPool:
+		if len(walletCollateral) > 0 {
+			return nil, newSignPolicyError("wallet UTXOs can't be used as collateral")
+		}
+
+		if len(walletInputs) == 0 {
+			return nil, newSignPolicyError("no wallet inputs spent by the tx")
+		}
+
+		if value, err = sumLovelace(walletInputs); err != nil {
+			return nil, err
+		}
+
+		returned := uint64(0)
+		for _, output := range tx.Outputs() {
+			if isOwn(output.Address().String()) {
+				returned += output.Amount()
+			}
+		}
+
+		value = max(value, returned) - returned
+	default:
+		return nil, newSignPolicyError("unknown purpose %q", req.Purpose)
+	}
+
+	if policy.MaxLovelace > 0 && value > policy.MaxLovelace {
+		return nil, newSignPolicyError("tx moves %d lovelace out of the wallet, more than the maximum %d", value, policy.MaxLovelace)
+	}
+
+	// the witness must only authorize spending the wallet inputs
+	for _, signer := range tx.RequiredSigners() {
+		if signer.String() == keyHash {
+			return nil, newSignPolicyError("wallet key can't be a required signer")
+		}
+	}
+
+	for addr := range tx.Withdrawals() {
+		if addr.Type() == common.AddressTypeNoneKey && addr.StakeKeyHash().String() == keyHash {
+			return nil, newSignPolicyError("wallet key can't authorize withdrawals")
+		}
+	}
+
+	for _, cert := range tx.Certificates() {
+		if cred := certificateCredential(cert); cred != nil && hex.EncodeToString(cred.Credential[:]) == keyHash {
+			return nil, newSignPolicyError("wallet key can't authorize certificates")
+		}
+	}
+
+	return tx.Hash().Bytes(), nil
+}
+
+// RemoteSigner forwards signing requests to a signer process, over HTTPS with client certificates, or over a Unix socket with peer credential checks
+type RemoteSigner struct {
+	url     string
+	client  *http.Client
+	address string
+}
+
+type RemoteSignerConfig struct {
+	URL string // unix:///path/to/socket or https://host:port
+
+	// HTTPS
+	Cert string // client certificate and key
+	Key  string
+	CA   string // CA of the signer certificate
+
+	// Unix socket
+	UID int // expected user ID of the signer process
+}
+
+func NewRemoteSigner(cfg RemoteSignerConfig) (*RemoteSigner, error) {
+	transport := &http.Transport{}
+
+	var baseURL string
+
+	if path, ok := strings.CutPrefix(cfg.URL, "unix://"); ok {
+		if cfg.UID < 0 {
+			return nil, errors.New("the user ID of the remote signer must be set for Unix sockets")
+		}
+
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, "unix", path)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := checkPeerUID(conn, []int{cfg.UID}); err != nil {
+				conn.Close()
+				return nil, err
+			}
+
+			return conn, nil
+		}
+
+		baseURL = "http://signer"
+	} else if strings.HasPrefix(cfg.URL, "https://") {
+		tlsConfig, err := newSignerTLSConfig(cfg.Cert, cfg.Key, cfg.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = tlsConfig
+		baseURL = strings.TrimSuffix(cfg.URL, "/")
+	} else {
+		return nil, fmt.Errorf("unsupported remote signer URL %s, expected unix:// or https://", cfg.URL)
+	}
+
+	s := &RemoteSigner{url: baseURL, client: &http.Client{Transport: transport, Timeout: remoteSignerTimeout}}
+
+	var res SignerAddressResponse
+	if err := s.call(http.MethodGet, "/address", nil, &res); err != nil {
+		return nil, fmt.Errorf("unable to reach the remote signer (%w)", err)
+	}
+
+	s.address = res.Address
+
+	return s, nil
+}
+
+func (s *RemoteSigner) Address() string {
+	return s.address
+}
+
+func (s *RemoteSigner) Sign(req SignRequest) (common.VkeyWitness, error) {
+	var res SignResponse
+	if err := s.call(http.MethodPost, "/sign", req, &res); err != nil {
+		return common.VkeyWitness{}, err
+	}
+
+	witnessBytes, err := hex.DecodeString(res.Witness)
+	if err != nil {
+		return common.VkeyWitness{}, fmt.Errorf("invalid witness from remote signer (%w)", err)
+	}
+
+	var witness common.VkeyWitness
+	if _, err := cbor.Decode(witnessBytes, &witness); err != nil {
+		return common.VkeyWitness{}, fmt.Errorf("invalid witness from remote signer (%w)", err)
+	}
+
+	return witness, nil
+}
+
+func (s *RemoteSigner) call(method string, path string, req any, res any) error {
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	httpReq, err := http.NewRequest(method, s.url+path, body)
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return json.Unmarshal(data, res)
+	case http.StatusForbidden:
+		return &SignPolicyError{strings.TrimSpace(string(data))}
+	default:
+		return fmt.Errorf("remote signer responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+}
+
+// newSignerTLSConfig loads a certificate, and the CA used to verify the certificate of the other side
+func newSignerTLSConfig(certFile string, keyFile string, caFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" || caFile == "" {
+		return nil, errors.New("a certificate, a key and a CA are required for mutual TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// SignerServer exposes a local signer to Iris processes
+type SignerServer struct {
+	signer *LocalSigner
+}
+
+func (s *SignerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/address":
+		if r.Method != http.MethodGet {
+			invalidMethod(w, r)
+			return
+		}
+
+		respondWithJSON(w, SignerAddressResponse{s.signer.Address()})
+	case "/sign":
+		if r.Method != http.MethodPost {
+			invalidMethod(w, r)
+			return
+		}
+
+		var req SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		witness, err := s.signer.Sign(req)
+
+		var policyErr *SignPolicyError
+		if errors.As(err, &policyErr) {
+			log.Printf("refused to sign %s tx (%v)", req.Purpose, err)
+			http.Error(w, policyErr.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			internalError(w, err)
+			return
+		}
+
+		witnessBytes, err := cbor.Encode(witness)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+
+		respondWithJSON(w, SignResponse{hex.EncodeToString(witnessBytes)})
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
+// listener that drops Unix socket connections from unexpected users
+type peerCheckListener struct {
+	net.Listener
+	uids []int
+}
+
+func (l *peerCheckListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkPeerUID(conn, l.uids); err != nil {
+			log.Printf("rejected signer connection (%v)", err)
+			conn.Close()
+			continue
+		}
+
+		return conn, nil
+	}
+}
+
+// ListenSigner listens on unix:///path/to/socket, accepting connections from the given users, or on a TCP address using mutual TLS
+func ListenSigner(addr string, uids []int, certFile string, keyFile string, caFile string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		if len(uids) == 0 {
+			return nil, errors.New("the user IDs of the clients must be set for Unix sockets")
+		}
+
+		os.Remove(path)
+
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.Chmod(path, 0o666); err != nil {
+			l.Close()
+			return nil, err
+		}
+
+		return &peerCheckListener{l, uids}, nil
+	}
+
+	tlsConfig, err := newSignerTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.Listen("tcp", addr, tlsConfig)
+}
+
+// signTx asks the signer for the vkey witness of the wallet, and inserts it into the tx.
+// inputs are the wallet UTXOs spent by the tx, or used as its collateral.
+func (h *Handler) signTx(tx ledger.Transaction, purpose string, inputs []UTXO) (ledger.Transaction, []byte, error) {
+	items, err := splitTx(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the signer can't see the mempool, so the txs producing unconfirmed inputs are sent along
+	parents := []string{}
+	added := make(map[string]struct{})
+	for _, in := range append(append([]common.TransactionInput{}, tx.Inputs()...), tx.Collateral()...) {
+		txID := in.Id().String()
+		if _, ok := added[txID]; ok {
+			continue
+		}
+
+		if parent := h.mempool.GetTx(txID); parent != nil {
+			parents = append(parents, hex.EncodeToString(parent.Cbor()))
+			added[txID] = struct{}{}
+		}
+	}
+
+	witness, err := h.signer.Sign(SignRequest{Purpose: purpose, TxBody: hex.EncodeToString(items[0]), Inputs: inputs, ParentTxs: parents})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addr, err := common.NewAddress(h.signer.Address())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if common.Blake2b224Hash(witness.Vkey) != addr.PaymentKeyHash() || !crypto.PubKey(witness.Vkey).Verify(tx.Hash().Bytes(), witness.Signature) {
+		return nil, nil, errors.New("invalid witness returned by the signer")
+	}
+
+	return insertVkeyWitness(tx, witness)
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// checks the user ID of the process at the other end of a Unix socket connection, using SO_PEERCRED
+func checkPeerUID(conn net.Conn, uids []int) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("not a Unix socket connection")
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var (
+		cred    *unix.Ucred
+		credErr error
+	)
+
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return err
+	}
+
+	if credErr != nil {
+		return fmt.Errorf("peer credentials unavailable (%v)", credErr)
+	}
+
+	if !slices.Contains(uids, int(cred.Uid)) {
+		return fmt.Errorf("unexpected peer user ID %d", cred.Uid)
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+func checkPeerUID(conn net.Conn, uids []int) error {
+	return errors.New("peer credentials not supported on this platform")
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+	"github.com/echovl/cardano-go/crypto"
+)
+
+// returns a resolver of the given UTXOs, standing in for the chain
+func newSignerTestResolver(utxos ...UTXO) func(common.TransactionInput) (UTXO, bool, error) {
+	return func(in common.TransactionInput) (UTXO, bool, error) {
+		for _, u := range utxos {
+			if u.TxID == in.Id().String() && u.OutputIndex == int(in.Index()) {
+				return u, true, nil
+			}
+		}
+
+		return UTXO{}, false, nil
+	}
+}
+
+func TestLocalSigner(t *testing.T) {
+	walletAddress, err := firstEnterpriseAddress(strings.Fields(sponsorTestMnemonic), "preprod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walletAddr, err := common.NewAddress(walletAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherAddr := newValidatorTestKey(2)
+
+	walletUTXO := UTXO{TxID: strings.Repeat("bb", 32), OutputIndex: 0, Address: walletAddress, Lovelace: "5000000"}
+	walletInput := shelley.NewShelleyTransactionInput(walletUTXO.TxID, walletUTXO.OutputIndex)
+
+	collateralUTXO := UTXO{TxID: strings.Repeat("cc", 32), OutputIndex: 1, Address: walletAddress, Lovelace: "2000000"}
+	collateralInput := shelley.NewShelleyTransactionInput(collateralUTXO.TxID, collateralUTXO.OutputIndex)
+
+	clientUTXO := UTXO{TxID: strings.Repeat("aa", 32), OutputIndex: 0, Address: otherAddr.String(), Lovelace: "2000000"}
+	clientInput := shelley.NewShelleyTransactionInput(clientUTXO.TxID, clientUTXO.OutputIndex)
+
+	unknownInput := shelley.NewShelleyTransactionInput(strings.Repeat("dd", 32), 0)
+
+	signer, err := NewLocalSigner(strings.Fields(sponsorTestMnemonic), "preprod", SignerPolicy{MaxLovelace: 3000000}, newSignerTestResolver(walletUTXO, collateralUTXO, clientUTXO))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unconfirmed wallet UTXO, only known through its parent tx
+	parentTx := encodeSponsorTestTx(t, validatorTestBody{
+		inputs:  []common.TransactionInput{clientInput},
+		outputs: []validatorTestOutput{{walletAddr, 1800000}},
+		fee:     200000,
+		ttl:     2000,
+	}.encoded())
+
+	parentUTXO := UTXO{TxID: parentTx.Hash().String(), OutputIndex: 0, Address: walletAddress, Lovelace: "1800000"}
+
+	encodeInput := func(in common.TransactionInput) []any {
+		id := in.Id()
+		return []any{id[:], in.Index()}
+	}
+
+	sponsoredBody := func(change uint64) map[uint]any {
+		return validatorTestBody{
+			inputs:  []common.TransactionInput{clientInput, walletInput},
+			outputs: []validatorTestOutput{{otherAddr, 2000000}, {walletAddr, change}},
+			fee:     200000,
+			ttl:     2000,
+		}.encoded()
+	}
+
+	collateralBody := func() map[uint]any {
+		body := validatorTestBody{
+			inputs:  []common.TransactionInput{clientInput},
+			outputs: []validatorTestOutput{{otherAddr, 1800000}},
+			fee:     200000,
+			ttl:     2000,
+		}.encoded()
+		body[13] = []any{encodeInput(collateralInput)}
+		return body
+	}
+
+	testCases := []struct {
+		name    string
+		purpose string
+		body    map[uint]any
+		inputs  []UTXO
+		parents []string
+		ok      bool
+	}{
+		{"Sponsor", signPurposeSponsor, sponsoredBody(4800000), []UTXO{walletUTXO}, nil, true},
+		{"AboveMaxLovelace", signPurposeSponsor, sponsoredBody(1000000), []UTXO{walletUTXO}, nil, false},
+		{"InputNotSpent", signPurposeSponsor, sponsoredBody(4800000), []UTXO{collateralUTXO}, nil, false},
+		{"NotWalletInput", signPurposeSponsor, sponsoredBody(4800000), []UTXO{clientUTXO}, nil, false},
+		{"NoInputs", signPurposeSponsor, sponsoredBody(4800000), nil, nil, false},
+		{"UnknownPurpose", "other", sponsoredBody(4800000), []UTXO{walletUTXO}, nil, false},
+		// the lovelace reported by Iris is ignored, the input is resolved by the signer
+		{"UnderreportedInput", signPurposeSponsor, sponsoredBody(1000000), []UTXO{{TxID: walletUTXO.TxID, OutputIndex: 0, Address: walletAddress, Lovelace: "1200000"}}, nil, false},
+		{"UnexpectedWalletInput", signPurposeSponsor, func() map[uint]any {
+			body := sponsoredBody(4800000)
+			body[0] = []any{encodeInput(clientInput), encodeInput(walletInput), encodeInput(collateralInput)}
+			return body
+		}(), []UTXO{walletUTXO}, nil, false},
+		{"UnresolvedInput", signPurposeSponsor, func() map[uint]any {
+			body := sponsoredBody(4800000)
+			body[0] = []any{encodeInput(unknownInput), encodeInput(walletInput)}
+			return body
+		}(), []UTXO{walletUTXO}, nil, false},
+		{"ParentTx", signPurposeCollateralPool, validatorTestBody{
+			inputs:  []common.TransactionInput{shelley.NewShelleyTransactionInput(parentUTXO.TxID, 0)},
+			outputs: []validatorTestOutput{{walletAddr, 1600000}},
+			fee:     200000,
+			ttl:     2000,
+		}.encoded(), []UTXO{parentUTXO}, []string{hex.EncodeToString(parentTx.Cbor())}, true},
+		{"ParentTxMissing", signPurposeCollateralPool, validatorTestBody{
+			inputs:  []common.TransactionInput{shelley.NewShelleyTransactionInput(parentUTXO.TxID, 0)},
+			outputs: []validatorTestOutput{{walletAddr, 1600000}},
+			fee:     200000,
+			ttl:     2000,
+		}.encoded(), []UTXO{parentUTXO}, nil, false},
+		{"Collateral", signPurposeCollateral, collateralBody(), []UTXO{collateralUTXO}, nil, true},
+		{"CollateralNotInTx", signPurposeCollateral, sponsoredBody(4800000), []UTXO{walletUTXO}, nil, false},
+		{"CollateralAlsoSpent", signPurposeCollateral, func() map[uint]any {
+			body := collateralBody()
+			body[0] = []any{encodeInput(clientInput), encodeInput(collateralInput)}
+			return body
+		}(), []UTXO{collateralUTXO}, nil, false},
+		{"CollateralSpendsWalletInput", signPurposeCollateral, func() map[uint]any {
+			body := collateralBody()
+			body[0] = []any{encodeInput(clientInput), encodeInput(walletInput)}
+			return body
+		}(), []UTXO{collateralUTXO}, nil, false},
+		{"WalletRequiredSigner", signPurposeCollateral, func() map[uint]any {
+			body := collateralBody()
+			keyHash := walletAddr.PaymentKeyHash()
+			body[14] = []any{keyHash[:]}
+			return body
+		}(), []UTXO{collateralUTXO}, nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bodyBytes, err := cbor.Encode(tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			witness, err := signer.Sign(SignRequest{Purpose: tc.purpose, TxBody: hex.EncodeToString(bodyBytes), Inputs: tc.inputs, ParentTxs: tc.parents})
+
+			if !tc.ok {
+				var policyErr *SignPolicyError
+				if !errors.As(err, &policyErr) {
+					t.Fatalf("expected policy error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tx := encodeSponsorTestTx(t, tc.body)
+
+			if !crypto.PubKey(witness.Vkey).Verify(tx.Hash().Bytes(), witness.Signature) {
+				t.Errorf("invalid signature")
+			}
+
+			if common.Blake2b224Hash(witness.Vkey) != walletAddr.PaymentKeyHash() {
+				t.Errorf("witness isn't made with the wallet key")
+			}
+		})
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on linux")
+	}
+
+	walletAddress, err := firstEnterpriseAddress(strings.Fields(sponsorTestMnemonic), "preprod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walletUTXO := UTXO{TxID: strings.Repeat("bb", 32), OutputIndex: 0, Address: walletAddress, Lovelace: "5000000"}
+
+	local, err := NewLocalSigner(strings.Fields(sponsorTestMnemonic), "preprod", SignerPolicy{}, newSignerTestResolver(walletUTXO))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := "unix://" + filepath.Join(t.TempDir(), "signer.sock")
+
+	listener, err := ListenSigner(socket, []int{os.Getuid()}, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go http.Serve(listener, &SignerServer{local})
+
+	if _, err := NewRemoteSigner(RemoteSignerConfig{URL: socket, UID: os.Getuid() + 1}); err == nil {
+		t.Fatalf("expected signer running as another user to be rejected")
+	}
+
+	remote, err := NewRemoteSigner(RemoteSignerConfig{URL: socket, UID: os.Getuid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if remote.Address() != local.Address() {
+		t.Fatalf("expected address %s, got %s", local.Address(), remote.Address())
+	}
+
+	walletAddr, _ := common.NewAddress(local.Address())
+
+	body := validatorTestBody{
+		inputs:  []common.TransactionInput{shelley.NewShelleyTransactionInput(walletUTXO.TxID, 0)},
+		outputs: []validatorTestOutput{{walletAddr, 4800000}},
+		fee:     200000,
+		ttl:     2000,
+	}.encoded()
+
+	bodyBytes, err := cbor.Encode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := SignRequest{Purpose: signPurposeCollateralPool, TxBody: hex.EncodeToString(bodyBytes), Inputs: []UTXO{walletUTXO}}
+
+	expected, err := local.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	witness, err := remote.Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(witness.Signature) != hex.EncodeToString(expected.Signature) {
+		t.Errorf("remote signature doesn't match the local one")
+	}
+
+	req.Purpose = signPurposeCollateral
+
+	var policyErr *SignPolicyError
+	if _, err := remote.Sign(req); !errors.As(err, &policyErr) {
+		t.Errorf("expected policy error, got %v", err)
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+)
+
+// daily spending caps apply to a rolling window
+const sponsorCapWindow = 24 * time.Hour
+
+// SponsorshipConfig is read from /etc/cardano-iris/sponsorship, sponsorship is disabled if the file doesn't exist
+type SponsorshipConfig struct {
+	Clients map[string]SponsorshipClient `json:"clients"` // keyed by bearer token
+}
+
+type SponsorshipClient struct {
+	Name              string   `json:"name"`
+	MaxLovelacePerTx  uint64   `json:"maxLovelacePerTx"`  // fee and deposits, required
+	MaxLovelacePerDay uint64   `json:"maxLovelacePerDay"` // over the last 24 hours, 0 for no limit
+	AllowedScripts    []string `json:"allowedScripts"`    // hashes of the scripts sponsored txs can run, including minting policies
+}
+
+// Validate checks that every client has a per-tx limit, deposits can be large (e.g. for governance proposals) so sponsoring can't be unlimited
+func (cfg *SponsorshipConfig) Validate() error {
+	for _, client := range cfg.Clients {
+		if client.MaxLovelacePerTx == 0 {
+			return fmt.Errorf("maxLovelacePerTx of client %q must be set", client.Name)
+		}
+	}
+
+	return nil
+}
+
+type SponsorTxResponse struct {
+	CBORHex string `json:"cborHex"` // signed by the wallet, but still missing the signatures of the client
+	TxID    string `json:"txID"`
+	Fee     uint64 `json:"fee"`
+	Cost    uint64 `json:"cost"`    // lovelace paid by the wallet, including the fee
+	Input   UTXO   `json:"input"`   // wallet UTXO added to the tx, locked until the tx is submitted or the lock expires
+	Witness string `json:"witness"` // vkey witness of the wallet, CBOR hex
+}
+
+// TxSponsorError is returned if a tx can't be sponsored
+type TxSponsorError struct {
+	Message string
+}
+
+func (e *TxSponsorError) Error() string {
+	return e.Message
+}
+
+func newTxSponsorError(format string, args ...any) *TxSponsorError {
+	return &TxSponsorError{fmt.Sprintf(format, args...)}
+}
+
+type sponsorSpend struct {
+	time     time.Time
+	lovelace uint64
+}
+
+// Sponsor keeps track of the lovelace spent on behalf of each sponsorship client.
+// Spending is kept in memory, so the daily caps are reset when Iris restarts.
+type Sponsor struct {
+	clients map[string]SponsorshipClient
+	mu      sync.Mutex
+	spent   map[string][]sponsorSpend // keyed by client name
+}
+
+func NewSponsor(cfg *SponsorshipConfig) *Sponsor {
+	return &Sponsor{
+		clients: cfg.Clients,
+		spent:   make(map[string][]sponsorSpend),
+	}
+}
+
+// Client returns the client configured for the given bearer token
+func (s *Sponsor) Client(token string) (SponsorshipClient, bool) {
+	var (
+		client SponsorshipClient
+		found  bool
+	)
+
+	// compare all tokens, so the response time doesn't leak which tokens exist
+	for t, c := range s.clients {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			client = c
+			found = true
+		}
+	}
+
+	return client, found
+}
+
+// Reserve records the cost of a sponsored tx, returns a *TxSponsorError if a cap of the client would be exceeded.
+// The cost is counted even if the client never submits the tx.
+func (s *Sponsor) Reserve(client SponsorshipClient, cost uint64, now time.Time) error {
+	if cost > client.MaxLovelacePerTx {
+		return newTxSponsorError("sponsoring the tx costs %d lovelace, more than the limit of %d per tx", cost, client.MaxLovelacePerTx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recent := []sponsorSpend{}
+	total := uint64(0)
+
+	for _, spend := range s.spent[client.Name] {
+		if now.Sub(spend.time) < sponsorCapWindow {
+			recent = append(recent, spend)
+			total += spend.lovelace
+		}
+	}
+
+	s.spent[client.Name] = recent
+
+	if client.MaxLovelacePerDay != 0 && total+cost > client.MaxLovelacePerDay {
+		return newTxSponsorError("sponsoring the tx costs %d lovelace, but only %d of the daily limit of %d remains", cost, client.MaxLovelacePerDay-min(total, client.MaxLovelacePerDay), client.MaxLovelacePerDay)
+	}
+
+	s.spent[client.Name] = append(recent, sponsorSpend{now, cost})
+
+	return nil
+}
+
+// Refund removes the cost recorded by Reserve at the given time, e.g. if the tx couldn't be signed
+func (s *Sponsor) Refund(client SponsorshipClient, cost uint64, reservedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spent := s.spent[client.Name]
+	for i, spend := range spent {
+		if spend.time.Equal(reservedAt) && spend.lovelace == cost {
+			s.spent[client.Name] = append(spent[:i], spent[i+1:]...)
+			return
+		}
+	}
+}
+
+// checkSponsoredScripts returns an error if the tx runs scripts that aren't allowed for the client.
+// Scripts locking spent inputs, minting policies, and scripts witnessing withdrawals and certificates are checked.
+func checkSponsoredScripts(client SponsorshipClient, tx ledger.Transaction, utxos map[string]UTXO) error {
+	allowed := make(map[string]struct{})
+	for _, h := range client.AllowedScripts {
+		allowed[h] = struct{}{}
+	}
+
+	for _, h := range txScriptHashes(tx, utxos) {
+		if _, ok := allowed[h]; !ok {
+			return newTxSponsorError("script %s isn't allowed", h)
+		}
+	}
+
+	return nil
+}
+
+// returns the sorted hashes of the scripts run by the tx, utxos must contain its spent inputs
+func txScriptHashes(tx ledger.Transaction, utxos map[string]UTXO) []string {
+	hashes := make(map[string]struct{})
+
+	for _, in := range tx.Inputs() {
+		utxo, ok := utxos[inputKey(in)]
+		if !ok {
+			continue
+		}
+
+		if addr, err := common.NewAddress(utxo.Address); err == nil && isScriptAddress(addr) {
+			hashes[addr.PaymentKeyHash().String()] = struct{}{}
+		}
+	}
+
+	if mint := tx.AssetMint(); mint != nil {
+		for _, policy := range mint.Policies() {
+			hashes[policy.String()] = struct{}{}
+		}
+	}
+
+	for addr := range tx.Withdrawals() {
+		if addr.Type() == common.AddressTypeNoneScript {
+			hashes[addr.StakeKeyHash().String()] = struct{}{}
+		}
+	}
+
+	for _, cert := range tx.Certificates() {
+		if cred := certificateCredential(cert); cred != nil && cred.CredType == common.CredentialTypeScriptHash {
+			hashes[hex.EncodeToString(cred.Credential[:])] = struct{}{}
+		}
+	}
+
+	sorted := make([]string, 0, len(hashes))
+	for h := range hashes {
+		sorted = append(sorted, h)
+	}
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// SponsorTx adds an input from the available UTXOs of the sponsor to an unsigned tx, along with a change output sent back to the sponsor address, and sets the fee.
+// The sponsor pays the fee and the deposits the client doesn't pay, the outputs of the client must be covered by its inputs, and the assets must already be balanced.
+// A surplus of the client inputs is refused, it would otherwise end up in the change output of the sponsor.
+// utxos must contain the inputs, reference inputs and collateral inputs of the tx.
+// Returns the unsigned sponsored tx, the selected UTXO and the lovelace paid by the sponsor.
+func SponsorTx(params CardanoCLIParameters, tx ledger.Transaction, utxos map[string]UTXO, available []UTXO, sponsorAddress string) (ledger.Transaction, UTXO, uint64, error) {
+	if !isBabbageOrConwayTx(tx) {
+		return nil, UTXO{}, 0, newTxSponsorError("only Babbage and Conway txs can be sponsored")
+	}
+
+	if !tx.IsValid() {
+		return nil, UTXO{}, 0, newTxSponsorError("txs marked as invalid can't be sponsored")
+	}
+
+	// the body changes, which would invalidate existing signatures
+	if ws := tx.Witnesses(); ws != nil && (len(ws.Vkey()) > 0 || len(ws.Bootstrap()) > 0) {
+		return nil, UTXO{}, 0, newTxSponsorError("tx is already signed, sign it after sponsoring")
+	}
+
+	for _, in := range tx.Inputs() {
+		if utxos[inputKey(in)].Address == sponsorAddress {
+			return nil, UTXO{}, 0, newTxSponsorError("tx spends input %s of the sponsor", inputKey(in))
+		}
+	}
+
+	if tx.CollateralReturn() != nil {
+		for _, in := range tx.Collateral() {
+			if utxos[inputKey(in)].Address == sponsorAddress {
+				return nil, UTXO{}, 0, newTxSponsorError("tx returns collateral %s of the sponsor", inputKey(in))
+			}
+		}
+	}
+
+	balance, ok := newTxBalance(params, tx, utxos)
+	if !ok {
+		return nil, UTXO{}, 0, newTxSponsorError("unable to determine the balance of the tx")
+	}
+
+	if !equalAssetQuantities(balance.consumedAssets, balance.producedAssets) {
+		return nil, UTXO{}, 0, newTxSponsorError("assets of the tx aren't balanced")
+	}
+
+	// the fee set by the client is replaced
+	missing := balance.produced - int64(tx.Fee()) - balance.consumed
+
+	if missing < 0 {
+		return nil, UTXO{}, 0, newTxSponsorError("the inputs of the tx exceed its outputs by %d lovelace, add a change output", -missing)
+	} else if deposits := max(balance.deposits, 0); missing > deposits {
+		return nil, UTXO{}, 0, newTxSponsorError("the outputs of the tx exceed its inputs by %d lovelace, only the fee and deposits are sponsored", missing-deposits)
+	}
+
+	items, err := splitTx(tx)
+	if err != nil {
+		return nil, UTXO{}, 0, err
+	}
+
+	candidates := append([]UTXO{}, available...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		li, _ := strconv.ParseUint(candidates[i].Lovelace, 10, 64)
+		lj, _ := strconv.ParseUint(candidates[j].Lovelace, 10, 64)
+
+		return li > lj
+	})
+
+	for _, candidate := range candidates {
+		if !sponsorInputKeepsRedeemers(tx, candidate) {
+			continue
+		}
+
+		sponsored, fee, ok, err := sponsorTxWithInput(params, tx, items, utxos, candidate, sponsorAddress, missing)
+		if err != nil {
+			return nil, UTXO{}, 0, err
+		} else if ok {
+			return sponsored, candidate, uint64(missing + int64(fee)), nil
+		}
+	}
+
+	return nil, UTXO{}, 0, newTxSponsorError("insufficient sponsor funds")
+}
+
+// returns false if the candidate doesn't have enough lovelace
+func sponsorTxWithInput(params CardanoCLIParameters, tx ledger.Transaction, items [][]byte, utxos map[string]UTXO, candidate UTXO, sponsorAddress string, missing int64) (ledger.Transaction, uint64, bool, error) {
+	lovelace, err := strconv.ParseInt(candidate.Lovelace, 10, 64)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	extended := make(map[string]UTXO, len(utxos)+1)
+	for k, u := range utxos {
+		extended[k] = u
+	}
+
+	extended[fmt.Sprintf("%s#%d", candidate.TxID, candidate.OutputIndex)] = candidate
+
+	fee := uint64(0)
+
+	for range maxBuildTxIterations {
+		change := lovelace - missing - int64(fee)
+		if change <= 0 {
+			return nil, 0, false, nil
+		}
+
+		changeOutput, err := EncodeTxOutput(sponsorAddress, strconv.FormatInt(change, 10), nil, "", "", "")
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		body, err := sponsorTxBody(items[0], candidate, changeOutput, fee)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		sponsored, err := joinTx([][]byte{body, items[1], items[2], items[3]})
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		outputs := sponsored.Outputs()
+		if last := outputs[len(outputs)-1]; uint64(change) < RequiredOutputLovelace(params, last) {
+			return nil, 0, false, nil
+		}
+
+		// none of the required signatures have been added yet
+		minFee := EstimateTxFee(params, sponsored, refScriptsSize(sponsored, extended), len(requiredSigners(sponsored, extended))).Fee
+		if fee >= minFee {
+			return sponsored, fee, true, nil
+		}
+
+		fee = minFee
+	}
+
+	return nil, 0, false, fmt.Errorf("sponsored tx fee didn't converge after %d iterations", maxBuildTxIterations)
+}
+
+// sponsorTxBody appends the sponsor input and change output to the encoded body, and replaces the fee
+func sponsorTxBody(bodyBytes []byte, input UTXO, changeOutput []byte, fee uint64) ([]byte, error) {
+	d, err := Decode(bodyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	body, ok := d.(*DecodedMap)
+	if !ok {
+		return nil, fmt.Errorf("decoded tx body isn't a map")
+	}
+
+	encodedInput, err := EncodeTxOutputID(input.TxID, input.OutputIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	input_, err := Decode(encodedInput)
+	if err != nil {
+		return nil, err
+	}
+
+	output_, err := Decode(changeOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	appendItem := func(key uint64, item Decoded) error {
+		for _, pair := range body.Pairs {
+			if k, ok := pair.Key.(*DecodedInt); ok && k.Value.Uint64() == key {
+				list, ok := pair.Value.(*DecodedList)
+				if !ok {
+					return fmt.Errorf("tx body entry %d isn't a list", key)
+				}
+
+				list.Items = append(list.Items, item)
+				return nil
+			}
+		}
+
+		return fmt.Errorf("tx body entry %d not found", key)
+	}
+
+	if err := appendItem(0, input_); err != nil {
+		return nil, err
+	}
+
+	if err := appendItem(1, output_); err != nil {
+		return nil, err
+	}
+
+	feeSet := false
+	for i, pair := range body.Pairs {
+		if k, ok := pair.Key.(*DecodedInt); ok && k.Value.Uint64() == 2 {
+			body.Pairs[i].Value = &DecodedInt{new(big.Int).SetUint64(fee)}
+			feeSet = true
+		}
+	}
+
+	if !feeSet {
+		return nil, fmt.Errorf("tx body fee not found")
+	}
+
+	return body.Cbor(), nil
+}
+
+// spend redeemers refer to inputs by their position in the sorted input set, so the sponsor input must come after all the inputs that have redeemers
+func sponsorInputKeepsRedeemers(tx ledger.Transaction, candidate UTXO) bool {
+	ws := tx.Witnesses()
+	if ws == nil || ws.Redeemers() == nil {
+		return true
+	}
+
+	indexes := ws.Redeemers().Indexes(common.RedeemerTagSpend)
+	if len(indexes) == 0 {
+		return true
+	}
+
+	inputs := append([]common.TransactionInput{}, tx.Inputs()...)
+	sort.Slice(inputs, func(i, j int) bool {
+		return compareTxInputs(inputs[i].Id().Bytes(), inputs[i].Index(), inputs[j].Id().Bytes(), inputs[j].Index()) < 0
+	})
+
+	last := uint(0)
+	for _, i := range indexes {
+		last = max(last, i)
+	}
+
+	if int(last) >= len(inputs) {
+		return false
+	}
+
+	candidateID, err := hex.DecodeString(candidate.TxID)
+	if err != nil {
+		return false
+	}
+
+	return compareTxInputs(inputs[last].Id().Bytes(), inputs[last].Index(), candidateID, uint32(candidate.OutputIndex)) < 0
+}
+
+// inputs are ordered by tx hash, then by output index
+func compareTxInputs(idA []byte, indexA uint32, idB []byte, indexB uint32) int {
+	if c := bytes.Compare(idA, idB); c != 0 {
+		return c
+	}
+
+	switch {
+	case indexA < indexB:
+		return -1
+	case indexA > indexB:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+const (
+	sponsorTestMnemonic = "abandon amount liar amount expire adjust cage candy arch gather drum bullet absurd math era live bid rhythm alien crouch range attend journey unaware"
+	clientTestMnemonic  = "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote"
+)
+
+func encodeSponsorTestTx(t *testing.T, body map[uint]any) ledger.Transaction {
+	txBytes, err := cbor.Encode([]any{body, map[uint]any{}, true, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+func TestSponsorTx(t *testing.T) {
+	params := newValidatorTestParams()
+
+	sponsorAddr, err := firstEnterpriseAddress(strings.Fields(sponsorTestMnemonic), "preprod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sponsorKey, err := firstEnterprisePrvKey(strings.Fields(sponsorTestMnemonic))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientAddr, err := firstEnterpriseAddress(strings.Fields(clientTestMnemonic), "preprod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, err := firstEnterprisePrvKey(strings.Fields(clientTestMnemonic))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherAddr := newValidatorTestKey(2)
+
+	clientInputTxID := strings.Repeat("aa", 32)
+	clientInput := shelley.NewShelleyTransactionInput(clientInputTxID, 0)
+
+	utxos := map[string]UTXO{
+		inputKey(clientInput): {TxID: clientInputTxID, OutputIndex: 0, Address: clientAddr, Lovelace: "2000000"},
+	}
+
+	available := []UTXO{
+		{TxID: strings.Repeat("bb", 32), OutputIndex: 0, Address: sponsorAddr, Lovelace: "5000000"},
+		{TxID: strings.Repeat("cc", 32), OutputIndex: 1, Address: sponsorAddr, Lovelace: "900000"},
+	}
+
+	newBody := func(outputLovelace uint64) validatorTestBody {
+		return validatorTestBody{
+			inputs:  []common.TransactionInput{clientInput},
+			outputs: []validatorTestOutput{{otherAddr, outputLovelace}},
+			ttl:     2000,
+		}
+	}
+
+	t.Run("Balanced", func(t *testing.T) {
+		tx := encodeValidatorTestTx(t, newBody(2000000), nil)
+
+		sponsored, input, cost, err := SponsorTx(params, tx, utxos, available, sponsorAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if input.TxID != available[0].TxID {
+			t.Errorf("expected the largest UTXO to be selected, got %s", input.TxID)
+		}
+
+		if cost != sponsored.Fee() {
+			t.Errorf("expected the cost to be the fee %d, got %d", sponsored.Fee(), cost)
+		}
+
+		if len(sponsored.Inputs()) != 2 || len(sponsored.Outputs()) != 2 || sponsored.Outputs()[1].Address().String() != sponsorAddr {
+			t.Fatalf("sponsor input and change output not added")
+		}
+
+		if sponsored.Outputs()[1].Amount() != 5000000-cost {
+			t.Errorf("expected change %d, got %d", 5000000-cost, sponsored.Outputs()[1].Amount())
+		}
+
+		// both the sponsor and the client sign the sponsored tx
+		signed, _, err := addVkeyWitness(sponsored, sponsorKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signed, _, err = addVkeyWitness(signed, clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if signed.Hash() != sponsored.Hash() {
+			t.Fatalf("signing changed the tx body")
+		}
+
+		resolve := func(in common.TransactionInput) (UTXO, bool, error) {
+			if in.Id().String() == input.TxID && int(in.Index()) == input.OutputIndex {
+				return input, true, nil
+			}
+
+			utxo, ok := utxos[inputKey(in)]
+			return utxo, ok, nil
+		}
+
+		verr, err := NewTxValidator(params, 1500, resolve).Validate(signed)
+		if err != nil {
+			t.Fatal(err)
+		} else if verr != nil {
+			t.Fatalf("sponsored tx is invalid: %s", verr.Raw)
+		}
+	})
+
+	t.Run("MissingLovelace", func(t *testing.T) {
+		tx := encodeValidatorTestTx(t, newBody(3000000), nil)
+
+		if _, _, _, err := SponsorTx(params, tx, utxos, available, sponsorAddr); err == nil || !strings.Contains(err.Error(), "only the fee and deposits are sponsored") {
+			t.Errorf("expected unbalanced outputs to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Surplus", func(t *testing.T) {
+		tx := encodeValidatorTestTx(t, newBody(1500000), nil)
+
+		if _, _, _, err := SponsorTx(params, tx, utxos, available, sponsorAddr); err == nil || !strings.Contains(err.Error(), "add a change output") {
+			t.Errorf("expected surplus inputs to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Deposit", func(t *testing.T) {
+		withDeposit := params
+		withDeposit.StakeAddressDeposit = 2000000
+
+		stakeKeyHash := otherAddr.PaymentKeyHash()
+
+		body := newBody(2000000).encoded()
+		body[4] = []any{[]any{0, []any{0, stakeKeyHash[:]}}}
+
+		sponsored, _, cost, err := SponsorTx(withDeposit, encodeSponsorTestTx(t, body), utxos, available, sponsorAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cost != 2000000+sponsored.Fee() {
+			t.Errorf("expected the cost to include the deposit, got %d", cost)
+		}
+	})
+
+	t.Run("InsufficientFunds", func(t *testing.T) {
+		tx := encodeValidatorTestTx(t, newBody(2000000), nil)
+
+		if _, _, _, err := SponsorTx(params, tx, utxos, available[1:], sponsorAddr); err == nil || !strings.Contains(err.Error(), "insufficient") {
+			t.Errorf("expected insufficient funds error, got %v", err)
+		}
+	})
+
+	t.Run("AlreadySigned", func(t *testing.T) {
+		tx := encodeValidatorTestTx(t, newBody(2000000), nil)
+
+		signed, _, err := addVkeyWitness(tx, clientKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, _, err := SponsorTx(params, signed, utxos, available, sponsorAddr); err == nil {
+			t.Errorf("expected signed tx to be rejected")
+		}
+	})
+
+	t.Run("SpendsSponsorInput", func(t *testing.T) {
+		body := newBody(7000000)
+		sponsorInput := shelley.NewShelleyTransactionInput(available[0].TxID, available[0].OutputIndex)
+		body.inputs = append(body.inputs, sponsorInput)
+
+		withSponsor := map[string]UTXO{inputKey(sponsorInput): available[0]}
+		for k, u := range utxos {
+			withSponsor[k] = u
+		}
+
+		if _, _, _, err := SponsorTx(params, encodeValidatorTestTx(t, body, nil), withSponsor, available[1:], sponsorAddr); err == nil {
+			t.Errorf("expected tx spending a sponsor input to be rejected")
+		}
+	})
+
+	t.Run("Scripts", func(t *testing.T) {
+		policy := strings.Repeat("ab", 28)
+		policyID, _ := hex.DecodeString(policy)
+
+		body := newBody(2000000).encoded()
+		body[9] = map[cbor.ByteString]map[cbor.ByteString]int64{cbor.NewByteString(policyID): {cbor.NewByteString([]byte("test")): 1}}
+
+		tx := encodeSponsorTestTx(t, body)
+
+		if err := checkSponsoredScripts(SponsorshipClient{}, tx, utxos); err == nil {
+			t.Errorf("expected minting policy to be rejected")
+		}
+
+		if err := checkSponsoredScripts(SponsorshipClient{AllowedScripts: []string{policy}}, tx, utxos); err != nil {
+			t.Errorf("expected allowlisted minting policy to be accepted, got %v", err)
+		}
+
+		if err := checkSponsoredScripts(SponsorshipClient{}, encodeValidatorTestTx(t, newBody(2000000), nil), utxos); err != nil {
+			t.Errorf("expected tx without scripts to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestSponsorReserve(t *testing.T) {
+	client := SponsorshipClient{Name: "onboarding", MaxLovelacePerTx: 500000, MaxLovelacePerDay: 1000000}
+
+	sponsor := NewSponsor(&SponsorshipConfig{Clients: map[string]SponsorshipClient{"token": client}})
+
+	if _, ok := sponsor.Client("other"); ok {
+		t.Fatalf("unexpected client for unknown token")
+	}
+
+	if c, ok := sponsor.Client("token"); !ok || c.Name != client.Name {
+		t.Fatalf("expected client for token")
+	}
+
+	now := time.Now()
+
+	testCases := []struct {
+		name string
+		cost uint64
+		time time.Time
+		ok   bool
+	}{
+		{"First", 400000, now, true},
+		{"AbovePerTxCap", 600000, now, false},
+		{"Second", 400000, now.Add(time.Hour), true},
+		{"AboveDailyCap", 400000, now.Add(2 * time.Hour), false},
+		{"AfterWindow", 400000, now.Add(25 * time.Hour), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := sponsor.Reserve(client, tc.cost, tc.time)
+			if tc.ok && err != nil {
+				t.Errorf("unexpected error %v", err)
+			} else if !tc.ok && err == nil {
+				t.Errorf("expected cap to be exceeded")
+			}
+		})
+	}
+
+	// a refunded cost no longer counts towards the daily cap
+	refunded := NewSponsor(&SponsorshipConfig{Clients: map[string]SponsorshipClient{"token": client}})
+
+	for range 2 {
+		if err := refunded.Reserve(client, 500000, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	refunded.Refund(client, 500000, now)
+
+	if err := refunded.Reserve(client, 500000, now.Add(time.Minute)); err != nil {
+		t.Errorf("expected the refunded cost to be available again, got %v", err)
+	}
+}
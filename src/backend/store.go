@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -21,12 +22,16 @@ import (
 type Store struct {
 	immutable *ImmStore
 	volatile  *VolStore
+	cache     *BlockCache
 
-	// the store is frequently notified of tip changes
+	// the store is notified of changes by the filesystem (see storewatch.go), or by polling the tip if that isn't available
 	//  if the tip is different, the immutable and volatile stores must be updated
-	//   updating the immutable store involves rereading the last modified chunk, and reading and appending any new chunks
-	//   updating the volatile store also involves rereading the last modified chunk, and reading new chunks
+	//   updating the immutable store involves reading the entries appended to the last chunk, and reading and appending any new chunks
+	//   updating the volatile store involves decoding the blocks appended to each chunk, and reading new chunks
 	loadedTip string
+
+	// serializes syncing, which can be triggered by tip polling or by filesystem notifications
+	mu sync.Mutex
 }
 
 // keeps all secondary indices in memory, ignoring the primary indices for now
@@ -38,6 +43,7 @@ type ImmStore struct {
 	chunks []*ImmChunk
 
 	blockPtrs map[string]BlockPtr // TODO: are there more efficient keys than using some string encoding of the block hash?
+	cache     *BlockCache         // shared with the volatile store, set by LoadStore
 	mu        sync.RWMutex
 }
 
@@ -50,6 +56,7 @@ type VolStore struct {
 
 	latestChunk uint32
 	blockPtrs   map[string]BlockPtr
+	cache       *BlockCache // shared with the immutable store, set by LoadStore
 	mu          sync.RWMutex
 }
 
@@ -58,10 +65,23 @@ type ImmChunk struct {
 	secondaryIndices []SecondaryIndexEntry
 }
 
-// store completely in memory
+// store completely in memory, but only decode the blocks on demand
 type VolChunk struct {
 	modTime time.Time
-	blocks  []ledger.Block
+	blocks  []VolBlock
+
+	// number of bytes of the .dat file that have been split into blocks
+	//  a partially written block at the end of the file isn't included, so the next sync can continue from here
+	size int64
+}
+
+// the header fields needed for indexing and chain selection are extracted upfront, the rest of the block is kept as CBOR
+type VolBlock struct {
+	hash      string // hex encoded
+	prevHash  string // hex encoded
+	slot      uint64
+	blockType int
+	cbor      []byte // including the [blockType, block] wrapper
 }
 
 // pointer into the immutable db
@@ -83,7 +103,14 @@ type SecondaryIndexEntry struct {
 	SlotOrEpochNo uint64
 }
 
-func LoadStore(dir string) (*Store, error) {
+// size in bytes of each entry in a .secondary file
+var secondaryIndexEntrySize = binary.Size(SecondaryIndexEntry{})
+
+// returned when a chunk file is smaller than the part that has already been loaded
+var errChunkTruncated = errors.New("chunk file truncated")
+
+// cacheBudget is the approximate amount of memory (in bytes) that can be used for caching decoded blocks
+func LoadStore(dir string, cacheBudget int64) (*Store, error) {
 	imm, err := LoadImmStore(filepath.Join(dir, "immutable"))
 	if err != nil {
 		return nil, err
@@ -100,10 +127,16 @@ func LoadStore(dir string) (*Store, error) {
 		loadedTip = imm.Tip()
 	}
 
+	cache := NewBlockCache(cacheBudget)
+	imm.cache = cache
+	vol.cache = cache
+
 	return &Store{
 		imm,
 		vol,
+		cache,
 		loadedTip,
+		sync.Mutex{},
 	}, nil
 }
 
@@ -157,6 +190,7 @@ func LoadImmStore(dir string) (*ImmStore, error) {
 		dir,
 		chunks,
 		nil, // filled on-demand
+		nil,
 		sync.RWMutex{},
 	}, nil
 }
@@ -212,6 +246,7 @@ func LoadVolStore(dir string) (*VolStore, error) {
 		chunks,
 		latestChunk,
 		nil, // filled on-demand
+		nil,
 		sync.RWMutex{},
 	}, nil
 }
@@ -242,6 +277,9 @@ func (s *VolStore) Tip() string {
 }
 
 func (s *Store) NotifyTip(tip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.loadedTip == tip {
 		return
 	}
@@ -258,6 +296,27 @@ func (s *Store) NotifyTip(tip string) {
 	s.loadedTip = tip
 }
 
+// syncs the immutable and/or the volatile store without knowing the tip upfront (e.g. when notified by the filesystem)
+func (s *Store) syncChanged(immutable bool, volatile bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if immutable {
+		s.immutable.sync()
+	}
+
+	if volatile {
+		s.volatile.sync()
+	}
+
+	loadedTip := s.volatile.Tip()
+	if loadedTip == "" {
+		loadedTip = s.immutable.Tip()
+	}
+
+	s.loadedTip = loadedTip
+}
+
 func (s *ImmStore) chunkFilePath(id int) string {
 	return filepath.Join(s.dir, fmt.Sprintf("%05d.secondary", id))
 }
@@ -279,35 +338,50 @@ func (s *ImmStore) sync() {
 	s.syncNewBlocks()
 }
 
+// only the entries appended to the latest .secondary file since the previous sync are read
 func (s *ImmStore) syncLoadedBlocks() {
-	s.mu.Lock()
+	s.mu.RLock()
 	chunkID := s.latestChunkIDLocked()
+	if chunkID < 0 || s.chunks[chunkID] == nil {
+		s.mu.RUnlock()
+		return
+	}
 	chunk := s.chunks[chunkID]
-	path := s.chunkFilePath(chunkID)
+	nLoaded := len(chunk.secondaryIndices)
+	s.mu.RUnlock()
 
-	f, err := os.Open(path)
-	if err != nil {
-		fmt.Printf("unable to open %s during syncing: %v", path, err)
-	} else {
-		defer f.Close()
+	path := s.chunkFilePath(chunkID)
 
-		stat, err := f.Stat()
+	// file IO happens without holding the lock, the syncing itself is serialized by Store.mu
+	entries, modTime, err := readImmChunkTail(path, nLoaded)
+	if errors.Is(err, errChunkTruncated) {
+		reloadedChunk, err := loadImmChunk(path)
 		if err != nil {
-			fmt.Printf("unable to stat %s during syncing: %v", path, err)
-		} else {
-			if stat.ModTime().After(chunk.modTime) {
-				// reload chunk
-				reloadedChunk, err := loadImmChunk(path)
-				if err != nil {
-					fmt.Printf("unable to reload immutable chunk %s: %v", path, err)
-				} else {
-					if s.blockPtrs != nil {
-						reloadedChunk.indexBlocks(s.blockPtrs, chunkID)
-					}
-					s.chunks[chunkID] = reloadedChunk
-				}
-			}
+			log.Printf("unable to reload immutable chunk %s: %v", path, err)
+			return
 		}
+
+		s.mu.Lock()
+		if s.blockPtrs != nil {
+			reloadedChunk.indexBlocks(s.blockPtrs, chunkID)
+		}
+		s.chunks[chunkID] = reloadedChunk
+		s.mu.Unlock()
+		return
+	} else if err != nil {
+		log.Printf("unable to sync immutable chunk %s: %v", path, err)
+		return
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	chunk.secondaryIndices = append(chunk.secondaryIndices, entries...)
+	chunk.modTime = modTime
+	if s.blockPtrs != nil {
+		chunk.indexBlocksFrom(s.blockPtrs, chunkID, nLoaded)
 	}
 	s.mu.Unlock()
 }
@@ -374,73 +448,95 @@ func (s *VolStore) sync() {
 	s.pruneOrphanedBlockPtrs()
 }
 
+// only the blocks appended to each .dat file since the previous sync are decoded
 func (s *VolStore) syncLoadedBlocks() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+
 	for chunkID, chunk := range s.chunks {
 		path := s.chunkFilePath(int(chunkID))
 
-		f, err := os.Open(path)
-		if err != nil {
-			if err == os.ErrNotExist {
-				fmt.Printf("removing volatile chunk %s\n", path)
-
-				delete(s.chunks, chunkID)
-			} else {
-				fmt.Printf("unable to open %s during syncing: %v\n", path, err)
+		blocks, size, modTime, err := readVolChunkTail(path, chunk.size)
+		if errors.Is(err, os.ErrNotExist) {
+			// cardano-node removes volatile chunks once all their blocks are copied to the immutable db
+			log.Printf("removing volatile chunk %s", path)
+			delete(s.chunks, chunkID)
+			continue
+		} else if errors.Is(err, errChunkTruncated) {
+			reloadedChunk, err := loadVolChunk(path)
+			if err != nil {
+				log.Printf("unable to reload volatile chunk %s: %v", path, err)
+				continue
 			}
-		} else {
-			defer f.Close()
 
-			stat, err := f.Stat()
-			if err != nil {
-				fmt.Printf("unable to stat %s during syncing: %v\n", path, err)
-			} else {
-				if stat.ModTime().After(chunk.modTime) {
-					// reload chunk
-					reloadedChunk, err := loadVolChunk(path)
-					if err != nil {
-						fmt.Printf("unable to reload volatile chunk %s: %v\n", path, err)
-					} else {
-						if s.blockPtrs != nil {
-							reloadedChunk.indexBlocks(s.blockPtrs, int(chunkID))
-						}
-
-						s.chunks[chunkID] = reloadedChunk
-					}
-				}
+			if s.blockPtrs != nil {
+				reloadedChunk.indexBlocks(s.blockPtrs, int(chunkID))
 			}
+
+			s.chunks[chunkID] = reloadedChunk
+			continue
+		} else if err != nil {
+			log.Printf("unable to sync volatile chunk %s: %v", path, err)
+			continue
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		nLoaded := len(chunk.blocks)
+		chunk.blocks = append(chunk.blocks, blocks...)
+		chunk.size = size
+		chunk.modTime = modTime
+
+		if s.blockPtrs != nil {
+			chunk.indexBlocksFrom(s.blockPtrs, int(chunkID), nLoaded)
 		}
 	}
 }
 
+// volatile chunk IDs aren't contiguous (older chunks are removed by cardano-node), so list the directory instead of probing for the next ID
 func (s *VolStore) syncNewBlocks() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("unable to list volatile chunks in %s: %v", s.dir, err)
+		return
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	for nextID := s.latestChunkIDLocked() + 1; true; nextID += 1 {
-		nextPath := s.chunkFilePath(nextID)
-		nextFile, err := os.Open(nextPath)
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".dat" {
+			continue
+		}
+
+		id, err := extractChunkID(entry.Name())
 		if err != nil {
-			if err != os.ErrNotExist && !strings.Contains(err.Error(), "no such file") {
-				log.Printf("unable to read volatile chunk %s: %v", nextPath, err)
-			}
+			continue
+		}
 
-			break
+		if _, ok := s.chunks[id]; ok {
+			continue
 		}
 
-		defer nextFile.Close()
+		path := filepath.Join(s.dir, entry.Name())
 
-		nextChunk, err := readVolChunk(nextFile)
+		nextChunk, err := loadVolChunk(path)
 		if err != nil {
-			log.Printf("unable to read volatile chunk %s: %v", nextPath, err)
-			break
+			log.Printf("unable to read volatile chunk %s: %v", path, err)
+			continue
 		}
 
 		if s.blockPtrs != nil {
-			nextChunk.indexBlocks(s.blockPtrs, nextID)
+			nextChunk.indexBlocks(s.blockPtrs, int(id))
 		}
 
-		s.chunks[uint32(nextID)] = nextChunk
+		s.chunks[id] = nextChunk
+
+		if id > s.latestChunk {
+			s.latestChunk = id
+		}
 	}
 }
 
@@ -459,7 +555,7 @@ func (s *VolStore) pruneOrphanedBlockPtrs() {
 	}
 }
 
-// TODO: return ledger.Block instead of its CBOR bytes as hex
+// returns nil if not found
 func (s *Store) Block(blockID string) (ledger.Block, error) {
 	// first look up in immutable store due more likely cache hit
 	b, err := s.immutable.block(blockID)
@@ -472,9 +568,7 @@ func (s *Store) Block(blockID string) (ledger.Block, error) {
 	}
 
 	// now try looking up in volatile store
-	b = s.volatile.block(blockID)
-
-	return b, nil
+	return s.volatile.block(blockID)
 }
 
 func (s *ImmStore) has(blockID string) bool {
@@ -507,6 +601,10 @@ func (s *ImmStore) block(blockID string) (ledger.Block, error) {
 		return nil, nil
 	}
 
+	if b := s.cache.Get(blockID); b != nil {
+		return b, nil
+	}
+
 	chunk := s.chunks[ptr.I]
 	secondaryIndex := chunk.secondaryIndices[ptr.J]
 
@@ -556,6 +654,8 @@ func (s *ImmStore) block(blockID string) (ledger.Block, error) {
 		log.Printf("decoded %d bytes, but block is only %d bytes", nDecoded, n)
 	}
 
+	s.cache.Add(blockID, b, nDecoded)
+
 	return b, nil
 }
 
@@ -573,7 +673,28 @@ func (s *VolStore) has(blockID string) bool {
 }
 
 // returns nil if not found
-func (s *VolStore) block(blockID string) ledger.Block {
+func (s *VolStore) block(blockID string) (ledger.Block, error) {
+	vb := s.rawBlock(blockID)
+	if vb == nil {
+		return nil, nil
+	}
+
+	if b := s.cache.Get(blockID); b != nil {
+		return b, nil
+	}
+
+	b, _, err := decodeWrappedBlock(vb.cbor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Add(blockID, b, len(vb.cbor))
+
+	return b, nil
+}
+
+// returns nil if not found
+func (s *VolStore) rawBlock(blockID string) *VolBlock {
 	s.mu.RLock()
 	if s.blockPtrs == nil {
 		s.mu.RUnlock()
@@ -588,15 +709,13 @@ func (s *VolStore) block(blockID string) ledger.Block {
 	}
 
 	chunk, ok := s.chunks[ptr.I]
-	if !ok {
+	if !ok || int(ptr.J) >= len(chunk.blocks) {
 		return nil
 	}
 
-	var b ledger.Block
-	if int(ptr.J) < len(chunk.blocks) {
-		b = chunk.blocks[ptr.J]
-	}
-	return b
+	vb := chunk.blocks[ptr.J]
+
+	return &vb
 }
 
 func (s *ImmStore) indexBlocks() {
@@ -611,8 +730,13 @@ func (s *ImmStore) indexBlocks() {
 }
 
 func (c *ImmChunk) indexBlocks(ptrs map[string]BlockPtr, chunkID int) {
-	for i, entry := range c.secondaryIndices {
-		key := hex.EncodeToString(entry.BlockID[:])
+	c.indexBlocksFrom(ptrs, chunkID, 0)
+}
+
+// only indexes the entries starting at secondary index start
+func (c *ImmChunk) indexBlocksFrom(ptrs map[string]BlockPtr, chunkID int, start int) {
+	for i := start; i < len(c.secondaryIndices); i++ {
+		key := hex.EncodeToString(c.secondaryIndices[i].BlockID[:])
 
 		ptrs[key] = BlockPtr{uint32(chunkID), uint32(i)}
 	}
@@ -630,11 +754,13 @@ func (s *VolStore) indexBlocks() {
 }
 
 func (c *VolChunk) indexBlocks(ptrs map[string]BlockPtr, chunkID int) {
-	for i, b := range c.blocks {
-		hash := b.Header().Hash()
-		key := hex.EncodeToString(hash[:])
+	c.indexBlocksFrom(ptrs, chunkID, 0)
+}
 
-		ptrs[key] = BlockPtr{uint32(chunkID), uint32(i)}
+// only indexes the blocks starting at index start
+func (c *VolChunk) indexBlocksFrom(ptrs map[string]BlockPtr, chunkID int, start int) {
+	for i := start; i < len(c.blocks); i++ {
+		ptrs[c.blocks[i].hash] = BlockPtr{uint32(chunkID), uint32(i)}
 	}
 }
 
@@ -689,8 +815,7 @@ func (c *VolChunk) Tip() string {
 	if m == 0 {
 		return ""
 	} else {
-		hash := c.blocks[m-1].Header().Hash()
-		return hex.EncodeToString(hash[:])
+		return c.blocks[m-1].hash
 	}
 }
 
@@ -718,7 +843,8 @@ func readImmChunk(file *os.File) (*ImmChunk, error) {
 
 		// BigEndian has been verified to be correct thanks to trial-and-error
 		err := binary.Read(file, binary.BigEndian, &entry)
-		if err == io.EOF {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a partially written entry is picked up by the next sync
 			break
 		} else if err != nil {
 			return nil, err
@@ -733,6 +859,43 @@ func readImmChunk(file *os.File) (*ImmChunk, error) {
 	}, nil
 }
 
+// reads the secondary index entries following the first nLoaded entries
+// a partially written entry at the end of the file is ignored
+func readImmChunkTail(path string, nLoaded int) ([]SecondaryIndexEntry, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	offset := int64(nLoaded * secondaryIndexEntrySize)
+
+	if stat.Size() < offset {
+		return nil, time.Time{}, errChunkTruncated
+	} else if stat.Size() == offset {
+		return nil, stat.ModTime(), nil
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	n := int(stat.Size()-offset) / secondaryIndexEntrySize
+	entries := make([]SecondaryIndexEntry, n)
+
+	if err := binary.Read(file, binary.BigEndian, entries); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return entries, stat.ModTime(), nil
+}
+
 func loadVolChunk(path string) (*VolChunk, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -755,21 +918,78 @@ func readVolChunk(file *os.File) (*VolChunk, error) {
 		return nil, err
 	}
 
-	blocks := make([]ledger.Block, 0)
+	blocks, size, err := splitVolBlocks(bs)
+	if err != nil {
+		log.Printf("failed to read block %d from %s: %v", len(blocks)+1, stat.Name(), err)
+	}
+
+	return &VolChunk{stat.ModTime(), blocks, int64(size)}, nil
+}
+
+// decodes the blocks appended to a volatile chunk file after the first size bytes
+// returns the new total number of decoded bytes
+func readVolChunkTail(path string, size int64) ([]VolBlock, int64, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	if stat.Size() < size {
+		return nil, 0, time.Time{}, errChunkTruncated
+	} else if stat.Size() == size {
+		return nil, size, stat.ModTime(), nil
+	}
+
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		return nil, 0, time.Time{}, err
+	}
 
-	for len(bs) > 0 {
-		block, n, err := decodeWrappedBlock(bs)
+	bs, err := io.ReadAll(file)
+	if err != nil {
+		return nil, 0, time.Time{}, err
+	}
+
+	// an error here usually means that the last block is still being written, it will be picked up by the next sync
+	blocks, n, _ := splitVolBlocks(bs)
+
+	return blocks, size + int64(n), stat.ModTime(), nil
+}
+
+// decodes consecutive blocks until the end of bs, or until the first block that fails to decode
+// only the header fields are kept, the decoded blocks themselves are discarded
+// returns the number of bytes consumed by the successfully decoded blocks
+func splitVolBlocks(bs []byte) ([]VolBlock, int, error) {
+	blocks := make([]VolBlock, 0)
+	consumed := 0
+
+	for consumed < len(bs) {
+		block, n, err := decodeWrappedBlock(bs[consumed:])
 		if err != nil {
-			log.Printf("failed to read block %d from %s: %v", len(blocks)+1, stat.Name(), err)
-			break
+			return blocks, consumed, err
 		}
 
-		blocks = append(blocks, block)
+		hash := block.Hash()
+		prevHash := block.PrevHash()
+
+		blocks = append(blocks, VolBlock{
+			hash:      hex.EncodeToString(hash[:]),
+			prevHash:  hex.EncodeToString(prevHash[:]),
+			slot:      block.SlotNumber(),
+			blockType: block.Type(),
+			cbor:      bs[consumed : consumed+n],
+		})
 
-		bs = bs[n:]
+		consumed += n
 	}
 
-	return &VolChunk{stat.ModTime(), blocks}, nil
+	return blocks, consumed, nil
 }
 
 func extractChunkID(path string) (uint32, error) {
@@ -791,6 +1011,10 @@ func extractChunkID(path string) (uint32, error) {
 }
 
 func decodeWrappedBlock(bs []byte) (ledger.Block, int, error) {
+	if len(bs) < 2 {
+		return nil, 0, fmt.Errorf("expected at least 2 bytes, got %d", len(bs))
+	}
+
 	arrayHeader := bs[0]
 	if arrayHeader != 0x82 {
 		return nil, 0, fmt.Errorf("unexpected array header byte %d", arrayHeader)
@@ -1,6 +1,15 @@
 package main
 
-import "testing"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestExtractChunkID(t *testing.T) {
 	tests := []struct {
@@ -35,3 +44,191 @@ func TestExtractChunkID(t *testing.T) {
 		})
 	}
 }
+
+func TestReadImmChunkTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "00000.secondary")
+
+	writeEntries := func(entries []SecondaryIndexEntry, extra []byte) {
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, binary.BigEndian, entries); err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+		buf.Write(extra)
+
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("unexpected write error: %v", err)
+		}
+	}
+
+	entries := []SecondaryIndexEntry{
+		{BlockOffset: 0, SlotOrEpochNo: 10},
+		{BlockOffset: 100, SlotOrEpochNo: 11},
+		{BlockOffset: 200, SlotOrEpochNo: 12},
+	}
+	entries[2].BlockID[0] = 0xff
+
+	// the third entry is still being written
+	writeEntries(entries[:2], []byte{0, 0, 0})
+
+	chunk, err := loadImmChunk(path)
+	if err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+
+	if len(chunk.secondaryIndices) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(chunk.secondaryIndices))
+	}
+
+	writeEntries(entries, nil)
+
+	tail, _, err := readImmChunkTail(path, len(chunk.secondaryIndices))
+	if err != nil {
+		t.Fatalf("unexpected tail error: %v", err)
+	}
+
+	if len(tail) != 1 || tail[0] != entries[2] {
+		t.Fatalf("expected only the third entry, got %#v", tail)
+	}
+
+	tail, _, err = readImmChunkTail(path, 3)
+	if err != nil || len(tail) != 0 {
+		t.Fatalf("expected no new entries, got %d (%v)", len(tail), err)
+	}
+
+	if _, _, err := readImmChunkTail(path, 4); !errors.Is(err, errChunkTruncated) {
+		t.Fatalf("expected truncation error, got %v", err)
+	}
+}
+
+func TestImmStoreBlockRange(t *testing.T) {
+	dir := t.TempDir()
+
+	// wrapped blocks, the inner CBOR doesn't need to be a valid block because it isn't decoded
+	blocks := [][]byte{
+		{0x82, 0x06, 0x81, 0x01},
+		{0x82, 0x06, 0x82, 0x01, 0x02},
+		{0x82, 0x06, 0x83, 0x01, 0x02, 0x03},
+	}
+	slots := []uint64{100, 105, 110}
+
+	var chunk, secondary bytes.Buffer
+	for i, b := range blocks {
+		entry := SecondaryIndexEntry{BlockOffset: uint64(chunk.Len()), SlotOrEpochNo: slots[i]}
+		entry.BlockID[0] = byte(i + 1)
+
+		if err := binary.Write(&secondary, binary.BigEndian, entry); err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+
+		chunk.Write(b)
+	}
+
+	// the next block is still being written, and doesn't have an entry in the secondary index yet
+	chunk.Write([]byte{0x82, 0x06, 0x83})
+
+	if err := os.WriteFile(filepath.Join(dir, "00001.chunk"), chunk.Bytes(), 0644); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "00001.secondary"), secondary.Bytes(), 0644); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	store, err := LoadImmStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+
+	tests := []struct {
+		from uint64
+		to   uint64
+		want []int
+	}{
+		{0, 1000, []int{0, 1, 2}},
+		{101, 110, []int{1, 2}},
+		{105, 105, []int{1}},
+		{111, 1000, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-%d", tt.from, tt.to), func(t *testing.T) {
+			got := []RawBlock{}
+
+			tip, err := store.blockRange(tt.from, tt.to, func(b RawBlock) error {
+				got = append(got, b)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tip != "03"+strings.Repeat("00", 31) {
+				t.Errorf("unexpected tip %s", tip)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %d blocks, got %d", len(tt.want), len(got))
+			}
+
+			for i, j := range tt.want {
+				if !bytes.Equal(got[i].Cbor, blocks[j][2:]) || got[i].Slot != slots[j] || got[i].Type != 6 {
+					t.Errorf("unexpected block %d: %#v", i, got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStoreTipSlot(t *testing.T) {
+	dir := t.TempDir()
+
+	var chunk, secondary bytes.Buffer
+	entry := SecondaryIndexEntry{SlotOrEpochNo: 4321}
+	entry.BlockID[0] = 0x01
+
+	if err := binary.Write(&secondary, binary.BigEndian, entry); err != nil {
+		t.Fatalf("unexpected encoding error: %v", err)
+	}
+
+	chunk.Write([]byte{0x82, 0x06, 0x81, 0x01})
+
+	if err := os.WriteFile(filepath.Join(dir, "00000.chunk"), chunk.Bytes(), 0644); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "00000.secondary"), secondary.Bytes(), 0644); err != nil {
+		t.Fatalf("unexpected write error: %v", err)
+	}
+
+	imm, err := LoadImmStore(dir)
+	if err != nil {
+		t.Fatalf("unexpected load error: %v", err)
+	}
+
+	store := &Store{immutable: imm}
+
+	if _, ok := store.TipSlot(); ok {
+		t.Errorf("expected no tip slot before a tip is loaded")
+	}
+
+	store.loadedTip = imm.Tip()
+
+	if slot, ok := store.TipSlot(); !ok || slot != 4321 {
+		t.Errorf("expected tip slot 4321, got %d (%v)", slot, ok)
+	}
+}
+
+func TestEntrySlot(t *testing.T) {
+	entries := []SecondaryIndexEntry{
+		{SlotOrEpochNo: 3},
+		{SlotOrEpochNo: 3*21600 + 1},
+	}
+
+	if got := entrySlot(entries, 3, 0); got != 3*21600 {
+		t.Errorf("expected epoch boundary block slot %d, got %d", 3*21600, got)
+	}
+
+	if got := entrySlot(entries, 3, 1); got != 3*21600+1 {
+		t.Errorf("expected slot %d, got %d", 3*21600+1, got)
+	}
+}
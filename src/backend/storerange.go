@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger/byron"
+)
+
+// RawBlock is a block as read from the chain database, without decoding its body
+type RawBlock struct {
+	Hash string // hex encoded header hash
+	Slot uint64
+	Type int
+
+	// the era specific block CBOR, i.e. the same bytes returned by ledger.Block.Cbor()
+	Cbor []byte
+}
+
+// returned when a resume token doesn't point to a block of the current chain
+var errUnknownResumeToken = errors.New("unknown resume token")
+
+// BlockRange calls fn for each block of the current chain with fromSlot <= slot <= toSlot, in chain order.
+// If resumeAfter is non-empty, it must be the hash of a block in the range, and only the blocks following it are visited.
+// Immutable blocks are read sequentially from the chunk files, volatile blocks are taken from memory.
+func (s *Store) BlockRange(fromSlot uint64, toSlot uint64, resumeAfter string, fn func(RawBlock) error) error {
+	if resumeAfter != "" {
+		slot, ok := s.blockSlot(resumeAfter)
+		if !ok || slot < fromSlot || slot > toSlot {
+			return errUnknownResumeToken
+		}
+
+		fromSlot = slot
+
+		// skip the blocks up to and including the resume block (an EBB shares its slot with the next block)
+		inner := fn
+		resumed := false
+		fn = func(b RawBlock) error {
+			if resumed {
+				return inner(b)
+			}
+
+			resumed = b.Hash == resumeAfter
+			return nil
+		}
+	}
+
+	immTip, err := s.immutable.blockRange(fromSlot, toSlot, fn)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range s.volatile.chain(s.Tip(), immTip) {
+		if b.slot < fromSlot {
+			continue
+		} else if b.slot > toSlot {
+			break
+		}
+
+		if err := fn(RawBlock{b.hash, b.slot, b.blockType, b.cbor[2:]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Tip returns the hash of the most recently loaded tip
+func (s *Store) Tip() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.loadedTip
+}
+
+// TipSlot returns the slot of the most recently loaded tip, false if no block was loaded yet
+func (s *Store) TipSlot() (uint64, bool) {
+	tip := s.Tip()
+	if tip == "" {
+		return 0, false
+	}
+
+	return s.blockSlot(tip)
+}
+
+// returns false if the block isn't found
+func (s *Store) blockSlot(blockID string) (uint64, bool) {
+	if slot, ok := s.immutable.blockSlot(blockID); ok {
+		return slot, true
+	}
+
+	if b := s.volatile.rawBlock(blockID); b != nil {
+		return b.slot, true
+	}
+
+	return 0, false
+}
+
+func (s *ImmStore) blockSlot(blockID string) (uint64, bool) {
+	s.mu.RLock()
+	if s.blockPtrs == nil {
+		s.mu.RUnlock()
+		s.indexBlocks()
+		s.mu.RLock()
+	}
+	defer s.mu.RUnlock()
+
+	ptr, ok := s.blockPtrs[blockID]
+	if !ok {
+		return 0, false
+	}
+
+	return entrySlot(s.chunks[ptr.I].secondaryIndices, int(ptr.I), int(ptr.J)), true
+}
+
+// the secondary index of a Byron epoch boundary block contains its epoch number instead of its slot
+// EBBs are always the first block of a chunk, and chunk IDs correspond to the Byron epoch numbers
+func entrySlot(entries []SecondaryIndexEntry, chunkID int, j int) uint64 {
+	entry := entries[j]
+
+	if j == 0 && entry.SlotOrEpochNo == uint64(chunkID) {
+		return entry.SlotOrEpochNo * byron.ByronSlotsPerEpoch
+	}
+
+	return entry.SlotOrEpochNo
+}
+
+// returns the hash of the last block of the immutable db, so the caller can continue with the volatile chain
+func (s *ImmStore) blockRange(fromSlot uint64, toSlot uint64, fn func(RawBlock) error) (string, error) {
+	s.mu.RLock()
+	// the slices are only ever appended to, so copying the headers is enough to read them without holding the lock
+	chunks := make([][]SecondaryIndexEntry, len(s.chunks))
+	for i, c := range s.chunks {
+		if c != nil {
+			chunks[i] = c.secondaryIndices
+		}
+	}
+	s.mu.RUnlock()
+
+	tip := ""
+	for i := len(chunks) - 1; i >= 0 && tip == ""; i-- {
+		if n := len(chunks[i]); n > 0 {
+			tip = hex.EncodeToString(chunks[i][n-1].BlockID[:])
+		}
+	}
+
+	// find the first chunk that can contain fromSlot
+	//  chunks that failed to load are empty, so a linear scan is used instead of a binary search
+	first := len(chunks)
+	for i, entries := range chunks {
+		if n := len(entries); n > 0 && entrySlot(entries, i, n-1) >= fromSlot {
+			first = i
+			break
+		}
+	}
+
+	for chunkID := first; chunkID < len(chunks); chunkID++ {
+		entries := chunks[chunkID]
+		if len(entries) == 0 {
+			continue
+		}
+
+		if entrySlot(entries, chunkID, 0) > toSlot {
+			break
+		}
+
+		if err := s.chunkBlockRange(chunkID, entries, fromSlot, toSlot, fn); err != nil {
+			return "", err
+		}
+	}
+
+	return tip, nil
+}
+
+// reads the blocks of a single chunk file sequentially
+func (s *ImmStore) chunkBlockRange(chunkID int, entries []SecondaryIndexEntry, fromSlot uint64, toSlot uint64, fn func(RawBlock) error) error {
+	start := sort.Search(len(entries), func(j int) bool {
+		return entrySlot(entries, chunkID, j) >= fromSlot
+	})
+
+	if start == len(entries) {
+		return nil
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, fmt.Sprintf("%05d.chunk", chunkID)))
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if _, err := file.Seek(int64(entries[start].BlockOffset), io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(file, 1<<20)
+
+	for j := start; j < len(entries); j++ {
+		slot := entrySlot(entries, chunkID, j)
+		if slot > toSlot {
+			break
+		}
+
+		var bs []byte
+
+		if j < len(entries)-1 {
+			bs = make([]byte, entries[j+1].BlockOffset-entries[j].BlockOffset)
+
+			if _, err := io.ReadFull(reader, bs); err != nil {
+				return err
+			}
+		} else {
+			// the last block runs until the end of the chunk file, which might also contain a partially written next block
+			bs, err = io.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+
+			var item cbor.RawMessage
+			n, err := cbor.Decode(bs, &item)
+			if err != nil {
+				return err
+			}
+
+			bs = bs[:n]
+		}
+
+		// strip the [blockType, block] wrapper
+		if len(bs) < 2 || bs[0] != 0x82 {
+			return fmt.Errorf("unexpected block wrapper in chunk %d at offset %d", chunkID, entries[j].BlockOffset)
+		}
+
+		b := RawBlock{
+			Hash: hex.EncodeToString(entries[j].BlockID[:]),
+			Slot: slot,
+			Type: int(bs[1]),
+			Cbor: bs[2:],
+		}
+
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// returns the volatile blocks between the immutable tip (exclusive) and the given tip (inclusive), in chain order
+// blocks on forks are excluded
+func (s *VolStore) chain(tip string, immTip string) []*VolBlock {
+	blocks := []*VolBlock{}
+
+	for hash := tip; hash != "" && hash != immTip; {
+		b := s.rawBlock(hash)
+		if b == nil {
+			break
+		}
+
+		blocks = append(blocks, b)
+
+		hash = b.prevHash
+	}
+
+	// reverse, so the blocks are ordered from old to new
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+
+	return blocks
+}
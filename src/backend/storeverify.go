@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StoreVerifyReport summarizes the consistency of the chain database files
+type StoreVerifyReport struct {
+	StartedAt      time.Time      `json:"startedAt"`
+	FinishedAt     *time.Time     `json:"finishedAt,omitempty"` // nil while the verification is still running
+	Chunks         int            `json:"chunks"`               // number of immutable chunks checked so far
+	TotalChunks    int            `json:"totalChunks"`
+	Blocks         int            `json:"blocks"` // number of immutable blocks checked so far
+	VolatileChunks int            `json:"volatileChunks"`
+	VolatileBlocks int            `json:"volatileBlocks"`
+	MissingChunks  []uint32       `json:"missingChunks"`
+	Problems       []StoreProblem `json:"problems"`
+}
+
+// StoreProblem describes a corrupt chunk, or a corrupt block within a chunk
+type StoreProblem struct {
+	Path    string `json:"path"`
+	Block   *int   `json:"block,omitempty"` // index of the block within the chunk, nil if the problem concerns the whole chunk
+	Problem string `json:"problem"`
+}
+
+// StoreVerifier walks all the chunks of the chain database, and can be queried for progress while doing so
+type StoreVerifier struct {
+	dir    string
+	report *StoreVerifyReport
+	mu     sync.Mutex
+}
+
+func NewStoreVerifier(dir string) *StoreVerifier {
+	return &StoreVerifier{dir: dir}
+}
+
+// OK returns true if no problems were found
+func (r StoreVerifyReport) OK() bool {
+	return len(r.MissingChunks) == 0 && len(r.Problems) == 0
+}
+
+// Report returns a snapshot of the latest report, returns false if the verification was never started
+func (v *StoreVerifier) Report() (StoreVerifyReport, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.report == nil {
+		return StoreVerifyReport{}, false
+	}
+
+	report := *v.report
+	report.MissingChunks = append([]uint32{}, report.MissingChunks...)
+	report.Problems = append([]StoreProblem{}, report.Problems...)
+
+	return report, true
+}
+
+// Running returns true if a verification is currently in progress
+func (v *StoreVerifier) Running() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.report != nil && v.report.FinishedAt == nil
+}
+
+// Run verifies all immutable and volatile chunks, this can take a long time
+// returns an error if a verification is already running
+func (v *StoreVerifier) Run() (StoreVerifyReport, error) {
+	v.mu.Lock()
+	if v.report != nil && v.report.FinishedAt == nil {
+		v.mu.Unlock()
+		return StoreVerifyReport{}, fmt.Errorf("store verification already running")
+	}
+
+	v.report = &StoreVerifyReport{
+		StartedAt:     time.Now(),
+		MissingChunks: []uint32{},
+		Problems:      []StoreProblem{},
+	}
+	v.mu.Unlock()
+
+	v.verifyImmutable(filepath.Join(v.dir, "immutable"))
+	v.verifyVolatile(filepath.Join(v.dir, "volatile"))
+
+	v.mu.Lock()
+	finishedAt := time.Now()
+	v.report.FinishedAt = &finishedAt
+	v.mu.Unlock()
+
+	report, _ := v.Report()
+
+	return report, nil
+}
+
+func (v *StoreVerifier) addProblem(path string, block int, format string, args ...any) {
+	p := StoreProblem{
+		Path:    path,
+		Problem: fmt.Sprintf(format, args...),
+	}
+
+	if block >= 0 {
+		p.Block = &block
+	}
+
+	v.mu.Lock()
+	v.report.Problems = append(v.report.Problems, p)
+	v.mu.Unlock()
+}
+
+func (v *StoreVerifier) verifyImmutable(dir string) {
+	ids, err := listChunkIDs(dir, ".secondary", ".chunk")
+	if err != nil {
+		v.addProblem(dir, -1, "unable to list immutable chunks: %v", err)
+		return
+	}
+
+	n := 0
+	if len(ids) > 0 {
+		n = int(ids[len(ids)-1]) + 1
+	}
+
+	v.mu.Lock()
+	v.report.TotalChunks = n
+	v.mu.Unlock()
+
+	// hash of the last block of the previous chunk, empty if the previous chunk is missing or corrupt
+	prevHash := ""
+
+	for id := range n {
+		prevHash = v.verifyImmChunk(dir, uint32(id), prevHash)
+
+		v.mu.Lock()
+		v.report.Chunks++
+		v.mu.Unlock()
+	}
+}
+
+// returns the hash of the last block in the chunk
+func (v *StoreVerifier) verifyImmChunk(dir string, id uint32, prevHash string) string {
+	secondaryPath := filepath.Join(dir, fmt.Sprintf("%05d.secondary", id))
+	chunkPath := filepath.Join(dir, fmt.Sprintf("%05d.chunk", id))
+
+	_, secondaryErr := os.Stat(secondaryPath)
+	chunkBytes, chunkErr := os.ReadFile(chunkPath)
+
+	if os.IsNotExist(secondaryErr) && os.IsNotExist(chunkErr) {
+		v.mu.Lock()
+		v.report.MissingChunks = append(v.report.MissingChunks, id)
+		v.mu.Unlock()
+		return ""
+	} else if secondaryErr != nil {
+		v.addProblem(secondaryPath, -1, "unable to read secondary index: %v", secondaryErr)
+		return ""
+	} else if chunkErr != nil {
+		v.addProblem(chunkPath, -1, "unable to read chunk: %v", chunkErr)
+		return ""
+	}
+
+	chunk, err := loadImmChunk(secondaryPath)
+	if err != nil {
+		v.addProblem(secondaryPath, -1, "unable to read secondary index: %v", err)
+		return ""
+	}
+
+	entries := chunk.secondaryIndices
+
+	for j, entry := range entries {
+		end := uint64(len(chunkBytes))
+		if j < len(entries)-1 {
+			end = entries[j+1].BlockOffset
+		}
+
+		if entry.BlockOffset > end || end > uint64(len(chunkBytes)) {
+			v.addProblem(chunkPath, j, "block offset %d out of range", entry.BlockOffset)
+			prevHash = ""
+			continue
+		}
+
+		bs := chunkBytes[entry.BlockOffset:end]
+
+		isLast := j == len(entries)-1
+
+		// the last block might be followed by a partially written block, so its checksum is verified after decoding
+		if !isLast {
+			if checksum := crc32.ChecksumIEEE(bs); checksum != entry.Checksum {
+				v.addProblem(chunkPath, j, "checksum mismatch (expected %08x, got %08x)", entry.Checksum, checksum)
+			}
+		}
+
+		b, n, err := decodeWrappedBlock(bs)
+		if err != nil {
+			v.addProblem(chunkPath, j, "unable to decode block: %v", err)
+			prevHash = ""
+			continue
+		}
+
+		if isLast {
+			if checksum := crc32.ChecksumIEEE(bs[:n]); checksum != entry.Checksum {
+				v.addProblem(chunkPath, j, "checksum mismatch (expected %08x, got %08x)", entry.Checksum, checksum)
+			}
+		} else if n != len(bs) {
+			v.addProblem(chunkPath, j, "decoded %d bytes, but block is %d bytes", n, len(bs))
+		}
+
+		hash := b.Hash()
+		if !bytes.Equal(hash[:], entry.BlockID[:]) {
+			v.addProblem(chunkPath, j, "block hash %x doesn't match secondary index %x", hash[:], entry.BlockID[:])
+		}
+
+		actualPrevHash := b.PrevHash()
+		if prevHash != "" && hex.EncodeToString(actualPrevHash[:]) != prevHash {
+			v.addProblem(chunkPath, j, "previous block hash %x doesn't match preceding block %s", actualPrevHash[:], prevHash)
+		}
+
+		prevHash = hex.EncodeToString(entry.BlockID[:])
+
+		v.mu.Lock()
+		v.report.Blocks++
+		v.mu.Unlock()
+	}
+
+	return prevHash
+}
+
+// volatile blocks aren't necessarily on the same chain, so only check that they can be decoded
+func (v *StoreVerifier) verifyVolatile(dir string) {
+	ids, err := listChunkIDs(dir, ".dat")
+	if err != nil {
+		v.addProblem(dir, -1, "unable to list volatile chunks: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		path := filepath.Join(dir, fmt.Sprintf("blocks-%04d.dat", id))
+
+		bs, err := os.ReadFile(path)
+		if err != nil {
+			v.addProblem(path, -1, "unable to read chunk: %v", err)
+			continue
+		}
+
+		blocks, n, err := splitVolBlocks(bs)
+		if err != nil {
+			v.addProblem(path, len(blocks), "unable to decode block at offset %d: %v", n, err)
+		}
+
+		v.mu.Lock()
+		v.report.VolatileChunks++
+		v.report.VolatileBlocks += len(blocks)
+		v.mu.Unlock()
+	}
+}
+
+// returns the sorted unique IDs of the chunk files with the given extensions
+func listChunkIDs(dir string, exts ...string) ([]uint32, error) {
+	unique := map[uint32]struct{}{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		ext := filepath.Ext(path)
+
+		for _, e := range exts {
+			if ext == e {
+				if id, err := extractChunkID(path); err == nil {
+					unique[id] = struct{}{}
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint32, 0, len(unique))
+	for id := range unique {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreVerifier(t *testing.T) {
+	dir := t.TempDir()
+	immDir := filepath.Join(dir, "immutable")
+	volDir := filepath.Join(dir, "volatile")
+
+	for _, d := range []string{immDir, volDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("unexpected mkdir error: %v", err)
+		}
+	}
+
+	// chunk 0 is missing, chunk 1 contains two undecodable blocks, the first one also has a bad checksum
+	blocks := [][]byte{
+		{0x82, 0x06, 0x81, 0x01},
+		{0x82, 0x06, 0x81, 0x02},
+	}
+
+	var chunk, secondary bytes.Buffer
+	for i, b := range blocks {
+		checksum := crc32.ChecksumIEEE(b)
+		if i == 0 {
+			checksum++
+		}
+
+		entry := SecondaryIndexEntry{BlockOffset: uint64(chunk.Len()), Checksum: checksum}
+		if err := binary.Write(&secondary, binary.BigEndian, entry); err != nil {
+			t.Fatalf("unexpected encoding error: %v", err)
+		}
+
+		chunk.Write(b)
+	}
+
+	files := map[string][]byte{
+		filepath.Join(immDir, "00001.chunk"):     chunk.Bytes(),
+		filepath.Join(immDir, "00001.secondary"): secondary.Bytes(),
+		filepath.Join(volDir, "blocks-0003.dat"): {0x82, 0x06},
+	}
+
+	for path, content := range files {
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("unexpected write error: %v", err)
+		}
+	}
+
+	report, err := NewStoreVerifier(dir).Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.OK() {
+		t.Fatalf("expected problems")
+	}
+
+	if report.TotalChunks != 2 || report.Chunks != 2 {
+		t.Errorf("expected 2 chunks, got %d of %d", report.Chunks, report.TotalChunks)
+	}
+
+	if len(report.MissingChunks) != 1 || report.MissingChunks[0] != 0 {
+		t.Errorf("expected chunk 0 to be missing, got %v", report.MissingChunks)
+	}
+
+	nChecksum, nDecode, nVolatile := 0, 0, 0
+	for _, p := range report.Problems {
+		switch {
+		case strings.HasSuffix(p.Path, ".dat"):
+			nVolatile++
+		case strings.Contains(p.Problem, "checksum mismatch"):
+			if p.Block == nil || *p.Block != 0 {
+				t.Errorf("expected checksum mismatch for block 0")
+			}
+			nChecksum++
+		case strings.Contains(p.Problem, "unable to decode"):
+			nDecode++
+		}
+	}
+
+	if nChecksum != 1 || nDecode != 2 || nVolatile != 1 {
+		t.Errorf("unexpected problems: %#v", report.Problems)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+)
+
+// Watch keeps the store in sync using filesystem notifications, so new blocks are visible as soon as cardano-node writes them.
+// Returns an error if notifications aren't available, in which case the caller should fall back to polling with NotifyTip.
+// onStop is called if the notifications stop later on (e.g. a watched directory is removed or replaced), so the caller can fall back to polling then as well.
+func (s *Store) Watch(onStop func()) error {
+	changes, err := watchDirs(s.immutable.dir, s.volatile.dir)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		s.syncOnChanges(changes)
+		onStop()
+	}()
+
+	return nil
+}
+
+// each value received from changes is the path of a directory in which a file was created, modified or removed
+func (s *Store) syncOnChanges(changes <-chan string) {
+	for dir := range changes {
+		immutable := dir == s.immutable.dir
+		volatile := dir == s.volatile.dir
+
+		// cardano-node writes a single block using multiple system calls, coalesce the pending notifications into a single sync
+	drain:
+		for {
+			select {
+			case dir, ok := <-changes:
+				if !ok {
+					break drain
+				}
+
+				immutable = immutable || dir == s.immutable.dir
+				volatile = volatile || dir == s.volatile.dir
+			default:
+				break drain
+			}
+		}
+
+		s.syncChanged(immutable, volatile)
+	}
+
+	log.Println("stopped watching the chain database")
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+
+// uses inotify, the returned channel is closed if the events can't be read anymore, or if a watched directory is removed or moved
+func watchDirs(dirs ...string) (<-chan string, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify unavailable (%v)", err)
+	}
+
+	watched := make(map[int32]string, len(dirs))
+
+	for _, dir := range dirs {
+		wd, err := unix.InotifyAddWatch(fd, dir, watchMask)
+		if err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("unable to watch %s (%v)", dir, err)
+		}
+
+		watched[int32(wd)] = dir
+	}
+
+	changes := make(chan string, 64)
+
+	go func() {
+		defer close(changes)
+		defer unix.Close(fd)
+
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+
+		for {
+			n, err := unix.Read(fd, buf)
+			if err == unix.EINTR {
+				continue
+			} else if err != nil {
+				log.Printf("failed to read inotify events (%v)", err)
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+
+				if dir, ok := watched[event.Wd]; ok && event.Mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF|unix.IN_IGNORED) != 0 {
+					// the directory might have been replaced, in which case the new one isn't watched
+					log.Printf("%s was removed or moved", dir)
+					return
+				} else if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+					// some events were dropped, so resync everything
+					for _, dir := range dirs {
+						changes <- dir
+					}
+				} else if dir, ok := watched[event.Wd]; ok {
+					changes <- dir
+				}
+
+				offset += unix.SizeofInotifyEvent + int(event.Len)
+			}
+		}
+	}()
+
+	return changes, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchDirsStopsOnRemoval(t *testing.T) {
+	immutable := filepath.Join(t.TempDir(), "immutable")
+	volatile := t.TempDir()
+
+	if err := os.Mkdir(immutable, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := watchDirs(immutable, volatile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(volatile, "blocks-0.dat"), []byte{0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.RemoveAll(immutable); err != nil {
+		t.Fatal(err)
+	}
+
+	// the channel must be closed, so that the store falls back to polling
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watcher didn't stop after a watched directory was removed")
+		}
+	}
+}
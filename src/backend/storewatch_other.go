@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+func watchDirs(dirs ...string) (<-chan string, error) {
+	return nil, errors.New("filesystem notifications not supported on this platform")
+}
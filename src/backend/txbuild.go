@@ -0,0 +1,545 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+	"golang.org/x/crypto/blake2b"
+)
+
+// max number of fee iterations, the fee normally converges after 2 or 3
+const maxBuildTxIterations = 10
+
+// selected inputs are locked for long enough to sign and submit the tx
+const buildTxLockTTL = 2 * time.Minute
+
+// metadata strings and bytes can't be longer than 64 bytes
+const maxMetadataChunkSize = 64
+
+// BuildTxRequest describes a payment from one or more addresses
+type BuildTxRequest struct {
+	From          []string        `json:"from"`          // addresses to select inputs from
+	ChangeAddress string          `json:"changeAddress"` // defaults to the first from address
+	Outputs       []BuildTxOutput `json:"outputs"`
+	Metadata      map[uint64]any  `json:"metadata,omitempty"`   // JSON values without schema, strings starting with 0x are converted to bytes
+	ValidFrom     *uint64         `json:"validFrom,omitempty"`  // slot
+	ValidTo       *uint64         `json:"validTo,omitempty"`    // slot, exclusive
+	Collateral    string          `json:"collateral,omitempty"` // <tx-hash>#<index>
+}
+
+type BuildTxOutput struct {
+	Address     string        `json:"address"`
+	Lovelace    string        `json:"lovelace,omitempty"` // defaults to the min lovelace of the output
+	Assets      []PolicyAsset `json:"assets,omitempty"`
+	DatumHash   string        `json:"datumHash,omitempty"`
+	InlineDatum string        `json:"inlineDatum,omitempty"` // CBOR hex
+}
+
+type BuildTxResponse struct {
+	CBORHex string `json:"cborHex"` // unsigned
+	TxID    string `json:"txID"`
+	Fee     uint64 `json:"fee"`
+	Inputs  []UTXO `json:"inputs"` // selected inputs, locked until the tx is submitted or the lock expires
+}
+
+// returns an error describing the first address of the request that isn't a valid address of the network
+func (req BuildTxRequest) validateAddresses(network AddressNetwork) error {
+	for _, addr := range req.From {
+		if _, err := ParseAddress(addr, network); err != nil {
+			return fmt.Errorf("invalid from address %s: %v", addr, err)
+		}
+	}
+
+	if req.ChangeAddress != "" {
+		if _, err := ParseAddress(req.ChangeAddress, network); err != nil {
+			return fmt.Errorf("invalid change address %s: %v", req.ChangeAddress, err)
+		}
+	}
+
+	for i, o := range req.Outputs {
+		if _, err := ParseAddress(o.Address, network); err != nil {
+			return fmt.Errorf("invalid address %s of output %d: %v", o.Address, i, err)
+		}
+	}
+
+	return nil
+}
+
+// returns the collateral input of the request, nil if unset
+func (req BuildTxRequest) collateralInput() (common.TransactionInput, error) {
+	if req.Collateral == "" {
+		return nil, nil
+	}
+
+	txID, indexStr, _ := strings.Cut(req.Collateral, "#")
+
+	txHash, err := hex.DecodeString(txID)
+	if err != nil || len(txHash) != 32 {
+		return nil, fmt.Errorf("invalid collateral %s, expected <tx-hash>#<index>", req.Collateral)
+	}
+
+	index, err := strconv.ParseUint(indexStr, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collateral %s, expected <tx-hash>#<index>", req.Collateral)
+	}
+
+	return shelley.NewShelleyTransactionInput(hex.EncodeToString(txHash), int(index)), nil
+}
+
+// TxBuildError is returned if the request is invalid or can't be fulfilled with the available UTXOs
+type TxBuildError struct {
+	Message string
+}
+
+func (e *TxBuildError) Error() string {
+	return e.Message
+}
+
+func newTxBuildError(format string, args ...any) *TxBuildError {
+	return &TxBuildError{fmt.Sprintf(format, args...)}
+}
+
+// txValue is the lovelace and assets of a set of UTXOs or outputs, keyed by policy + name hex
+type txValue struct {
+	lovelace uint64
+	assets   map[string]*big.Int
+}
+
+func newTxValue() txValue {
+	return txValue{0, make(map[string]*big.Int)}
+}
+
+func (v *txValue) add(lovelace uint64, assets []PolicyAsset) error {
+	v.lovelace += lovelace
+
+	for _, a := range assets {
+		qty, ok := new(big.Int).SetString(a.Quantity, 10)
+		if !ok {
+			return fmt.Errorf("invalid quantity %s for asset %s", a.Quantity, a.Asset)
+		}
+
+		addAssetQuantity(v.assets, a.Asset, qty)
+	}
+
+	return nil
+}
+
+// returns the assets that v contains more of than other, false if other contains more of any asset
+func (v txValue) assetsExceeding(other txValue) ([]PolicyAsset, bool) {
+	diff := []PolicyAsset{}
+
+	for asset, qty := range other.assets {
+		if have, ok := v.assets[asset]; qty.Sign() > 0 && (!ok || have.Cmp(qty) < 0) {
+			return nil, false
+		}
+	}
+
+	for _, asset := range sortedAssetKeys(v.assets) {
+		d := new(big.Int).Set(v.assets[asset])
+		if qty, ok := other.assets[asset]; ok {
+			d.Sub(d, qty)
+		}
+
+		if d.Sign() > 0 {
+			diff = append(diff, PolicyAsset{Asset: asset, Quantity: d.String()})
+		}
+	}
+
+	return diff, true
+}
+
+// BuildTx selects inputs from the available UTXOs to pay the requested outputs, and returns an unsigned balanced tx.
+// Inputs are selected largest first, preferring UTXOs that contain the requested assets. The change is sent back to the change address.
+func BuildTx(params CardanoCLIParameters, req BuildTxRequest, available []UTXO, collateral *UTXO) (ledger.Transaction, []UTXO, error) {
+	if len(req.From) == 0 {
+		return nil, nil, newTxBuildError("no from addresses")
+	}
+
+	changeAddress := req.ChangeAddress
+	if changeAddress == "" {
+		changeAddress = req.From[0]
+	}
+
+	outputs, target, err := encodeBuildTxOutputs(params, req.Outputs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aux, err := encodeBuildTxMetadata(req.Metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	available = sortBuildTxCandidates(available, target)
+
+	selected := []UTXO{}
+	inputs := newTxValue()
+	fee := uint64(0)
+
+	for i := 0; i < maxBuildTxIterations; i++ {
+		// select until the outputs and the fee are covered, and the change (if any) is large enough
+		var change []byte
+		for {
+			var ok bool
+			change, ok, err = buildTxChange(params, changeAddress, inputs, target, fee)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if ok {
+				break
+			}
+
+			if len(available) == 0 {
+				// a change output that would be too small is added to the fee instead
+				if assets, ok := inputs.assetsExceeding(target); ok && len(assets) == 0 && inputs.lovelace >= target.lovelace+fee {
+					fee = inputs.lovelace - target.lovelace
+					change = nil
+					break
+				}
+
+				return nil, nil, newTxBuildError("not enough funds: need %d lovelace (including fee %d) and %d assets, selected %d lovelace from %d UTXOs", target.lovelace+fee, fee, len(target.assets), inputs.lovelace, len(selected))
+			}
+
+			utxo := available[0]
+			available = available[1:]
+
+			lovelace, _ := strconv.ParseUint(utxo.Lovelace, 10, 64)
+			if err := inputs.add(lovelace, utxo.Assets); err != nil {
+				return nil, nil, err
+			}
+
+			selected = append(selected, utxo)
+		}
+
+		txBytes, err := encodeBuildTx(req, selected, outputs, change, fee, aux, collateral)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tx, err := decodeTx(txBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		refScripts := 0
+		for _, u := range selected {
+			refScripts += len(u.RefScript) / 2
+		}
+
+		minFee := EstimateTxFee(params, tx, refScripts, countBuildTxSigners(selected, collateral)).Fee
+		if fee >= minFee {
+			if len(txBytes) > params.MaxTxSize {
+				return nil, nil, newTxBuildError("tx too large (%d bytes, max %d)", len(txBytes), params.MaxTxSize)
+			}
+
+			return tx, selected, nil
+		}
+
+		fee = minFee
+	}
+
+	return nil, nil, fmt.Errorf("fee didn't converge after %d iterations", maxBuildTxIterations)
+}
+
+// returns the encoded outputs and their total value
+func encodeBuildTxOutputs(params CardanoCLIParameters, outputs []BuildTxOutput) ([][]byte, txValue, error) {
+	if len(outputs) == 0 {
+		return nil, txValue{}, newTxBuildError("no outputs")
+	}
+
+	encoded := [][]byte{}
+	total := newTxValue()
+
+	for i, o := range outputs {
+		datumHash := o.DatumHash
+		if o.InlineDatum != "" {
+			datum, err := hex.DecodeString(o.InlineDatum)
+			if err != nil {
+				return nil, txValue{}, newTxBuildError("invalid inline datum of output %d: %v", i, err)
+			}
+
+			datumHash = HashDatum(datum)
+		}
+
+		lovelace := o.Lovelace
+		if lovelace == "" {
+			lovelace = "0"
+		}
+
+		output, err := EncodeTxOutput(o.Address, lovelace, o.Assets, datumHash, o.InlineDatum, "")
+		if err != nil {
+			return nil, txValue{}, newTxBuildError("invalid output %d: %v", i, err)
+		}
+
+		decoded, err := ledger.NewTransactionOutputFromCbor(output)
+		if err != nil {
+			return nil, txValue{}, newTxBuildError("invalid output %d: %v", i, err)
+		}
+
+		minLovelace := RequiredOutputLovelace(params, decoded)
+
+		if o.Lovelace == "" {
+			lovelace = strconv.FormatUint(minLovelace, 10)
+
+			output, err = EncodeTxOutput(o.Address, lovelace, o.Assets, datumHash, o.InlineDatum, "")
+			if err != nil {
+				return nil, txValue{}, err
+			}
+		} else if decoded.Amount() < minLovelace {
+			return nil, txValue{}, newTxBuildError("output %d contains %d lovelace, expected at least %d", i, decoded.Amount(), minLovelace)
+		}
+
+		amount, _ := strconv.ParseUint(lovelace, 10, 64)
+		if err := total.add(amount, o.Assets); err != nil {
+			return nil, txValue{}, newTxBuildError("invalid output %d: %v", i, err)
+		}
+
+		encoded = append(encoded, output)
+	}
+
+	return encoded, total, nil
+}
+
+// returns the encoded change output, nil if there is no change, and false if more inputs must be selected
+func buildTxChange(params CardanoCLIParameters, changeAddress string, inputs txValue, target txValue, fee uint64) ([]byte, bool, error) {
+	if inputs.lovelace < target.lovelace+fee {
+		return nil, false, nil
+	}
+
+	assets, ok := inputs.assetsExceeding(target)
+	if !ok {
+		return nil, false, nil
+	}
+
+	lovelace := inputs.lovelace - target.lovelace - fee
+	if lovelace == 0 && len(assets) == 0 {
+		return nil, true, nil
+	}
+
+	change, err := EncodeTxOutput(changeAddress, strconv.FormatUint(lovelace, 10), assets, "", "", "")
+	if err != nil {
+		return nil, false, newTxBuildError("invalid change address: %v", err)
+	}
+
+	decoded, err := ledger.NewTransactionOutputFromCbor(change)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if lovelace < MinOutputLovelace(params, decoded) {
+		return nil, false, nil
+	}
+
+	return change, true, nil
+}
+
+func encodeBuildTx(req BuildTxRequest, inputs []UTXO, outputs [][]byte, change []byte, fee uint64, aux []byte, collateral *UTXO) ([]byte, error) {
+	fields := map[int][]byte{}
+
+	encodedInputs := [][]byte{}
+	for _, u := range inputs {
+		encoded, err := EncodeTxOutputID(u.TxID, u.OutputIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		encodedInputs = append(encodedInputs, encoded)
+	}
+
+	fields[0] = EncodeDefList(encodedInputs)
+
+	if change != nil {
+		outputs = append(outputs[:len(outputs):len(outputs)], change)
+	}
+
+	fields[1] = EncodeDefList(outputs)
+	fields[2] = EncodeInt(int64(fee))
+
+	if req.ValidTo != nil {
+		fields[3] = encodeUint(*req.ValidTo)
+	}
+
+	if aux != nil {
+		auxHash := blake2b.Sum256(aux)
+		fields[7] = EncodeBytes(auxHash[:])
+	}
+
+	if req.ValidFrom != nil {
+		fields[8] = encodeUint(*req.ValidFrom)
+	}
+
+	if collateral != nil {
+		encoded, err := EncodeTxOutputID(collateral.TxID, collateral.OutputIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		fields[13] = EncodeDefList([][]byte{encoded})
+	}
+
+	if aux == nil {
+		aux = []byte{0xf6} // null
+	}
+
+	return EncodeTuple(
+		EncodeObjectIKey(fields),
+		EncodeDefMap([]EncodedPair{}), // empty witness set
+		[]byte{0xf5},                  // valid
+		aux,
+	), nil
+}
+
+func encodeUint(x uint64) []byte {
+	return encodeInt(new(big.Int).SetUint64(x))
+}
+
+// returns nil if there is no metadata
+func encodeBuildTxMetadata(metadata map[uint64]any) ([]byte, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	converted := make(map[uint64]any)
+	for label, value := range metadata {
+		v, err := convertMetadatum(value)
+		if err != nil {
+			return nil, newTxBuildError("invalid metadata %d: %v", label, err)
+		}
+
+		converted[label] = v
+	}
+
+	return cbor.Encode(converted)
+}
+
+// converts JSON values to the types expected by the CBOR encoder
+func convertMetadatum(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			bs, err := hex.DecodeString(v[2:])
+			if err != nil {
+				return nil, err
+			}
+
+			if len(bs) > maxMetadataChunkSize {
+				return nil, fmt.Errorf("bytes longer than %d bytes", maxMetadataChunkSize)
+			}
+
+			return bs, nil
+		}
+
+		if len(v) > maxMetadataChunkSize {
+			return nil, fmt.Errorf("string longer than %d bytes", maxMetadataChunkSize)
+		}
+
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) {
+			return nil, fmt.Errorf("non-integer number %v", v)
+		}
+
+		return int64(v), nil
+	case json.Number:
+		return v.Int64()
+	case []any:
+		list := []any{}
+		for _, item := range v {
+			converted, err := convertMetadatum(item)
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, converted)
+		}
+
+		return list, nil
+	case map[string]any:
+		m := make(map[any]any)
+		for key, item := range v {
+			converted, err := convertMetadatum(item)
+			if err != nil {
+				return nil, err
+			}
+
+			m[key] = converted
+		}
+
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+// UTXOs containing the requested assets come first, then UTXOs are sorted by decreasing lovelace
+func sortBuildTxCandidates(utxos []UTXO, target txValue) []UTXO {
+	sorted := append([]UTXO{}, utxos...)
+
+	containsTarget := func(u UTXO) bool {
+		for _, a := range u.Assets {
+			if _, ok := target.assets[a.Asset]; ok {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ci, cj := containsTarget(sorted[i]), containsTarget(sorted[j])
+		if ci != cj {
+			return ci
+		}
+
+		li, _ := strconv.ParseUint(sorted[i].Lovelace, 10, 64)
+		lj, _ := strconv.ParseUint(sorted[j].Lovelace, 10, 64)
+
+		return li > lj
+	})
+
+	return sorted
+}
+
+// returns the number of distinct payment keys of the inputs and the collateral, which must all sign the tx
+func countBuildTxSigners(inputs []UTXO, collateral *UTXO) int {
+	keys := make(map[string]struct{})
+
+	utxos := inputs
+	if collateral != nil {
+		utxos = append(utxos[:len(utxos):len(utxos)], *collateral)
+	}
+
+	for _, u := range utxos {
+		if addr, err := common.NewAddress(u.Address); err == nil && isKeyAddress(addr) {
+			keys[addr.PaymentKeyHash().String()] = struct{}{}
+		} else {
+			// Byron addresses, counted as one witness each
+			keys[u.Address] = struct{}{}
+		}
+	}
+
+	return len(keys)
+}
+
+func sortedAssetKeys(assets map[string]*big.Int) []string {
+	keys := make([]string, 0, len(assets))
+	for k := range assets {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBuildTx(t *testing.T) {
+	params := newValidatorTestParams()
+
+	_, from := newValidatorTestKey(1)
+	_, to := newValidatorTestKey(2)
+
+	asset := strings.Repeat("ab", 28) + "74657374"
+
+	available := []UTXO{
+		{TxID: strings.Repeat("01", 32), OutputIndex: 0, Address: from.String(), Lovelace: "3000000"},
+		{TxID: strings.Repeat("02", 32), OutputIndex: 1, Address: from.String(), Lovelace: "5000000"},
+		{TxID: strings.Repeat("03", 32), OutputIndex: 0, Address: from.String(), Lovelace: "1500000", Assets: []PolicyAsset{{Asset: asset, Quantity: "10"}}},
+	}
+
+	// checks that the tx is balanced, and that the fee covers the size of the signed tx
+	checkBalanced := func(t *testing.T, req BuildTxRequest, available []UTXO) ([]UTXO, uint64, int) {
+		tx, selected, err := BuildTx(params, req, available, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		in := uint64(0)
+		for _, u := range selected {
+			l, _ := strconv.ParseUint(u.Lovelace, 10, 64)
+			in += l
+		}
+
+		out := tx.Fee()
+		for _, o := range tx.Outputs() {
+			out += o.Amount()
+
+			if o.Amount() < MinOutputLovelace(params, o) {
+				t.Errorf("output too small")
+			}
+		}
+
+		if in != out {
+			t.Errorf("tx isn't balanced: %d in, %d out", in, out)
+		}
+
+		if minFee := EstimateTxFee(params, tx, 0, 1).Fee; tx.Fee() < minFee {
+			t.Errorf("fee %d below min fee %d", tx.Fee(), minFee)
+		}
+
+		return selected, tx.Fee(), len(tx.Outputs())
+	}
+
+	t.Run("LargestFirst", func(t *testing.T) {
+		selected, _, nOutputs := checkBalanced(t, BuildTxRequest{
+			From:    []string{from.String()},
+			Outputs: []BuildTxOutput{{Address: to.String(), Lovelace: "2000000"}},
+		}, available)
+
+		if len(selected) != 1 || selected[0].Lovelace != "5000000" || nOutputs != 2 {
+			t.Errorf("unexpected selection %v", selected)
+		}
+	})
+
+	t.Run("Assets", func(t *testing.T) {
+		selected, _, _ := checkBalanced(t, BuildTxRequest{
+			From:    []string{from.String()},
+			Outputs: []BuildTxOutput{{Address: to.String(), Assets: []PolicyAsset{{Asset: asset, Quantity: "4"}}}},
+		}, available)
+
+		// the UTXO with the asset is selected first, and its lovelace doesn't cover the change
+		if len(selected) != 2 || selected[0].Assets == nil {
+			t.Errorf("unexpected selection %v", selected)
+		}
+	})
+
+	t.Run("DustAddedToFee", func(t *testing.T) {
+		_, fee, nOutputs := checkBalanced(t, BuildTxRequest{
+			From:    []string{from.String()},
+			Outputs: []BuildTxOutput{{Address: to.String(), Lovelace: "7800000"}},
+		}, available[:2]) // without the UTXO containing assets
+
+		if nOutputs != 1 || fee != 200000 {
+			t.Errorf("expected the leftover to be added to the fee, got fee %d and %d outputs", fee, nOutputs)
+		}
+	})
+
+	t.Run("NotEnoughFunds", func(t *testing.T) {
+		_, _, err := BuildTx(params, BuildTxRequest{
+			From:    []string{from.String()},
+			Outputs: []BuildTxOutput{{Address: to.String(), Lovelace: "9500000"}},
+		}, available, nil)
+
+		if _, ok := err.(*TxBuildError); !ok {
+			t.Errorf("expected a TxBuildError, got %v", err)
+		}
+	})
+
+	t.Run("OutputTooSmall", func(t *testing.T) {
+		_, _, err := BuildTx(params, BuildTxRequest{
+			From:    []string{from.String()},
+			Outputs: []BuildTxOutput{{Address: to.String(), Lovelace: "1000"}},
+		}, available, nil)
+
+		if _, ok := err.(*TxBuildError); !ok {
+			t.Errorf("expected a TxBuildError, got %v", err)
+		}
+	})
+
+	t.Run("MetadataAndValidity", func(t *testing.T) {
+		validTo := uint64(5000)
+
+		tx, _, err := BuildTx(params, BuildTxRequest{
+			From:     []string{from.String()},
+			Outputs:  []BuildTxOutput{{Address: to.String(), Lovelace: "2000000"}},
+			Metadata: map[uint64]any{674: map[string]any{"msg": []any{"hello"}}},
+			ValidTo:  &validTo,
+		}, available, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tx.TTL() != 5000 || tx.AuxDataHash() == nil {
+			t.Errorf("unexpected ttl %d or missing metadata hash", tx.TTL())
+		}
+	})
+}
+
+func TestBuildTxCollateralInput(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	testCases := []struct {
+		collateral string
+		valid      bool
+	}{
+		{"", true},
+		{hash + "#1", true},
+		{strings.ToUpper(hash) + "#4294967295", true},
+		{"zz#0", false},
+		{hash[:62] + "#0", false},
+		{hash + "#-1", false},
+		{hash + "#4294967296", false},
+		{hash, false},
+	}
+
+	for _, tc := range testCases {
+		in, err := BuildTxRequest{Collateral: tc.collateral}.collateralInput()
+		if tc.valid != (err == nil) {
+			t.Errorf("collateral %q: expected valid=%v, got %v", tc.collateral, tc.valid, err)
+		} else if tc.valid && tc.collateral != "" && (in.Id().String() != hash || strconv.Itoa(int(in.Index())) != strings.Split(tc.collateral, "#")[1]) {
+			t.Errorf("collateral %q: unexpected input %s#%d", tc.collateral, in.Id().String(), in.Index())
+		}
+	}
+}
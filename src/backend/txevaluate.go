@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+)
+
+// max duration of an evaluation by an external command, which is killed afterwards
+const txEvaluatorTimeout = 30 * time.Second
+
+// TxEvaluator computes the execution units of all the redeemers of a tx.
+// utxos contains the resolved inputs, reference inputs and collateral inputs of the tx.
+type TxEvaluator interface {
+	Evaluate(ctx context.Context, tx ledger.Transaction, utxos []UTXO, params TxEvaluationParams) ([]RedeemerEvaluation, error)
+}
+
+// TxEvaluationParams contains the chain state needed by the scripts
+type TxEvaluationParams struct {
+	CostModels struct {
+		PlutusV1 []int `json:"PlutusV1"`
+		PlutusV2 []int `json:"PlutusV2"`
+		PlutusV3 []int `json:"PlutusV3"`
+	} `json:"costModels"`
+	MaxTxExecutionUnits struct {
+		Memory int64 `json:"memory"`
+		Steps  int64 `json:"steps"`
+	} `json:"maxTxExecutionUnits"`
+
+	// used to convert the validity interval of the tx to POSIX time
+	RefTipSlot     int64 `json:"refTipSlot"`
+	RefTipTime     int64 `json:"refTipTime"` // in milliseconds
+	SecondsPerSlot int   `json:"secondsPerSlot"`
+
+	NetworkName string `json:"networkName"`
+}
+
+type RedeemerEvaluation struct {
+	Tag    string   `json:"tag"` // spend, mint, cert, reward, voting or proposing
+	Index  uint     `json:"index"`
+	Memory uint64   `json:"memory"`
+	Steps  uint64   `json:"steps"`
+	Fee    uint64   `json:"fee"` // lovelace, rounded up
+	Logs   []string `json:"logs"`
+}
+
+// TxEvaluationError is returned when a script fails
+type TxEvaluationError struct {
+	Message string   `json:"error"`
+	Logs    []string `json:"logs,omitempty"`
+}
+
+func (e *TxEvaluationError) Error() string {
+	return e.Message
+}
+
+var redeemerTagNames = map[common.RedeemerTag]string{
+	common.RedeemerTagSpend:     "spend",
+	common.RedeemerTagMint:      "mint",
+	common.RedeemerTagCert:      "cert",
+	common.RedeemerTagReward:    "reward",
+	common.RedeemerTagVoting:    "voting",
+	common.RedeemerTagProposing: "proposing",
+}
+
+// ExternalTxEvaluator delegates the evaluation to an external command (e.g. a wrapper around aiken or uplc), set using the --tx-evaluator flag.
+// The command receives an ExternalTxEvaluatorRequest on stdin, and must write an ExternalTxEvaluatorResponse to stdout.
+type ExternalTxEvaluator struct {
+	command string
+	timeout time.Duration
+}
+
+type ExternalTxEvaluatorRequest struct {
+	CBORHex string             `json:"cborHex"`
+	UTXOs   []string           `json:"utxos"` // CBOR encoded (input, output) pairs
+	Params  TxEvaluationParams `json:"params"`
+}
+
+// Error is set if any script fails, Logs then contains the trace of the failing script
+type ExternalTxEvaluatorResponse struct {
+	Redeemers []RedeemerEvaluation `json:"redeemers"`
+	Error     string               `json:"error,omitempty"`
+	Logs      []string             `json:"logs,omitempty"`
+}
+
+// the command is split on whitespace, without shell quoting
+func NewExternalTxEvaluator(command string) (*ExternalTxEvaluator, error) {
+	if len(strings.Fields(command)) == 0 {
+		return nil, fmt.Errorf("invalid tx evaluator command %q", command)
+	}
+
+	return &ExternalTxEvaluator{command, txEvaluatorTimeout}, nil
+}
+
+// Evaluate kills the command if ctx is cancelled, or if it runs for longer than the timeout
+func (e *ExternalTxEvaluator) Evaluate(ctx context.Context, tx ledger.Transaction, utxos []UTXO, params TxEvaluationParams) ([]RedeemerEvaluation, error) {
+	req := ExternalTxEvaluatorRequest{
+		CBORHex: hex.EncodeToString(tx.Cbor()),
+		UTXOs:   []string{},
+		Params:  params,
+	}
+
+	for _, utxo := range utxos {
+		encoded, err := EncodeUTXO(utxo)
+		if err != nil {
+			return nil, err
+		}
+
+		req.UTXOs = append(req.UTXOs, hex.EncodeToString(encoded))
+	}
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	fields := strings.Fields(e.command)
+	cmd := exec.CommandContext(ctx, fields[0], fields[1:]...)
+
+	// children of the command might keep stdout open after it is killed
+	cmd.WaitDelay = time.Second
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("tx evaluator timed out after %v", e.timeout)
+	} else if err != nil {
+		return nil, fmt.Errorf("tx evaluator failed: %w, %s", err, stderr.String())
+	}
+
+	var resp ExternalTxEvaluatorResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("invalid tx evaluator output: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, &TxEvaluationError{resp.Error, resp.Logs}
+	}
+
+	return resp.Redeemers, nil
+}
+
+// returns the redeemers of the tx, sorted by tag and index, in the same format as the evaluation results
+func txRedeemers(tx ledger.Transaction) []RedeemerEvaluation {
+	redeemers := []RedeemerEvaluation{}
+
+	ws := tx.Witnesses()
+	if ws == nil || ws.Redeemers() == nil {
+		return redeemers
+	}
+
+	for tag := common.RedeemerTagSpend; tag <= common.RedeemerTagProposing; tag++ {
+		indexes := ws.Redeemers().Indexes(tag)
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+		for _, i := range indexes {
+			redeemers = append(redeemers, RedeemerEvaluation{Tag: redeemerTagNames[tag], Index: i, Logs: []string{}})
+		}
+	}
+
+	return redeemers
+}
+
+// checks that the evaluator returned exactly one result per redeemer, and sets the fee of each redeemer
+func completeRedeemerEvaluations(tx ledger.Transaction, evaluations []RedeemerEvaluation, params CardanoCLIParameters) ([]RedeemerEvaluation, error) {
+	expected := txRedeemers(tx)
+
+	byKey := make(map[string]RedeemerEvaluation)
+	for _, e := range evaluations {
+		byKey[fmt.Sprintf("%s#%d", e.Tag, e.Index)] = e
+	}
+
+	if len(byKey) != len(expected) {
+		return nil, fmt.Errorf("tx evaluator returned %d results for %d redeemers", len(byKey), len(expected))
+	}
+
+	for i, r := range expected {
+		e, ok := byKey[fmt.Sprintf("%s#%d", r.Tag, r.Index)]
+		if !ok {
+			return nil, fmt.Errorf("tx evaluator didn't return a result for %s redeemer %d", r.Tag, r.Index)
+		}
+
+		if e.Logs == nil {
+			e.Logs = []string{}
+		}
+
+		e.Fee = ExUnitsFee(params, common.ExUnits{Memory: e.Memory, Steps: e.Steps})
+		expected[i] = e
+	}
+
+	return expected, nil
+}
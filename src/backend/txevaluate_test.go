@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+// returns a tx with a spend redeemer for input 0 and a mint redeemer for policy 0
+func newEvaluatorTestTx(t *testing.T) ledger.Transaction {
+	_, addr := newValidatorTestKey(1)
+
+	body := validatorTestBody{
+		inputs:  []common.TransactionInput{shelley.NewShelleyTransactionInput(strings.Repeat("aa", 32), 0)},
+		outputs: []validatorTestOutput{{addr, 2000000}},
+		fee:     200000,
+	}
+
+	redeemers := []any{
+		[]any{1, 0, 0, []any{0, 0}},
+		[]any{0, 0, 0, []any{0, 0}},
+	}
+
+	txBytes, err := cbor.Encode([]any{body.encoded(), map[uint]any{5: redeemers}, true, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// returns an evaluator command that ignores its input and prints the given response
+func newEvaluatorTestCommand(t *testing.T, response string) string {
+	path := filepath.Join(t.TempDir(), "response.json")
+	if err := os.WriteFile(path, []byte(response), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return "cat " + path
+}
+
+func TestExternalTxEvaluator(t *testing.T) {
+	tx := newEvaluatorTestTx(t)
+	params := newValidatorTestParams()
+
+	testCases := []struct {
+		name     string
+		response string
+		check    func(redeemers []RedeemerEvaluation, err error) bool
+	}{
+		{
+			"Success",
+			`{"redeemers": [{"tag": "mint", "index": 0, "memory": 1000, "steps": 1000000, "logs": ["minted"]}, {"tag": "spend", "index": 0, "memory": 2000, "steps": 2000000}]}`,
+			func(redeemers []RedeemerEvaluation, err error) bool {
+				// sorted by tag, fees rounded up
+				return err == nil && len(redeemers) == 2 &&
+					redeemers[0].Tag == "spend" && redeemers[0].Fee == 260 && len(redeemers[0].Logs) == 0 &&
+					redeemers[1].Tag == "mint" && redeemers[1].Fee == 130 && redeemers[1].Logs[0] == "minted"
+			},
+		},
+		{
+			"MissingRedeemer",
+			`{"redeemers": [{"tag": "spend", "index": 0, "memory": 2000, "steps": 2000000}]}`,
+			func(redeemers []RedeemerEvaluation, err error) bool {
+				return err != nil && strings.Contains(err.Error(), "1 results for 2 redeemers")
+			},
+		},
+		{
+			"ScriptFailure",
+			`{"error": "validator crashed", "logs": ["trace 1", "trace 2"]}`,
+			func(redeemers []RedeemerEvaluation, err error) bool {
+				evalErr, ok := err.(*TxEvaluationError)
+				return ok && evalErr.Message == "validator crashed" && len(evalErr.Logs) == 2
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			evaluator, err := NewExternalTxEvaluator(newEvaluatorTestCommand(t, tc.response))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			redeemers, err := evaluator.Evaluate(context.Background(), tx, []UTXO{}, TxEvaluationParams{})
+			if err == nil {
+				redeemers, err = completeRedeemerEvaluations(tx, redeemers, params)
+			}
+
+			if !tc.check(redeemers, err) {
+				t.Errorf("unexpected evaluation result %#v (%v)", redeemers, err)
+			}
+		})
+	}
+}
+
+func TestExternalTxEvaluatorTimeout(t *testing.T) {
+	evaluator, err := NewExternalTxEvaluator("sleep 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evaluator.timeout = 100 * time.Millisecond
+
+	start := time.Now()
+
+	_, err = evaluator.Evaluate(context.Background(), newEvaluatorTestTx(t), []UTXO{}, TxEvaluationParams{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("evaluator wasn't killed, took %v", elapsed)
+	}
+}
+
+func TestExternalTxEvaluatorCommand(t *testing.T) {
+	for _, command := range []string{"", "  ", "\t"} {
+		if _, err := NewExternalTxEvaluator(command); err == nil {
+			t.Errorf("expected command %q to be rejected", command)
+		}
+	}
+}
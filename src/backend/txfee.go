@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math/big"
+
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+)
+
+// size of a vkey witness: a 2-element list containing a 32-byte key and a 64-byte signature
+const vkeyWitnessSize = 1 + (2 + 32) + (2 + 64)
+
+// TxFeeEstimate details the minimum fee of a draft tx
+type TxFeeEstimate struct {
+	Fee            uint64              `json:"fee"`
+	Size           int                 `json:"size"` // including the extra witnesses
+	SizeFee        uint64              `json:"sizeFee"`
+	Memory         uint64              `json:"memory"`
+	Steps          uint64              `json:"steps"`
+	ScriptFee      uint64              `json:"scriptFee"` // rounded up
+	RefScriptsSize int                 `json:"refScriptsSize"`
+	RefScriptsFee  uint64              `json:"refScriptsFee"` // rounded down
+	Outputs        []OutputMinLovelace `json:"outputs"`
+}
+
+type OutputMinLovelace struct {
+	Index       int    `json:"index"`
+	Lovelace    uint64 `json:"lovelace"`
+	MinLovelace uint64 `json:"minLovelace"`
+}
+
+// EstimateTxFee returns the minimum fee of a tx, assuming extraWitnesses vkey witnesses are added before submission.
+// The execution units are taken from the redeemers of the draft as is.
+// The size is that of the tx once the fee field of the draft (often 0) is set to the returned fee.
+func EstimateTxFee(params CardanoCLIParameters, tx ledger.Transaction, refScriptsSize int, extraWitnesses int) TxFeeEstimate {
+	exUnits := txExUnits(tx)
+
+	baseSize := len(tx.Cbor()) - cborUintSize(tx.Fee()) + extraWitnesses*vkeyWitnessSize
+	if ws := tx.Witnesses(); extraWitnesses > 0 && (ws == nil || len(ws.Vkey()) == 0) {
+		// the witness set doesn't contain the vkey witnesses entry yet: key, set tag (optional, but added by most wallets) and list header
+		baseSize += 1 + 3 + cborUintSize(uint64(extraWitnesses))
+	}
+
+	// converges in at most a few iterations, like RequiredOutputLovelace, because the encoded size of the fee only takes a few values
+	size := baseSize + cborUintSize(0)
+	for {
+		next := baseSize + cborUintSize(MinTxFee(params, size, exUnits, refScriptsSize))
+		if next == size {
+			break
+		}
+
+		size = next
+	}
+
+	refScriptsFee := ratFloor(RefScriptsFee(params.MinFeeRefScriptCostPerByte, refScriptsSize))
+
+	estimate := TxFeeEstimate{
+		Fee:            MinTxFee(params, size, exUnits, refScriptsSize),
+		Size:           size,
+		SizeFee:        uint64(params.TxFeeFixed) + uint64(params.TxFeePerByte)*uint64(size),
+		Memory:         exUnits.Memory,
+		Steps:          exUnits.Steps,
+		ScriptFee:      ExUnitsFee(params, exUnits),
+		RefScriptsSize: refScriptsSize,
+		RefScriptsFee:  new(big.Int).Quo(refScriptsFee.Num(), refScriptsFee.Denom()).Uint64(),
+		Outputs:        []OutputMinLovelace{},
+	}
+
+	for i, output := range tx.Outputs() {
+		estimate.Outputs = append(estimate.Outputs, OutputMinLovelace{
+			Index:       i,
+			Lovelace:    output.Amount(),
+			MinLovelace: RequiredOutputLovelace(params, output),
+		})
+	}
+
+	return estimate
+}
+
+// RequiredOutputLovelace returns the minimum lovelace of an output, taking into account that the encoded size of the lovelace field grows with its value.
+// This is the smallest value that can be set without the output becoming too small, unlike MinOutputLovelace which uses the current serialization.
+func RequiredOutputLovelace(params CardanoCLIParameters, output common.TransactionOutput) uint64 {
+	current := output.Amount()
+	baseCost := MinOutputLovelace(params, output) - uint64(cborUintSize(current))*uint64(params.UTXOCostPerByte)
+
+	// converges in at most a few iterations, because the encoded size only takes a few values
+	required := baseCost + uint64(cborUintSize(0))*uint64(params.UTXOCostPerByte)
+	for {
+		next := baseCost + uint64(cborUintSize(required))*uint64(params.UTXOCostPerByte)
+		if next == required {
+			return required
+		}
+
+		required = next
+	}
+}
+
+// returns the number of bytes of an encoded CBOR unsigned integer
+func cborUintSize(x uint64) int {
+	switch {
+	case x < 24:
+		return 1
+	case x < 1<<8:
+		return 2
+	case x < 1<<16:
+		return 3
+	case x < 1<<32:
+		return 5
+	default:
+		return 9
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+func TestEstimateTxFee(t *testing.T) {
+	params := newValidatorTestParams()
+	key, addr := newValidatorTestKey(1)
+	otherKey, _ := newValidatorTestKey(2)
+
+	body := validatorTestBody{
+		inputs:  []common.TransactionInput{shelley.NewShelleyTransactionInput(strings.Repeat("aa", 32), 0)},
+		outputs: []validatorTestOutput{{addr, 1}, {addr, 5000000}},
+		fee:     200000,
+	}
+
+	tx := encodeValidatorTestTx(t, body, nil)
+
+	estimate := EstimateTxFee(params, tx, 100, 2)
+
+	// the estimate includes the vkey witnesses entry of the witness set, assuming it's tagged as a set (the test helper doesn't tag it)
+	if size := len(newValidatorTestTx(t, body, key, otherKey).Cbor()) + 3; estimate.Size != size {
+		t.Errorf("expected size %d, got %d", size, estimate.Size)
+	}
+
+	if expected := uint64(155381 + 44*estimate.Size + 15*100); estimate.Fee != expected || estimate.RefScriptsFee != 1500 || estimate.ScriptFee != 0 {
+		t.Errorf("unexpected fee estimate %#v, expected fee %d", estimate, expected)
+	}
+
+	// the size of a draft with a zero fee is measured with the estimated fee
+	body.fee = 0
+	if draft := EstimateTxFee(params, encodeValidatorTestTx(t, body, nil), 100, 2); draft.Size != estimate.Size || draft.Fee != estimate.Fee {
+		t.Errorf("expected the draft with a zero fee to have the same estimate, got size %d and fee %d", draft.Size, draft.Fee)
+	}
+
+	if len(estimate.Outputs) != 2 || estimate.Outputs[0].MinLovelace != estimate.Outputs[1].MinLovelace || estimate.Outputs[1].Index != 1 {
+		t.Errorf("unexpected output estimates %#v", estimate.Outputs)
+	}
+}
+
+func TestRequiredOutputLovelace(t *testing.T) {
+	params := newValidatorTestParams()
+	_, addr := newValidatorTestKey(1)
+
+	// the required lovelace doesn't depend on the current amount
+	var required uint64
+	for _, lovelace := range []uint64{0, 100, 1000000, 10000000000} {
+		tx := encodeValidatorTestTx(t, validatorTestBody{outputs: []validatorTestOutput{{addr, lovelace}}}, nil)
+
+		r := RequiredOutputLovelace(params, tx.Outputs()[0])
+		if required != 0 && r != required {
+			t.Fatalf("expected %d for %d lovelace, got %d", required, lovelace, r)
+		}
+
+		required = r
+	}
+
+	tx := encodeValidatorTestTx(t, validatorTestBody{outputs: []validatorTestOutput{{addr, required}}}, nil)
+	if minLovelace := MinOutputLovelace(params, tx.Outputs()[0]); minLovelace != required {
+		t.Errorf("expected %d, got %d", required, minLovelace)
+	}
+}
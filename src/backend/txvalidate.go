@@ -0,0 +1,592 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+)
+
+// constant overhead of a UTXO entry in the ledger, added to the serialized output size when computing the min lovelace
+const utxoEntryOverhead = 160
+
+// reference script fees increase by a factor of 1.2 for each started tier of 25 KiB
+const (
+	refScriptsFeeTierSize = 25600
+	refScriptsFeeTierNum  = 6
+	refScriptsFeeTierDen  = 5
+)
+
+// TxValidator performs the phase-1 ledger checks that don't require a node round-trip.
+// The checks are only performed for Babbage and Conway txs, older txs are left to the node.
+type TxValidator struct {
+	params CardanoCLIParameters
+	slot   uint64 // current slot, used to check the validity interval
+
+	// returns false if the input doesn't exist or has already been spent
+	resolve func(in common.TransactionInput) (UTXO, bool, error)
+}
+
+func NewTxValidator(params CardanoCLIParameters, slot uint64, resolve func(common.TransactionInput) (UTXO, bool, error)) *TxValidator {
+	return &TxValidator{params, slot, resolve}
+}
+
+// Validate returns nil if the tx passes all checks.
+// Problems are returned using the same structure as parsed node rejections, the Raw field lists them using the names of the corresponding ledger errors.
+func (v *TxValidator) Validate(tx ledger.Transaction) (*CardanoCLITxSubmitError, error) {
+	if !isBabbageOrConwayTx(tx) {
+		return nil, nil
+	}
+
+	res := &CardanoCLITxSubmitError{}
+	problems := []string{}
+
+	addProblem := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	utxos := make(map[string]UTXO)
+	for _, inputs := range [][]common.TransactionInput{tx.Inputs(), tx.ReferenceInputs(), tx.Collateral()} {
+		for _, in := range inputs {
+			key := inputKey(in)
+			if _, ok := utxos[key]; ok {
+				continue
+			}
+
+			utxo, ok, err := v.resolve(in)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				utxos[key] = utxo
+			} else if !containsTxIn(res.BadInputs, in) {
+				res.BadInputs = append(res.BadInputs, CardanoTxIn{TxID: in.Id().String(), Index: int(in.Index())})
+			}
+		}
+	}
+
+	if len(res.BadInputs) > 0 {
+		addProblem("BadInputsUTxO %v", res.BadInputs)
+	}
+
+	size := len(tx.Cbor())
+	if size > v.params.MaxTxSize {
+		res.TxTooLarge = &CardanoSizeMismatch{Supplied: size, Expected: v.params.MaxTxSize}
+		addProblem("MaxTxSizeUTxO (supplied %d, expected at most %d)", size, v.params.MaxTxSize)
+	}
+
+	minFee := MinTxFee(v.params, size, txExUnits(tx), refScriptsSize(tx, utxos))
+	if tx.Fee() < minFee {
+		res.FeeTooSmall = &CardanoValueMismatch{Supplied: int64(tx.Fee()), Expected: int64(minFee)}
+		addProblem("FeeTooSmallUTxO (supplied %d, expected at least %d)", tx.Fee(), minFee)
+	}
+
+	if start := tx.ValidityIntervalStart(); (start != 0 && v.slot < start) || (tx.TTL() != 0 && v.slot >= tx.TTL()) {
+		res.OutsideValidityInterval = &CardanoValidityInterval{InvalidBefore: start, InvalidHereafter: tx.TTL(), Slot: v.slot}
+		addProblem("OutsideValidityIntervalUTxO (invalidBefore %d, invalidHereafter %d, current slot %d)", start, tx.TTL(), v.slot)
+	}
+
+	// value conservation can't be checked if some inputs are unknown, and txs marked as invalid only consume their collateral
+	if len(res.BadInputs) == 0 && tx.IsValid() {
+		if mismatch, ok := v.checkValueConserved(tx, utxos); !ok {
+			res.ValueMismatch = mismatch
+			addProblem("ValueNotConservedUTxO (supplied %d, expected %d)", mismatch.Supplied, mismatch.Expected)
+		}
+	}
+
+	for i, output := range tx.Outputs() {
+		if minLovelace := MinOutputLovelace(v.params, output); output.Amount() < minLovelace {
+			res.OutputsTooSmall = append(res.OutputsTooSmall, CardanoTxOutTooSmall{Index: i, Lovelace: output.Amount(), MinLovelace: minLovelace})
+			addProblem("BabbageOutputTooSmallUTxO (output %d has %d lovelace, expected at least %d)", i, output.Amount(), minLovelace)
+		}
+	}
+
+	if hasRedeemers(tx) {
+		v.checkCollateral(tx, utxos, res, addProblem)
+	}
+
+	v.checkWitnesses(tx, utxos, res, addProblem)
+
+	if len(problems) == 0 {
+		return nil, nil
+	}
+
+	res.Raw = strings.Join(problems, "; ")
+
+	return res, nil
+}
+
+// MinTxFee returns the minimum fee of a tx, refScriptsSize is the total size of the reference scripts of its spent and referenced inputs
+func MinTxFee(params CardanoCLIParameters, txSize int, exUnits common.ExUnits, refScriptsSize int) uint64 {
+	fee := new(big.Rat).SetInt64(int64(params.TxFeeFixed) + int64(params.TxFeePerByte)*int64(txSize))
+
+	fee.Add(fee, ratCeil(exUnitsFee(params, exUnits)))
+	fee.Add(fee, ratFloor(RefScriptsFee(params.MinFeeRefScriptCostPerByte, refScriptsSize)))
+
+	return new(big.Int).Quo(fee.Num(), fee.Denom()).Uint64()
+}
+
+// ExUnitsFee returns the fee for the given execution units, rounded up
+func ExUnitsFee(params CardanoCLIParameters, exUnits common.ExUnits) uint64 {
+	fee := ratCeil(exUnitsFee(params, exUnits))
+
+	return new(big.Int).Quo(fee.Num(), fee.Denom()).Uint64()
+}
+
+func exUnitsFee(params CardanoCLIParameters, exUnits common.ExUnits) *big.Rat {
+	fee := new(big.Rat).Mul(ratFromFloat(params.ExecutionUnitPrices.PriceMemory), new(big.Rat).SetInt(new(big.Int).SetUint64(exUnits.Memory)))
+	fee.Add(fee, new(big.Rat).Mul(ratFromFloat(params.ExecutionUnitPrices.PriceSteps), new(big.Rat).SetInt(new(big.Int).SetUint64(exUnits.Steps))))
+
+	return fee
+}
+
+// RefScriptsFee returns the tiered fee for the given total size of reference scripts, before rounding
+func RefScriptsFee(costPerByte int, size int) *big.Rat {
+	fee := new(big.Rat)
+	price := new(big.Rat).SetInt64(int64(costPerByte))
+	multiplier := big.NewRat(refScriptsFeeTierNum, refScriptsFeeTierDen)
+
+	for size > 0 {
+		n := min(size, refScriptsFeeTierSize)
+
+		fee.Add(fee, new(big.Rat).Mul(price, new(big.Rat).SetInt64(int64(n))))
+		price.Mul(price, multiplier)
+
+		size -= n
+	}
+
+	return fee
+}
+
+// MinOutputLovelace returns the minimum number of lovelace the output must contain, given its current serialization
+func MinOutputLovelace(params CardanoCLIParameters, output common.TransactionOutput) uint64 {
+	outputCbor := output.Cbor()
+	if len(outputCbor) == 0 {
+		var err error
+		outputCbor, err = cbor.Encode(output)
+		if err != nil {
+			return 0
+		}
+	}
+
+	return uint64(utxoEntryOverhead+len(outputCbor)) * uint64(params.UTXOCostPerByte)
+}
+
+func (v *TxValidator) checkValueConserved(tx ledger.Transaction, utxos map[string]UTXO) (*CardanoValueMismatch, bool) {
+	balance, ok := newTxBalance(v.params, tx, utxos)
+	if !ok {
+		return nil, true
+	}
+
+	if balance.consumed != balance.produced || !equalAssetQuantities(balance.consumedAssets, balance.producedAssets) {
+		return &CardanoValueMismatch{Supplied: balance.consumed, Expected: balance.produced}, false
+	}
+
+	return nil, true
+}
+
+// txBalance contains the lovelace and assets consumed and produced by a tx, the fee and deposits count as produced
+type txBalance struct {
+	consumed       int64
+	produced       int64
+	deposits       int64 // deposits paid by the tx minus deposits refunded, included in produced and consumed
+	consumedAssets map[string]*big.Int
+	producedAssets map[string]*big.Int
+}
+
+// returns false if the balance can't be determined, utxos must contain all the spent inputs
+func newTxBalance(params CardanoCLIParameters, tx ledger.Transaction, utxos map[string]UTXO) (txBalance, bool) {
+	consumed := int64(0)
+	consumedAssets := make(map[string]*big.Int)
+
+	for _, in := range tx.Inputs() {
+		utxo := utxos[inputKey(in)]
+
+		lovelace, _ := strconv.ParseInt(utxo.Lovelace, 10, 64)
+		consumed += lovelace
+
+		for _, a := range utxo.Assets {
+			qty, _ := new(big.Int).SetString(a.Quantity, 10)
+			addAssetQuantity(consumedAssets, a.Asset, qty)
+		}
+	}
+
+	for _, amount := range tx.Withdrawals() {
+		consumed += int64(amount)
+	}
+
+	if mint := tx.AssetMint(); mint != nil {
+		for _, policy := range mint.Policies() {
+			for _, name := range mint.Assets(policy) {
+				addAssetQuantity(consumedAssets, policy.String()+hex.EncodeToString(name), big.NewInt(mint.Asset(policy, name)))
+			}
+		}
+	}
+
+	produced := int64(tx.Fee()) + int64(tx.Donation())
+	producedAssets := make(map[string]*big.Int)
+
+	for _, output := range tx.Outputs() {
+		produced += int64(output.Amount())
+
+		if ma := output.Assets(); ma != nil {
+			for _, policy := range ma.Policies() {
+				for _, name := range ma.Assets(policy) {
+					addAssetQuantity(producedAssets, policy.String()+hex.EncodeToString(name), new(big.Int).SetUint64(ma.Asset(policy, name)))
+				}
+			}
+		}
+	}
+
+	deposits := int64(0)
+
+	for _, p := range tx.ProposalProcedures() {
+		produced += int64(p.Deposit)
+		deposits += int64(p.Deposit)
+	}
+
+	keyDeposit := params.StakeAddressDeposit
+
+	for _, cert := range tx.Certificates() {
+		switch c := cert.(type) {
+		case *common.StakeRegistrationCertificate:
+			produced += keyDeposit
+			deposits += keyDeposit
+		case *common.StakeDeregistrationCertificate:
+			consumed += keyDeposit
+			deposits -= keyDeposit
+		case *common.RegistrationCertificate:
+			produced += c.Amount
+			deposits += c.Amount
+		case *common.DeregistrationCertificate:
+			consumed += c.Amount
+			deposits -= c.Amount
+		case *common.StakeRegistrationDelegationCertificate:
+			produced += c.Amount
+			deposits += c.Amount
+		case *common.VoteRegistrationDelegationCertificate:
+			produced += c.Amount
+			deposits += c.Amount
+		case *common.StakeVoteRegistrationDelegationCertificate:
+			produced += c.Amount
+			deposits += c.Amount
+		case *common.RegistrationDrepCertificate:
+			produced += c.Amount
+			deposits += c.Amount
+		case *common.DeregistrationDrepCertificate:
+			consumed += c.Amount
+			deposits -= c.Amount
+		case *common.PoolRegistrationCertificate:
+			// the pool deposit is only paid when registering a new pool, which can't be determined here
+			return txBalance{}, false
+		}
+	}
+
+	return txBalance{consumed, produced, deposits, consumedAssets, producedAssets}, true
+}
+
+func (v *TxValidator) checkCollateral(tx ledger.Transaction, utxos map[string]UTXO, res *CardanoCLITxSubmitError, addProblem func(string, ...any)) {
+	collateral := tx.Collateral()
+
+	if len(collateral) == 0 {
+		res.NoCollateralInputs = true
+		addProblem("NoCollateralInputs")
+		return
+	}
+
+	if len(collateral) > v.params.MaxCollateralInputs {
+		res.TooManyCollateralInputs = &CardanoSizeMismatch{Supplied: len(collateral), Expected: v.params.MaxCollateralInputs}
+		addProblem("TooManyCollateralInputs (supplied %d, expected at most %d)", len(collateral), v.params.MaxCollateralInputs)
+	}
+
+	provided := int64(0)
+	assets := make(map[string]*big.Int)
+
+	for _, in := range collateral {
+		utxo, ok := utxos[inputKey(in)]
+		if !ok {
+			// already reported as a bad input
+			return
+		}
+
+		if addr, err := common.NewAddress(utxo.Address); err == nil && isScriptAddress(addr) {
+			res.ScriptCollateral = append(res.ScriptCollateral, CardanoTxIn{TxID: in.Id().String(), Index: int(in.Index())})
+			addProblem("ScriptsNotPaidUTxO (collateral input %s is locked by a script)", inputKey(in))
+		}
+
+		lovelace, _ := strconv.ParseInt(utxo.Lovelace, 10, 64)
+		provided += lovelace
+
+		for _, a := range utxo.Assets {
+			qty, _ := new(big.Int).SetString(a.Quantity, 10)
+			addAssetQuantity(assets, a.Asset, qty)
+		}
+	}
+
+	returnedAssets := make(map[string]*big.Int)
+
+	if ret := tx.CollateralReturn(); ret != nil {
+		provided -= int64(ret.Amount())
+
+		if ma := ret.Assets(); ma != nil {
+			for _, policy := range ma.Policies() {
+				for _, name := range ma.Assets(policy) {
+					addAssetQuantity(returnedAssets, policy.String()+hex.EncodeToString(name), new(big.Int).SetUint64(ma.Asset(policy, name)))
+				}
+			}
+		}
+	}
+
+	if !equalAssetQuantities(assets, returnedAssets) {
+		res.CollateralContainsNonADA = true
+		addProblem("CollateralContainsNonADA")
+	}
+
+	// the required collateral is rounded up
+	required := (int64(tx.Fee())*int64(v.params.CollateralPercentage) + 99) / 100
+	if provided < required {
+		res.InsufficientCollateral = &CardanoCollateralInfo{Delta: provided - required, Provided: provided}
+		addProblem("InsufficientCollateral (provided %d, expected at least %d)", provided, required)
+	}
+
+	if total := tx.TotalCollateral(); total != 0 && int64(total) != provided {
+		res.IncorrectTotalCollateral = &CardanoValueMismatch{Supplied: int64(total), Expected: provided}
+		addProblem("IncorrectTotalCollateralField (supplied %d, expected %d)", total, provided)
+	}
+}
+
+func (v *TxValidator) checkWitnesses(tx ledger.Transaction, utxos map[string]UTXO, res *CardanoCLITxSubmitError, addProblem func(string, ...any)) {
+	required := requiredSigners(tx, utxos)
+
+	provided := make(map[string]struct{})
+	txHash := tx.Hash()
+
+	if ws := tx.Witnesses(); ws != nil {
+		for _, w := range ws.Vkey() {
+			if len(w.Vkey) != ed25519.PublicKeySize || !ed25519.Verify(ed25519.PublicKey(w.Vkey), txHash[:], w.Signature) {
+				res.InvalidWitnesses = append(res.InvalidWitnesses, hex.EncodeToString(w.Vkey))
+				continue
+			}
+
+			provided[common.Blake2b224Hash(w.Vkey).String()] = struct{}{}
+		}
+	}
+
+	if len(res.InvalidWitnesses) > 0 {
+		addProblem("InvalidWitnessesUTXOW %v", res.InvalidWitnesses)
+	}
+
+	for keyHash := range required {
+		if _, ok := provided[keyHash]; !ok {
+			res.MissingSigners = append(res.MissingSigners, keyHash)
+		}
+	}
+
+	if len(res.MissingSigners) > 0 {
+		sort.Strings(res.MissingSigners)
+		addProblem("MissingVKeyWitnessesUTXOW %v", res.MissingSigners)
+	}
+}
+
+// returns the hashes of the keys that must sign a tx, utxos must contain its spent and collateral inputs
+func requiredSigners(tx ledger.Transaction, utxos map[string]UTXO) map[string]struct{} {
+	required := make(map[string]struct{})
+
+	for _, inputs := range [][]common.TransactionInput{tx.Inputs(), tx.Collateral()} {
+		for _, in := range inputs {
+			utxo, ok := utxos[inputKey(in)]
+			if !ok {
+				continue
+			}
+
+			// Byron addresses are witnessed by bootstrap witnesses, and script addresses by scripts
+			if addr, err := common.NewAddress(utxo.Address); err == nil && isKeyAddress(addr) {
+				required[addr.PaymentKeyHash().String()] = struct{}{}
+			}
+		}
+	}
+
+	for _, signer := range tx.RequiredSigners() {
+		required[signer.String()] = struct{}{}
+	}
+
+	for addr := range tx.Withdrawals() {
+		if addr.Type() == common.AddressTypeNoneKey {
+			required[addr.StakeKeyHash().String()] = struct{}{}
+		}
+	}
+
+	for _, cert := range tx.Certificates() {
+		if cred := certificateCredential(cert); cred != nil && cred.CredType == common.CredentialTypeAddrKeyHash {
+			required[hex.EncodeToString(cred.Credential[:])] = struct{}{}
+		}
+	}
+
+	return required
+}
+
+// returns the credential that must witness the certificate, nil if none is required or the certificate type isn't handled
+func certificateCredential(cert common.Certificate) *common.Credential {
+	switch c := cert.(type) {
+	case *common.StakeDeregistrationCertificate:
+		return &c.StakeDeregistration
+	case *common.StakeDelegationCertificate:
+		return c.StakeCredential
+	case *common.RegistrationCertificate:
+		return &c.StakeCredential
+	case *common.DeregistrationCertificate:
+		return &c.StakeCredential
+	case *common.VoteDelegationCertificate:
+		return &c.StakeCredential
+	case *common.StakeVoteDelegationCertificate:
+		return &c.StakeCredential
+	case *common.StakeRegistrationDelegationCertificate:
+		return &c.StakeCredential
+	case *common.VoteRegistrationDelegationCertificate:
+		return &c.StakeCredential
+	case *common.StakeVoteRegistrationDelegationCertificate:
+		return &c.StakeCredential
+	default:
+		return nil
+	}
+}
+
+// returns the sum of the execution units of all redeemers
+func txExUnits(tx ledger.Transaction) common.ExUnits {
+	total := common.ExUnits{}
+
+	ws := tx.Witnesses()
+	if ws == nil || ws.Redeemers() == nil {
+		return total
+	}
+
+	redeemers := ws.Redeemers()
+
+	for tag := common.RedeemerTagSpend; tag <= common.RedeemerTagProposing; tag++ {
+		for _, i := range redeemers.Indexes(tag) {
+			_, units := redeemers.Value(i, tag)
+			total.Memory += units.Memory
+			total.Steps += units.Steps
+		}
+	}
+
+	return total
+}
+
+func hasRedeemers(tx ledger.Transaction) bool {
+	ws := tx.Witnesses()
+	if ws == nil || ws.Redeemers() == nil {
+		return false
+	}
+
+	for tag := common.RedeemerTagSpend; tag <= common.RedeemerTagProposing; tag++ {
+		if len(ws.Redeemers().Indexes(tag)) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the total size of the reference scripts of the spent and referenced inputs
+func refScriptsSize(tx ledger.Transaction, utxos map[string]UTXO) int {
+	size := 0
+
+	for _, inputs := range [][]common.TransactionInput{tx.Inputs(), tx.ReferenceInputs()} {
+		for _, in := range inputs {
+			if utxo, ok := utxos[inputKey(in)]; ok {
+				size += len(utxo.RefScript) / 2
+			}
+		}
+	}
+
+	return size
+}
+
+func isKeyAddress(addr common.Address) bool {
+	switch addr.Type() {
+	case common.AddressTypeKeyKey, common.AddressTypeKeyScript, common.AddressTypeKeyPointer, common.AddressTypeKeyNone:
+		return true
+	default:
+		return false
+	}
+}
+
+func isScriptAddress(addr common.Address) bool {
+	switch addr.Type() {
+	case common.AddressTypeScriptKey, common.AddressTypeScriptScript, common.AddressTypeScriptPointer, common.AddressTypeScriptNone:
+		return true
+	default:
+		return false
+	}
+}
+
+func containsTxIn(txIns []CardanoTxIn, in common.TransactionInput) bool {
+	for _, txIn := range txIns {
+		if txIn.TxID == in.Id().String() && txIn.Index == int(in.Index()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func addAssetQuantity(assets map[string]*big.Int, asset string, qty *big.Int) {
+	if qty == nil {
+		return
+	}
+
+	if prev, ok := assets[asset]; ok {
+		prev.Add(prev, qty)
+	} else {
+		assets[asset] = new(big.Int).Set(qty)
+	}
+}
+
+// zero quantities are ignored
+func equalAssetQuantities(a map[string]*big.Int, b map[string]*big.Int) bool {
+	for asset, qty := range a {
+		if other, ok := b[asset]; qty.Sign() != 0 && (!ok || qty.Cmp(other) != 0) {
+			return false
+		}
+	}
+
+	for asset, qty := range b {
+		if other, ok := a[asset]; qty.Sign() != 0 && (!ok || qty.Cmp(other) != 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// the float is formatted first, so that e.g. 0.0577 becomes exactly 577/10000
+func ratFromFloat(f float64) *big.Rat {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return new(big.Rat).SetFloat64(f)
+	}
+
+	return r
+}
+
+func ratFloor(r *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Quo(r.Num(), r.Denom()))
+}
+
+func ratCeil(r *big.Rat) *big.Rat {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() > 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	return new(big.Rat).SetInt(q)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/blinklabs-io/gouroboros/cbor"
+	"github.com/blinklabs-io/gouroboros/ledger"
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+	"github.com/blinklabs-io/gouroboros/ledger/shelley"
+)
+
+func newValidatorTestParams() CardanoCLIParameters {
+	params := CardanoCLIParameters{
+		CollateralPercentage:       150,
+		MaxCollateralInputs:        3,
+		MaxTxSize:                  16384,
+		MinFeeRefScriptCostPerByte: 15,
+		TxFeeFixed:                 155381,
+		TxFeePerByte:               44,
+		UTXOCostPerByte:            4310,
+	}
+
+	params.ExecutionUnitPrices.PriceMemory = 0.0577
+	params.ExecutionUnitPrices.PriceSteps = 0.0000721
+
+	return params
+}
+
+type validatorTestOutput struct {
+	addr     common.Address
+	lovelace uint64
+}
+
+type validatorTestBody struct {
+	inputs  []common.TransactionInput
+	outputs []validatorTestOutput
+	fee     uint64
+	ttl     uint64
+}
+
+func (b validatorTestBody) encoded() map[uint]any {
+	inputs := []any{}
+	for _, in := range b.inputs {
+		id := in.Id()
+		inputs = append(inputs, []any{id[:], in.Index()})
+	}
+
+	outputs := []any{}
+	for _, out := range b.outputs {
+		outputs = append(outputs, out.encoded())
+	}
+
+	return map[uint]any{0: inputs, 1: outputs, 2: b.fee, 3: b.ttl}
+}
+
+func (o validatorTestOutput) encoded() map[uint]any {
+	addrBytes, err := o.addr.Bytes()
+	if err != nil {
+		panic(err)
+	}
+
+	return map[uint]any{0: addrBytes, 1: o.lovelace}
+}
+
+// signs the tx body with the given keys
+func newValidatorTestTx(t *testing.T, body validatorTestBody, keys ...ed25519.PrivateKey) ledger.Transaction {
+	return encodeValidatorTestTx(t, body, signValidatorTestTx(t, body, keys...))
+}
+
+func signValidatorTestTx(t *testing.T, body validatorTestBody, keys ...ed25519.PrivateKey) []any {
+	txHash := encodeValidatorTestTx(t, body, nil).Hash()
+
+	witnesses := []any{}
+	for _, key := range keys {
+		witnesses = append(witnesses, []any{[]byte(key.Public().(ed25519.PublicKey)), ed25519.Sign(key, txHash[:])})
+	}
+
+	return witnesses
+}
+
+func encodeValidatorTestTx(t *testing.T, body validatorTestBody, witnesses []any) ledger.Transaction {
+	witnessSet := map[uint]any{}
+	if len(witnesses) > 0 {
+		witnessSet[0] = witnesses
+	}
+
+	txBytes, err := cbor.Encode([]any{body.encoded(), witnessSet, true, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := decodeTx(txBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+func newValidatorTestKey(seed byte) (ed25519.PrivateKey, common.Address) {
+	key := ed25519.NewKeyFromSeed([]byte(strings.Repeat(string([]byte{seed}), ed25519.SeedSize)))
+	keyHash := common.Blake2b224Hash(key.Public().(ed25519.PublicKey))
+
+	addr, err := common.NewAddressFromParts(common.AddressTypeKeyNone, 0, keyHash[:], nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return key, addr
+}
+
+func TestTxValidator(t *testing.T) {
+	params := newValidatorTestParams()
+
+	key, addr := newValidatorTestKey(1)
+	_, otherAddr := newValidatorTestKey(2)
+
+	inputTxID := strings.Repeat("aa", 32)
+	input := shelley.NewShelleyTransactionInput(inputTxID, 0)
+	missing := shelley.NewShelleyTransactionInput(inputTxID, 1)
+
+	utxos := map[string]UTXO{
+		inputKey(input): {TxID: inputTxID, OutputIndex: 0, Address: addr.String(), Lovelace: "10000000"},
+	}
+
+	resolve := func(in common.TransactionInput) (UTXO, bool, error) {
+		utxo, ok := utxos[inputKey(in)]
+		return utxo, ok, nil
+	}
+
+	// returns a balanced body paying the given fee
+	newBody := func(fee uint64) validatorTestBody {
+		return validatorTestBody{
+			inputs:  []common.TransactionInput{input},
+			outputs: []validatorTestOutput{{otherAddr, 10000000 - fee}},
+			fee:     fee,
+			ttl:     2000,
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		tx    func() ledger.Transaction
+		check func(e *CardanoCLITxSubmitError) bool
+	}{
+		{
+			"Valid",
+			func() ledger.Transaction {
+				return newValidatorTestTx(t, newBody(200000), key)
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				return e == nil
+			},
+		},
+		{
+			"FeeTooSmall",
+			func() ledger.Transaction {
+				return newValidatorTestTx(t, newBody(100000), key)
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				return e != nil && e.FeeTooSmall != nil && e.FeeTooSmall.Supplied == 100000 && e.FeeTooSmall.Expected > 155381 && e.ValueMismatch == nil && strings.Contains(e.Raw, "FeeTooSmallUTxO")
+			},
+		},
+		{
+			"Expired",
+			func() ledger.Transaction {
+				body := newBody(200000)
+				body.ttl = 1000
+				return newValidatorTestTx(t, body, key)
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				return e != nil && e.OutsideValidityInterval != nil && e.OutsideValidityInterval.InvalidHereafter == 1000 && e.OutsideValidityInterval.Slot == 1500
+			},
+		},
+		{
+			"BadInputs",
+			func() ledger.Transaction {
+				body := newBody(200000)
+				body.inputs = append(body.inputs, missing)
+				return newValidatorTestTx(t, body, key)
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				// value conservation can't be checked
+				return e != nil && len(e.BadInputs) == 1 && e.BadInputs[0].Index == 1 && e.ValueMismatch == nil
+			},
+		},
+		{
+			"ValueNotConserved",
+			func() ledger.Transaction {
+				body := newBody(200000)
+				body.outputs[0].lovelace = 9900000
+				return newValidatorTestTx(t, body, key)
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				return e != nil && e.ValueMismatch != nil && e.ValueMismatch.Supplied == 10000000 && e.ValueMismatch.Expected == 10100000
+			},
+		},
+		{
+			"OutputTooSmall",
+			func() ledger.Transaction {
+				body := newBody(200000)
+				body.outputs[0].lovelace = 10000000 - 200000 - 100000
+				body.outputs = append(body.outputs, validatorTestOutput{addr, 100000})
+				return newValidatorTestTx(t, body, key)
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				return e != nil && len(e.OutputsTooSmall) == 1 && e.OutputsTooSmall[0].Index == 1 && e.OutputsTooSmall[0].MinLovelace > 100000 && e.ValueMismatch == nil
+			},
+		},
+		{
+			"MissingSigner",
+			func() ledger.Transaction {
+				return newValidatorTestTx(t, newBody(200000))
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				return e != nil && len(e.MissingSigners) == 1 && e.MissingSigners[0] == addr.PaymentKeyHash().String()
+			},
+		},
+		{
+			"InvalidWitness",
+			func() ledger.Transaction {
+				// reuse the signature of another tx
+				return encodeValidatorTestTx(t, newBody(200000), signValidatorTestTx(t, newBody(300000), key))
+			},
+			func(e *CardanoCLITxSubmitError) bool {
+				return e != nil && len(e.InvalidWitnesses) == 1 && len(e.MissingSigners) == 1
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verr, err := NewTxValidator(params, 1500, resolve).Validate(tc.tx())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tc.check(verr) {
+				t.Errorf("unexpected validation result %#v", verr)
+			}
+		})
+	}
+}
+
+func TestMinTxFee(t *testing.T) {
+	params := newValidatorTestParams()
+
+	testCases := []struct {
+		name           string
+		size           int
+		exUnits        common.ExUnits
+		refScriptsSize int
+		expected       uint64
+	}{
+		{"Simple", 200, common.ExUnits{}, 0, 155381 + 44*200},
+		{"Scripts", 200, common.ExUnits{Memory: 1000, Steps: 1000000}, 0, 155381 + 44*200 + 130}, // 57.7 + 72.1 rounded up
+		{"RefScripts", 200, common.ExUnits{}, 25600 + 100, 155381 + 44*200 + 15*25600 + 18*100},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if fee := MinTxFee(params, tc.size, tc.exUnits, tc.refScriptsSize); fee != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, fee)
+			}
+		})
+	}
+}
+
+func TestMinOutputLovelace(t *testing.T) {
+	_, addr := newValidatorTestKey(1)
+
+	output := validatorTestOutput{addr, 1000000}
+
+	outputCbor, err := cbor.Encode(output.encoded())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := encodeValidatorTestTx(t, validatorTestBody{outputs: []validatorTestOutput{output}}, nil)
+
+	expected := uint64(160+len(outputCbor)) * 4310
+	if minLovelace := MinOutputLovelace(newValidatorTestParams(), tx.Outputs()[0]); minLovelace != expected {
+		t.Errorf("expected %d, got %d (output %s)", expected, minLovelace, hex.EncodeToString(outputCbor))
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+)
+
+// max number of addresses, credentials and output refs of a single query
+const maxUTXOQueryItems = 1000
+
+// UTXOQueryRequest is the body of POST /api/utxos/query
+type UTXOQueryRequest struct {
+	Addresses   []string `json:"addresses"`   // Shelley or Byron addresses
+	Credentials []string `json:"credentials"` // payment credentials or stake addresses, in the formats accepted by /api/address/{address}/utxos
+	Outputs     []string `json:"outputs"`     // <tx-hash>#<index>
+}
+
+// UTXORef refers to a tx output
+type UTXORef struct {
+	TxHash []byte
+	Index  int
+}
+
+// utxoQuery is a parsed UTXOQueryRequest, with lookup tables to group the UTXOs by query item
+type utxoQuery struct {
+	addresses      []string
+	paymentCreds   [][]byte
+	stakeAddresses [][]byte
+	refs           []UTXORef
+
+	items map[string][]string // address, hex credential or utxo key -> query items, several items can be the same credential in different formats
+}
+
+func parseUTXOQuery(req UTXOQueryRequest, network AddressNetwork) (*utxoQuery, error) {
+	n := len(req.Addresses) + len(req.Credentials) + len(req.Outputs)
+	if n == 0 {
+		return nil, errors.New("expected at least one address, credential or output")
+	} else if n > maxUTXOQueryItems {
+		return nil, fmt.Errorf("too many query items (%d, max %d)", n, maxUTXOQueryItems)
+	}
+
+	q := &utxoQuery{items: make(map[string][]string)}
+
+	for _, addr := range req.Addresses {
+		if _, err := ParseAddress(addr, network); err != nil {
+			return nil, fmt.Errorf("invalid address %s: %v", addr, err)
+		}
+
+		q.addresses = append(q.addresses, addr)
+		q.add(addr, addr)
+	}
+
+	for _, cred := range req.Credentials {
+		parsed, err := ParseAddressQuery(cred, network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential %s: %v", cred, err)
+		} else if parsed.Address != "" {
+			return nil, fmt.Errorf("%s is an address, not a credential", cred)
+		}
+
+		if parsed.PaymentCred != nil {
+			q.paymentCreds = append(q.paymentCreds, parsed.PaymentCred)
+			q.add("payment:"+hex.EncodeToString(parsed.PaymentCred), cred)
+		} else {
+			q.stakeAddresses = append(q.stakeAddresses, parsed.StakeAddress)
+			q.add("stake:"+hex.EncodeToString(parsed.StakeAddress), cred)
+		}
+	}
+
+	for _, output := range req.Outputs {
+		txID, indexStr, _ := strings.Cut(output, "#")
+
+		txHash, err := hex.DecodeString(txID)
+		if err != nil || len(txHash) != 32 {
+			return nil, fmt.Errorf("invalid output %s, expected <tx-hash>#<index>", output)
+		}
+
+		index, err := strconv.ParseUint(indexStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output %s, expected <tx-hash>#<index>", output)
+		}
+
+		q.refs = append(q.refs, UTXORef{txHash, int(index)})
+		q.add(utxoKey(UTXO{TxID: hex.EncodeToString(txHash), OutputIndex: int(index)}), output)
+	}
+
+	return q, nil
+}
+
+func (q *utxoQuery) add(key string, item string) {
+	for _, existing := range q.items[key] {
+		if existing == item {
+			return
+		}
+	}
+
+	q.items[key] = append(q.items[key], item)
+}
+
+// returns the query items matching the UTXO
+func (q *utxoQuery) match(u UTXO) []string {
+	matches := append([]string{}, q.items[u.Address]...)
+	matches = append(matches, q.items[utxoKey(u)]...)
+
+	if len(q.paymentCreds) == 0 && len(q.stakeAddresses) == 0 {
+		return matches
+	}
+
+	addr, err := common.NewAddress(u.Address)
+	if err != nil {
+		return matches
+	}
+
+	paymentCred, stakeAddress := addressCredentials(addr)
+
+	if paymentCred != nil {
+		matches = append(matches, q.items["payment:"+hex.EncodeToString(paymentCred)]...)
+	}
+
+	if stakeAddress != nil {
+		matches = append(matches, q.items["stake:"+hex.EncodeToString(stakeAddress)]...)
+	}
+
+	return matches
+}
+
+// groups the UTXOs by query item, all the items of the request are keys of the result, a UTXO is listed under every item it matches
+func (q *utxoQuery) group(utxos []UTXO) map[string][]UTXO {
+	res := make(map[string][]UTXO)
+	for _, items := range q.items {
+		for _, item := range items {
+			res[item] = []UTXO{}
+		}
+	}
+
+	for _, u := range utxos {
+		for _, item := range q.match(u) {
+			res[item] = append(res[item], u)
+		}
+	}
+
+	for _, list := range res {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].TxID != list[j].TxID {
+				return list[i].TxID < list[j].TxID
+			}
+
+			return list[i].OutputIndex < list[j].OutputIndex
+		})
+	}
+
+	return res
+}
+
+func (h *Handler) utxos(w http.ResponseWriter, r *http.Request, url URLHelper) {
+	cmp, url := url.Pop()
+
+	switch cmp {
+	case "query":
+		if !url.Empty() {
+			invalidEndpoint(w, r)
+		} else if r.Method != http.MethodPost {
+			invalidMethod(w, r)
+		} else {
+			h.queryUTXOs(w, r)
+		}
+	default:
+		invalidEndpoint(w, r)
+	}
+}
+
+// read query
+func (h *Handler) queryUTXOs(w http.ResponseWriter, r *http.Request) {
+	var req UTXOQueryRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseUTXOQuery(req, h.config.AddressNetwork())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	utxos, err := h.db.QueryUTXOs(query.addresses, query.paymentCreds, query.stakeAddresses, query.refs, r.Context())
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+
+	utxos = h.mempool.Overlay(utxos, func(u UTXO) bool { return len(query.match(u)) > 0 })
+
+	respondWithGroupedUTXOs(w, r, query.group(utxos))
+}
+
+// responds with a JSON object, or a CBOR map if requested, of the UTXO lists keyed by query item
+func respondWithGroupedUTXOs(w http.ResponseWriter, r *http.Request, groups map[string][]UTXO) {
+	if r.Header.Get("Accept") != "application/cbor" {
+		respondWithJSON(w, groups)
+		return
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	pairs := make([]EncodedPair, 0, len(keys))
+	for _, k := range keys {
+		entries := make([][]byte, 0, len(groups[k]))
+		for _, utxo := range groups[k] {
+			encodedUTXO, err := EncodeUTXO(utxo)
+			if err != nil {
+				internalError(w, err)
+				return
+			}
+			entries = append(entries, encodedUTXO)
+		}
+
+		pairs = append(pairs, EncodedPair{encodeString(k), EncodeList(entries)})
+	}
+
+	respondWithCBOR(w, r, EncodeMap(pairs))
+}
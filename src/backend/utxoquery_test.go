@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
+)
+
+func TestUTXOQuery(t *testing.T) {
+	_, enterprise := newValidatorTestKey(1)
+	payment := enterprise.PaymentKeyHash()
+
+	_, other := newValidatorTestKey(2)
+	stake := other.PaymentKeyHash()
+
+	base, err := common.NewAddressFromParts(common.AddressTypeKeyKey, common.AddressNetworkTestnet, payment[:], stake[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network := AddressNetwork{common.AddressNetworkTestnet, 1}
+	stakeAddress := hex.EncodeToString(append([]byte{0xe0}, stake[:]...))
+	ref := strings.Repeat("cc", 32) + "#1"
+
+	query, err := parseUTXOQuery(UTXOQueryRequest{
+		Addresses:   []string{other.String()},
+		Credentials: []string{hex.EncodeToString(payment[:]), stakeAddress},
+		Outputs:     []string{ref},
+	}, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxos := []UTXO{
+		{TxID: strings.Repeat("aa", 32), OutputIndex: 0, Address: enterprise.String(), Lovelace: "1000000"},
+		{TxID: strings.Repeat("aa", 32), OutputIndex: 1, Address: base.String(), Lovelace: "2000000"},
+		{TxID: strings.Repeat("bb", 32), OutputIndex: 0, Address: other.String(), Lovelace: "3000000"},
+		{TxID: strings.Repeat("cc", 32), OutputIndex: 1, Address: other.String(), Lovelace: "4000000"},
+	}
+
+	groups := query.group(utxos)
+
+	expected := map[string][]int{
+		other.String():                 {2, 3},
+		hex.EncodeToString(payment[:]): {0, 1},
+		stakeAddress:                   {1},
+		ref:                            {3},
+	}
+
+	if len(groups) != len(expected) {
+		t.Fatalf("expected %d groups, got %d", len(expected), len(groups))
+	}
+
+	for item, indices := range expected {
+		group := groups[item]
+		if len(group) != len(indices) {
+			t.Errorf("expected %d UTXOs for %s, got %d", len(indices), item, len(group))
+			continue
+		}
+
+		for i, index := range indices {
+			if utxoKey(group[i]) != utxoKey(utxos[index]) {
+				t.Errorf("unexpected UTXO %s for %s", utxoKey(group[i]), item)
+			}
+		}
+	}
+
+	invalid := []UTXOQueryRequest{
+		{},
+		{Addresses: []string{"addr_test1xyz"}},
+		{Credentials: []string{other.String()}},
+		{Outputs: []string{strings.Repeat("cc", 32)}},
+		{Outputs: []string{"cc#1"}},
+		{Addresses: make([]string, maxUTXOQueryItems+1)},
+	}
+
+	for _, req := range invalid {
+		if _, err := parseUTXOQuery(req, network); err == nil {
+			t.Errorf("expected %v to be rejected", req)
+		}
+	}
+}
@@ -1,24 +1,71 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"math/big"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/blinklabs-io/gouroboros/ledger/common"
 	cg "github.com/echovl/cardano-go"
 	"github.com/echovl/cardano-go/crypto"
 	bip39 "github.com/tyler-smith/go-bip39"
 )
 
-func firstEnterpriseAddressKey(words []string) (crypto.XPrvKey, error) {
+// CIP-1852 derivation roles
+const (
+	walletRoleExternal = 0
+	walletRoleInternal = 1 // change addresses
+	walletRoleStaking  = 2
+)
+
+// address discovery stops after this number of consecutive unused addresses
+const walletGapLimit = 20
+
+// GET /config/wallet reuses the discovered accounts for this duration, unless the mempool changes
+const walletAccountsTTL = time.Minute
+
+func walletRootKey(words []string) (crypto.XPrvKey, error) {
 	mnemonic := strings.Join(words, " ")
 	entropy, err := bip39.EntropyFromMnemonic(mnemonic)
 	if err != nil {
 		return nil, err
 	}
-	root := crypto.NewXPrvKeyFromEntropy(entropy, "")
-	account := root.Derive(1852 + 0x80000000).Derive(1815 + 0x80000000).Derive(0x80000000)
-	chain := account.Derive(0)
-	addrKey := chain.Derive(0)
-	return addrKey, nil
+	return crypto.NewXPrvKeyFromEntropy(entropy, ""), nil
+}
+
+// derives m/1852'/1815'/account', the intermediate keys are zeroed
+func deriveAccountKey(root crypto.XPrvKey, account uint32) crypto.XPrvKey {
+	purpose := root.Derive(1852 + 0x80000000)
+	defer zeroBytes(purpose)
+
+	coin := purpose.Derive(1815 + 0x80000000)
+	defer zeroBytes(coin)
+
+	return coin.Derive(account + 0x80000000)
+}
+
+// derives m/1852'/1815'/account'/role/index
+func deriveWalletKey(root crypto.XPrvKey, account uint32, role uint32, index uint32) crypto.XPrvKey {
+	accountKey := deriveAccountKey(root, account)
+	defer zeroBytes(accountKey)
+
+	roleKey := accountKey.Derive(role)
+	defer zeroBytes(roleKey)
+
+	return roleKey.Derive(index)
+}
+
+func firstEnterpriseAddressKey(words []string) (crypto.XPrvKey, error) {
+	root, err := walletRootKey(words)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(root)
+	return deriveWalletKey(root, 0, walletRoleExternal, 0), nil
 }
 
 func firstEnterpriseAddress(words []string, network string) (string, error) {
@@ -26,15 +73,12 @@ func firstEnterpriseAddress(words []string, network string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer zeroBytes(addrKey)
 	payment, err := cg.NewKeyCredential(addrKey.PubKey())
 	if err != nil {
 		return "", err
 	}
-	net := cg.Testnet
-	if network == "mainnet" {
-		net = cg.Mainnet
-	}
-	addr, err := cg.NewEnterpriseAddress(net, payment)
+	addr, err := cg.NewEnterpriseAddress(walletNetwork(network), payment)
 	if err != nil {
 		return "", err
 	}
@@ -48,3 +92,521 @@ func firstEnterprisePrvKey(words []string) (crypto.PrvKey, error) {
 	}
 	return addrKey.PrvKey(), nil
 }
+
+func walletNetwork(network string) cg.Network {
+	if network == "mainnet" {
+		return cg.Mainnet
+	}
+	return cg.Testnet
+}
+
+// HDWallet derives the base addresses of multiple accounts of the wallet.
+// The first enterprise address, used for the collateral, shares its payment key with the first base address of account 0.
+// Addresses are derived from the extended public keys of the accounts, private keys are only derived by PaymentKey, StakeKey and Keys.
+type HDWallet struct {
+	root     crypto.XPrvKey
+	network  cg.Network
+	accounts map[uint32]crypto.XPubKey
+}
+
+type WalletAccount struct {
+	Index        uint32          `json:"index"`
+	StakeAddress string          `json:"stakeAddress"`
+	Addresses    []WalletAddress `json:"addresses"` // used addresses, followed by the next unused external and internal addresses
+	Lovelace     string          `json:"lovelace"`
+	Assets       []PolicyAsset   `json:"assets,omitempty"`
+}
+
+type WalletAddress struct {
+	Address  string        `json:"address"`
+	Type     string        `json:"type"` // base or enterprise
+	Role     string        `json:"role"` // external or internal (change)
+	Index    uint32        `json:"index"`
+	Path     string        `json:"path"`
+	KeyHash  string        `json:"keyHash"` // of the payment key
+	Used     bool          `json:"used"`
+	Lovelace string        `json:"lovelace"`
+	Assets   []PolicyAsset `json:"assets,omitempty"`
+}
+
+func NewHDWallet(words []string, network string) (*HDWallet, error) {
+	root, err := walletRootKey(words)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HDWallet{root, walletNetwork(network), make(map[uint32]crypto.XPubKey)}, nil
+}
+
+// Close zeroes the root key, the wallet can't be used afterwards
+func (w *HDWallet) Close() {
+	zeroBytes(w.root)
+}
+
+// AccountXPubKey returns the bech32 extended public key of the account
+func (w *HDWallet) AccountXPubKey(account uint32) string {
+	return crypto.PubKey(w.accountXPubKey(account)).Bech32("acct_xvk")
+}
+
+// the account level is the last hardened level of the path, the account private key is zeroed once its public key is cached
+func (w *HDWallet) accountXPubKey(account uint32) crypto.XPubKey {
+	if xpub, ok := w.accounts[account]; ok {
+		return xpub
+	}
+
+	accountKey := deriveAccountKey(w.root, account)
+	defer zeroBytes(accountKey)
+
+	xpub := accountKey.XPubKey()
+	w.accounts[account] = xpub
+
+	return xpub
+}
+
+func (w *HDWallet) StakeKeyHash(account uint32) (string, error) {
+	key, err := w.pubKey(account, walletRoleStaking, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return common.Blake2b224Hash(key).String(), nil
+}
+
+// derives m/1852'/1815'/account'/role/index from the account public key
+func (w *HDWallet) pubKey(account uint32, role uint32, index uint32) (crypto.PubKey, error) {
+	roleKey, err := w.accountXPubKey(account).Derive(role)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := roleKey.Derive(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.PubKey(), nil
+}
+
+// PaymentKey derives a private key, which should be zeroed by the caller after use
+func (w *HDWallet) PaymentKey(account uint32, role uint32, index uint32) crypto.XPrvKey {
+	return deriveWalletKey(w.root, account, role, index)
+}
+
+func (w *HDWallet) StakeKey(account uint32) crypto.XPrvKey {
+	return deriveWalletKey(w.root, account, walletRoleStaking, 0)
+}
+
+func (w *HDWallet) BaseAddress(account uint32, role uint32, index uint32) (WalletAddress, error) {
+	paymentKey, err := w.pubKey(account, role, index)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	stakeKey, err := w.pubKey(account, walletRoleStaking, 0)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	payment, err := cg.NewKeyCredential(paymentKey)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	stake, err := cg.NewKeyCredential(stakeKey)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	addr, err := cg.NewBaseAddress(w.network, payment, stake)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	return w.newWalletAddress(addr.Bech32(), "base", account, role, index, paymentKey), nil
+}
+
+func (w *HDWallet) EnterpriseAddress(account uint32, role uint32, index uint32) (WalletAddress, error) {
+	paymentKey, err := w.pubKey(account, role, index)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	payment, err := cg.NewKeyCredential(paymentKey)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	addr, err := cg.NewEnterpriseAddress(w.network, payment)
+	if err != nil {
+		return WalletAddress{}, err
+	}
+
+	return w.newWalletAddress(addr.Bech32(), "enterprise", account, role, index, paymentKey), nil
+}
+
+func (w *HDWallet) newWalletAddress(addr string, addrType string, account uint32, role uint32, index uint32, paymentKey crypto.PubKey) WalletAddress {
+	roleName := "external"
+	if role == walletRoleInternal {
+		roleName = "internal"
+	}
+
+	return WalletAddress{
+		Address:  addr,
+		Type:     addrType,
+		Role:     roleName,
+		Index:    index,
+		Path:     fmt.Sprintf("m/1852'/1815'/%d'/%d/%d", account, role, index),
+		KeyHash:  common.Blake2b224Hash(paymentKey).String(),
+		Lovelace: "0",
+	}
+}
+
+func (w *HDWallet) StakeAddress(account uint32) (string, error) {
+	// cardano-go can't build reward addresses, so the stake part of the first base address of the account is used
+	base, err := w.BaseAddress(account, walletRoleExternal, 0)
+	if err != nil {
+		return "", err
+	}
+
+	addr, err := common.NewAddress(base.Address)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.StakeAddress().String(), nil
+}
+
+// Discover scans the external and internal chains of the accounts, each chain until gapLimit consecutive addresses are unused.
+// Accounts are scanned until the first account without any used addresses, account 0 is always returned, along with the first enterprise address.
+// filterUsed returns the given addresses that have been used.
+func (w *HDWallet) Discover(gapLimit int, filterUsed func(addrs []string) ([]string, error)) ([]WalletAccount, error) {
+	accounts := []WalletAccount{}
+
+	for account := uint32(0); ; account++ {
+		stakeAddr, err := w.StakeAddress(account)
+		if err != nil {
+			return nil, err
+		}
+
+		res := WalletAccount{Index: account, StakeAddress: stakeAddr, Addresses: []WalletAddress{}, Lovelace: "0"}
+
+		if account == 0 {
+			enterprise, err := w.EnterpriseAddress(0, walletRoleExternal, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			used, err := filterUsed([]string{enterprise.Address})
+			if err != nil {
+				return nil, err
+			}
+
+			enterprise.Used = len(used) > 0
+			res.Addresses = append(res.Addresses, enterprise)
+		}
+
+		anyUsed := false
+
+		for _, role := range []uint32{walletRoleExternal, walletRoleInternal} {
+			addrs, err := w.discoverChain(account, role, gapLimit, filterUsed)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, a := range addrs {
+				anyUsed = anyUsed || a.Used
+			}
+
+			res.Addresses = append(res.Addresses, addrs...)
+		}
+
+		if !anyUsed && account > 0 {
+			break
+		}
+
+		accounts = append(accounts, res)
+
+		if !anyUsed {
+			break
+		}
+	}
+
+	return accounts, nil
+}
+
+// returns the used addresses of a chain, followed by the first unused address
+func (w *HDWallet) discoverChain(account uint32, role uint32, gapLimit int, filterUsed func(addrs []string) ([]string, error)) ([]WalletAddress, error) {
+	res := []WalletAddress{}
+	unused := 0
+
+	for start := uint32(0); unused < gapLimit; start += uint32(gapLimit) {
+		batch := []WalletAddress{}
+		bech32 := []string{}
+
+		for index := start; index < start+uint32(gapLimit); index++ {
+			addr, err := w.BaseAddress(account, role, index)
+			if err != nil {
+				return nil, err
+			}
+
+			batch = append(batch, addr)
+			bech32 = append(bech32, addr.Address)
+		}
+
+		used, err := filterUsed(bech32)
+		if err != nil {
+			return nil, err
+		}
+
+		usedSet := make(map[string]struct{})
+		for _, a := range used {
+			usedSet[a] = struct{}{}
+		}
+
+		for _, addr := range batch {
+			if unused >= gapLimit {
+				break
+			}
+
+			if _, ok := usedSet[addr.Address]; ok {
+				addr.Used = true
+				res = append(res, addr)
+				unused = 0
+			} else {
+				if unused == 0 {
+					// next unused address, discarded below if a later address is used
+					res = append(res, addr)
+				}
+
+				unused++
+			}
+		}
+	}
+
+	// only keep the unused address following the last used address
+	filtered := []WalletAddress{}
+	for i, addr := range res {
+		if addr.Used || i == len(res)-1 {
+			filtered = append(filtered, addr)
+		}
+	}
+
+	return filtered, nil
+}
+
+// Keys returns the private keys of the discovered addresses and of the stake addresses of the accounts, keyed by key hash.
+// The keys should be zeroed using zeroKeys after use.
+func (w *HDWallet) Keys(accounts []WalletAccount) (map[string]crypto.PrvKey, error) {
+	keys := make(map[string]crypto.PrvKey)
+
+	for _, account := range accounts {
+		stakeKeyHash, err := w.StakeKeyHash(account.Index)
+		if err != nil {
+			zeroKeys(keys)
+			return nil, err
+		}
+
+		keys[stakeKeyHash] = w.StakeKey(account.Index).PrvKey()
+
+		for _, addr := range account.Addresses {
+			role := uint32(walletRoleExternal)
+			if addr.Role == "internal" {
+				role = walletRoleInternal
+			}
+
+			keys[addr.KeyHash] = w.PaymentKey(account.Index, role, addr.Index).PrvKey()
+		}
+	}
+
+	return keys, nil
+}
+
+func zeroKeys(keys map[string]crypto.PrvKey) {
+	for _, key := range keys {
+		zeroBytes(key)
+	}
+}
+
+// sums the lovelace and assets of the UTXOs
+func sumUTXOs(utxos []UTXO) (string, []PolicyAsset) {
+	lovelace := new(big.Int)
+	assets := make(map[string]*big.Int)
+
+	for _, u := range utxos {
+		if l, ok := new(big.Int).SetString(u.Lovelace, 10); ok {
+			lovelace.Add(lovelace, l)
+		}
+
+		for _, a := range u.Assets {
+			if qty, ok := new(big.Int).SetString(a.Quantity, 10); ok {
+				addAssetQuantity(assets, a.Asset, qty)
+			}
+		}
+	}
+
+	res := []PolicyAsset{}
+	for _, asset := range sortedAssetKeys(assets) {
+		res = append(res, PolicyAsset{Asset: asset, Quantity: assets[asset].String()})
+	}
+
+	return lovelace.String(), res
+}
+
+type WalletResponse struct {
+	Address  string          `json:"address"` // first enterprise address, holding the collateral
+	Accounts []WalletAccount `json:"accounts"`
+	Lovelace string          `json:"lovelace"`
+	Assets   []PolicyAsset   `json:"assets,omitempty"`
+}
+
+type WalletSignResponse struct {
+	CBORHex   string   `json:"cborHex"`
+	TxID      string   `json:"txID"`
+	Signers   []string `json:"signers"`   // hashes of the wallet keys that signed the tx
+	Witnesses []string `json:"witnesses"` // vkey witnesses added to the tx, CBOR hex
+	Missing   []string `json:"missing"`   // hashes of required signers the wallet doesn't hold keys for
+}
+
+// discoverWallet derives the used addresses of the wallet, an address is used if it appears in a tx output, including mempool txs.
+// Only the account keys are derived privately, the addresses are derived from their public keys.
+// The returned wallet should be closed after use.
+func (h *Handler) discoverWallet(ctx context.Context) (*HDWallet, []WalletAccount, error) {
+	wallet, err := NewHDWallet(h.config.Wallet, h.config.NetworkName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filterUsed := func(addrs []string) ([]string, error) {
+		used, err := h.db.FilterUsedAddresses(addrs, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		pending := make(map[string]struct{})
+		for _, a := range addrs {
+			pending[a] = struct{}{}
+		}
+
+		for _, a := range used {
+			delete(pending, a)
+		}
+
+		for _, u := range h.mempool.Overlay(nil, func(u UTXO) bool { _, ok := pending[u.Address]; return ok }) {
+			if _, ok := pending[u.Address]; ok {
+				used = append(used, u.Address)
+				delete(pending, u.Address)
+			}
+		}
+
+		return used, nil
+	}
+
+	accounts, err := wallet.Discover(walletGapLimit, filterUsed)
+	if err != nil {
+		wallet.Close()
+		return nil, nil, err
+	}
+
+	return wallet, accounts, nil
+}
+
+// WalletAccountsCache keeps the last discovered accounts of the wallet, because discovering them runs a gap-limit scan
+type WalletAccountsCache struct {
+	mu       sync.Mutex // held during discovery, so that concurrent requests wait for the same scan
+	accounts []WalletAccount
+	mempool  []string // hashes of the mempool txs at discovery
+	expires  time.Time
+}
+
+// cachedWalletAccounts returns the discovered accounts, which are discovered again once expired or once the mempool changed.
+// The returned accounts are a copy, so their balances can be set.
+func (h *Handler) cachedWalletAccounts(ctx context.Context) ([]WalletAccount, error) {
+	c := h.walletCache
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	mempool := h.mempool.Hashes()
+
+	if c.accounts == nil || now.After(c.expires) || !slices.Equal(mempool, c.mempool) {
+		wallet, accounts, err := h.discoverWallet(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		wallet.Close()
+
+		c.accounts = accounts
+		c.mempool = mempool
+		c.expires = now.Add(walletAccountsTTL)
+	}
+
+	accounts := make([]WalletAccount, len(c.accounts))
+	for i, account := range c.accounts {
+		account.Addresses = slices.Clone(account.Addresses)
+		accounts[i] = account
+	}
+
+	return accounts, nil
+}
+
+// walletBalances sets the balances of the addresses and accounts, taking the mempool into account.
+// The UTXOs of all the used addresses are queried at once.
+func (h *Handler) walletBalances(ctx context.Context, accounts []WalletAccount) (WalletResponse, error) {
+	res := WalletResponse{Accounts: accounts}
+
+	used := []string{}
+	isUsed := make(map[string]struct{})
+	for _, account := range accounts {
+		for _, addr := range account.Addresses {
+			if addr.Used {
+				used = append(used, addr.Address)
+				isUsed[addr.Address] = struct{}{}
+			}
+		}
+	}
+
+	utxos := []UTXO{}
+	if len(used) > 0 {
+		var err error
+		if utxos, err = h.db.QueryUTXOs(used, nil, nil, nil, ctx); err != nil {
+			return WalletResponse{}, err
+		}
+	}
+
+	utxos = h.mempool.Overlay(utxos, func(u UTXO) bool { _, ok := isUsed[u.Address]; return ok })
+
+	byAddress := make(map[string][]UTXO)
+	for _, u := range utxos {
+		byAddress[u.Address] = append(byAddress[u.Address], u)
+	}
+
+	all := []UTXO{}
+	for i := range accounts {
+		account := &accounts[i]
+		accountUTXOs := []UTXO{}
+
+		for j := range account.Addresses {
+			addr := &account.Addresses[j]
+
+			if addr.Type == "enterprise" {
+				res.Address = addr.Address
+			}
+
+			if !addr.Used {
+				continue
+			}
+
+			addr.Lovelace, addr.Assets = sumUTXOs(byAddress[addr.Address])
+			accountUTXOs = append(accountUTXOs, byAddress[addr.Address]...)
+		}
+
+		account.Lovelace, account.Assets = sumUTXOs(accountUTXOs)
+		all = append(all, accountUTXOs...)
+	}
+
+	res.Lovelace, res.Assets = sumUTXOs(all)
+
+	return res, nil
+}
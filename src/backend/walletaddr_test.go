@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/blinklabs-io/gouroboros/ledger/common"
 )
 
 func TestFirstEnterpriseAddress(t *testing.T) {
@@ -34,3 +37,147 @@ func TestFirstEnterpriseAddress(t *testing.T) {
 		}
 	}
 }
+
+func TestHDWalletAddresses(t *testing.T) {
+	wallet, err := NewHDWallet(strings.Fields(sponsorTestMnemonic), "preprod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enterprise, err := wallet.EnterpriseAddress(0, walletRoleExternal, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enterprise.Address != "addr_test1vqzkxpwrnvu3ylqvj6wupde0pjk4w28zu9893wu55z4upfc2504tp" {
+		t.Errorf("unexpected enterprise address %s", enterprise.Address)
+	}
+
+	stakeAddr, err := wallet.StakeAddress(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(stakeAddr, "stake_test1") {
+		t.Fatalf("unexpected stake address %s", stakeAddr)
+	}
+
+	base, err := wallet.BaseAddress(0, walletRoleInternal, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err := common.NewAddress(base.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if addr.Type() != common.AddressTypeKeyKey || addr.PaymentKeyHash().String() != base.KeyHash {
+		t.Errorf("unexpected payment part of %s", base.Address)
+	}
+
+	if addr.StakeAddress().String() != stakeAddr {
+		t.Errorf("expected stake address %s, got %s", stakeAddr, addr.StakeAddress().String())
+	}
+
+	if base.Role != "internal" || base.Path != "m/1852'/1815'/0'/1/3" {
+		t.Errorf("unexpected role %s or path %s", base.Role, base.Path)
+	}
+
+	other, err := wallet.BaseAddress(1, walletRoleExternal, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if otherAddr, _ := common.NewAddress(other.Address); otherAddr.StakeAddress().String() == stakeAddr {
+		t.Errorf("expected accounts to have different stake keys")
+	}
+}
+
+func TestHDWalletDiscover(t *testing.T) {
+	wallet, err := NewHDWallet(strings.Fields(sponsorTestMnemonic), "preprod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type path struct{ account, role, index uint32 }
+
+	// external address 25 is beyond the gap of the first batch, but within the gap limit after address 10
+	usedPaths := []path{{0, walletRoleExternal, 0}, {0, walletRoleExternal, 10}, {0, walletRoleExternal, 25}, {0, walletRoleInternal, 1}, {1, walletRoleExternal, 2}}
+
+	// address 0/0/47 is only used after a gap of 21 addresses, so isn't discovered
+	hidden, err := wallet.BaseAddress(0, walletRoleExternal, 47)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := map[string]struct{}{hidden.Address: {}}
+	for _, p := range usedPaths {
+		addr, err := wallet.BaseAddress(p.account, p.role, p.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		used[addr.Address] = struct{}{}
+	}
+
+	accounts, err := wallet.Discover(20, func(addrs []string) ([]string, error) {
+		res := []string{}
+		for _, a := range addrs {
+			if _, ok := used[a]; ok {
+				res = append(res, a)
+			}
+		}
+		return res, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 accounts, got %d", len(accounts))
+	}
+
+	expected := [][]string{
+		{"enterprise 0", "external 0", "external 10", "external 25", "external 26", "internal 1", "internal 2"},
+		{"external 2", "external 3", "internal 0"},
+	}
+
+	for i, account := range accounts {
+		got := []string{}
+		for _, addr := range account.Addresses {
+			name := fmt.Sprintf("%s %d", addr.Role, addr.Index)
+			if addr.Type == "enterprise" {
+				name = fmt.Sprintf("enterprise %d", addr.Index)
+			}
+
+			if _, ok := used[addr.Address]; ok != addr.Used {
+				t.Errorf("wrong used flag for %s", name)
+			}
+
+			got = append(got, name)
+		}
+
+		if strings.Join(got, ",") != strings.Join(expected[i], ",") {
+			t.Errorf("account %d: expected %v, got %v", i, expected[i], got)
+		}
+	}
+
+	keys, err := wallet.Keys(accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, account := range accounts {
+		for _, addr := range account.Addresses {
+			if key, ok := keys[addr.KeyHash]; !ok || common.Blake2b224Hash(key.PubKey()).String() != addr.KeyHash {
+				t.Errorf("missing key of %s", addr.Path)
+			}
+		}
+	}
+
+	// the first enterprise address shares its key with the first base address
+	if len(keys) != 11 {
+		t.Errorf("expected 11 keys, got %d", len(keys))
+	}
+}
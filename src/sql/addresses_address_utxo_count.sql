@@ -0,0 +1,10 @@
+SELECT COUNT(*) AS "utxoCount"
+FROM tx_out txo
+WHERE txo.consumed_by_tx_id IS NULL -- same spent criterion as utxos_query and blockfrost/addresses_address
+  AND (
+    CASE
+      -- :: cast of parameters is necessary for PG in order to validate against NULL
+      WHEN $2::BYTEA IS NOT NULL THEN txo.payment_cred = $2
+      ELSE txo.address = $1
+    END
+  )
@@ -0,0 +1,8 @@
+WITH input(address) AS (
+    SELECT unnest($1::text[])
+)
+SELECT address
+FROM input
+WHERE EXISTS (
+    SELECT 1 FROM tx_out WHERE tx_out.address = input.address
+);
@@ -12,18 +12,14 @@ WITH queried_address AS (
   SELECT COALESCE(txo.value, 0) AS "amount",
     array_agg(mto.id) AS "assets_ids"
   FROM tx_out txo
-    JOIN tx ON (txo.tx_id = tx.id)
-    LEFT JOIN tx_in txi ON (txo.tx_id = txi.tx_out_id)
-    AND (txo.index = txi.tx_out_index)
     LEFT JOIN ma_tx_out mto ON (mto.tx_out_id = txo.id)
-  WHERE txi IS NULL
+  WHERE txo.consumed_by_tx_id IS NULL -- same spent criterion as utxos_query
     AND (
       CASE
         WHEN $2::BYTEA IS NOT NULL THEN txo.payment_cred = $2
         ELSE txo.address = $1
       END
     )
-    AND tx.valid_contract = 'true' -- don't count utxos that are part of transaction that failed script validation at stage 2
   GROUP BY txo.id
 )
 SELECT (
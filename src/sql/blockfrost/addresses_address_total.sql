@@ -3,11 +3,7 @@ WITH queried_outputs AS (
     array_agg(mto.id) AS "assets_ids",
     array_agg(DISTINCT tx.id) AS "txids"
   FROM tx
-    JOIN tx_in txi ON (txi.tx_in_id = tx.id)
-    JOIN tx_out txo ON (
-      txo.tx_id = txi.tx_out_id
-      AND txo.index = txi.tx_out_index
-    )
+    JOIN tx_out txo ON (txo.consumed_by_tx_id = tx.id) -- same spent criterion as utxos_query
     LEFT JOIN ma_tx_out mto ON (mto.tx_out_id = txo.id)
   WHERE (
       CASE
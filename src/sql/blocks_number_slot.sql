@@ -0,0 +1,3 @@
+SELECT b.slot_no AS "slot"
+FROM block b
+WHERE b.block_no = $1
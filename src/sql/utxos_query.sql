@@ -0,0 +1,46 @@
+-- unspent outputs of any of the addresses ($1), payment credentials ($2), stake addresses ($3) or output refs ($4 and $5)
+WITH matched AS (
+  SELECT txo.id
+  FROM tx_out txo
+  WHERE txo.address = ANY($1::TEXT[])
+  UNION
+  SELECT txo.id
+  FROM tx_out txo
+  WHERE txo.payment_cred = ANY($2::BYTEA[])
+  UNION
+  SELECT txo.id
+  FROM tx_out txo
+    JOIN stake_address sa ON (txo.stake_address_id = sa.id)
+  WHERE sa.hash_raw = ANY($3::BYTEA[])
+  UNION
+  SELECT txo.id
+  FROM unnest($4::BYTEA[], $5::INTEGER[]) AS ref(hash, index)
+    JOIN tx ON (tx.hash = ref.hash)
+    JOIN tx_out txo ON (txo.tx_id = tx.id AND txo.index = ref.index)
+)
+SELECT encode(tx.hash, 'hex') AS "txID",
+  txo.index AS "outputIndex",
+  txo.address AS "address",
+  txo.value::TEXT AS "lovelace", -- cast to TEXT to avoid number overflow
+  (
+    SELECT json_agg(
+        json_build_object(
+          'asset',
+          CONCAT(encode(ma.policy, 'hex'), encode(ma.name, 'hex')),
+          'quantity',
+          mto.quantity::TEXT -- cast to TEXT to avoid number overflow
+        )
+      )
+    FROM ma_tx_out mto
+      JOIN multi_asset ma ON (mto.ident = ma.id)
+    WHERE mto.tx_out_id = txo.id
+  ) AS "assets",
+  encode(data_hash, 'hex') AS "datumHash",
+  encode(dat.bytes, 'hex') AS "inlineDatum",
+  encode(scr.bytes, 'hex') AS "refScript"
+FROM matched
+  JOIN tx_out txo ON (txo.id = matched.id)
+  JOIN tx ON (tx.id = txo.tx_id)
+  LEFT JOIN datum dat ON (txo.inline_datum_id = dat.id)
+  LEFT JOIN script scr ON (txo.reference_script_id = scr.id)
+WHERE txo.consumed_by_tx_id IS NULL
\ No newline at end of file
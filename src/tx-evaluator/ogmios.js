@@ -0,0 +1,101 @@
+// Reference evaluator for the --tx-evaluator flag of Iris, delegating the evaluation to Ogmios (v6, JSON-RPC over HTTP).
+// Ogmios evaluates the redeemers using the protocol parameters, and so the cost models, of its node.
+// Inputs are resolved by the node, so inputs produced by mempool transactions aren't supported.
+//
+// Usage: cardano-iris --tx-evaluator "node /path/to/ogmios.js"
+// The Ogmios URL defaults to http://localhost:1337, and can be changed using the OGMIOS_URL environment variable.
+
+import { stdin, stdout, env, exit } from "node:process"
+
+const ogmiosURL = env.OGMIOS_URL ?? "http://localhost:1337"
+
+// Ogmios validator purposes, mapped to the redeemer tags of Iris
+const tags = {
+    spend: "spend",
+    mint: "mint",
+    publish: "cert",
+    withdraw: "reward",
+    vote: "voting",
+    propose: "proposing"
+}
+
+/**
+ * @returns {Promise<string>}
+ */
+async function readStdin() {
+    const chunks = []
+
+    for await (const chunk of stdin) {
+        chunks.push(chunk)
+    }
+
+    return Buffer.concat(chunks).toString("utf8")
+}
+
+/**
+ * Collects the traces of the failing scripts, which are nested in the error data
+ * @param {any} data
+ * @returns {string[]}
+ */
+function collectTraces(data) {
+    if (Array.isArray(data)) {
+        return data.flatMap(collectTraces)
+    } else if (data && typeof data == "object") {
+        return Object.entries(data).flatMap(([key, value]) =>
+            key == "traces" && Array.isArray(value)
+                ? value.map(String)
+                : collectTraces(value)
+        )
+    } else {
+        return []
+    }
+}
+
+async function main() {
+    const request = JSON.parse(await readStdin())
+
+    const response = await fetch(ogmiosURL, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({
+            jsonrpc: "2.0",
+            method: "evaluateTransaction",
+            params: { transaction: { cbor: request.cborHex } },
+            id: null
+        })
+    })
+
+    const body = await response.json()
+
+    if (body.error) {
+        const logs = collectTraces(body.error.data)
+        const messages = [body.error.message]
+
+        // the messages of the individual script failures are more helpful than the top-level message
+        if (Array.isArray(body.error.data)) {
+            for (const failure of body.error.data) {
+                if (failure?.error?.message) {
+                    messages.push(failure.error.message)
+                }
+            }
+        }
+
+        stdout.write(JSON.stringify({ error: messages.join(": "), logs }))
+        return
+    }
+
+    const redeemers = body.result.map((r) => ({
+        tag: tags[r.validator.purpose] ?? r.validator.purpose,
+        index: r.validator.index,
+        memory: r.budget.memory,
+        steps: r.budget.cpu,
+        logs: []
+    }))
+
+    stdout.write(JSON.stringify({ redeemers }))
+}
+
+main().catch((err) => {
+    console.error(err)
+    exit(1)
+})